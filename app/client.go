@@ -2,16 +2,24 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"github.com/ldsec/lattigo/bfv"
 	"github.com/urfave/cli"
+	"go.dedis.ch/kyber/v3"
+	kyberkey "go.dedis.ch/kyber/v3/util/key"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/app"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
 	uuid "gopkg.in/satori/go.uuid.v1"
+	"io/ioutil"
 	"lattigo-smc/services"
 	"lattigo-smc/utils"
 	"os"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 type SetupValues struct {
@@ -28,6 +36,7 @@ func runLattigo(c *cli.Context) {
 	groupToml := c.String("grouptoml")
 	id := c.Int("id")
 	setup := c.String("setup")
+	paramsFile := c.String("params")
 	retrieveKey := c.String("retrievekey")
 
 	//Write-Read
@@ -35,12 +44,27 @@ func runLattigo(c *cli.Context) {
 	typeData := c.String("type")
 	get := c.String("get")
 
+	//Names
+	name := c.String("name")
+	rename := c.String("rename")
+	alias := c.String("alias")
+
 	//Evaluations
 	sum := c.String("sum")
 	multiply := c.String("multiply")
 	refresh := c.String("refresh")
 	relin := c.String("relin")
 	rotate := c.String("rotate")
+	rekey := c.Bool("rekey")
+	join := c.Int("join")
+	leave := c.Int("leave")
+	approveJoin := c.Int("approvejoin")
+	approveLeave := c.Int("approveleave")
+	approveTransfer := c.String("approvetransfer")
+	transfer := c.String("transfer")
+	stats := c.String("stats")
+	contribute := c.String("contribute")
+	aggregate := c.String("aggregate")
 
 	//Setups
 	//setup the group toml for servers...
@@ -60,7 +84,13 @@ func runLattigo(c *cli.Context) {
 
 		values := parseSetup(setup)
 		seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
-		err := client.SendSetupQuery(roster, values.genPublicKey, values.genEvalKey, values.genRotKey, uint64(values.rotIdx), int(values.K), uint64(values.paramsIdx), seed)
+		var err error
+		request := setupRequest(roster, values, seed, c.Float64("budget"), c.Float64("sensitivity"))
+		if paramsFile != "" {
+			err = setupWithParameters(client, request, paramsFile)
+		} else {
+			err = client.SendSetupRequest(request)
+		}
 		if err != nil {
 			log.Error("Could not setup the client :", err)
 		}
@@ -80,6 +110,59 @@ func runLattigo(c *cli.Context) {
 
 	}
 
+	if rekey {
+		log.Lvl1("Request to rotate the collective key")
+		err := client.SendRekeyQuery()
+		if err != nil {
+			log.Error("Could not rotate the collective key : ", err)
+			return
+		}
+		log.Lvl1("Collective key rotated")
+	}
+	if approveJoin >= 0 || approveLeave >= 0 || approveTransfer != "" {
+		private, err := loadPrivate(c.String("private"))
+		if err != nil {
+			log.Error("Could not read the private key of the server : ", err)
+			return
+		}
+		if approveJoin >= 0 && approveJoin < len(roster.List) {
+			err = client.ApproveMembership(services.MemberJoin, roster.List[approveJoin], private)
+		}
+		if err == nil && approveLeave >= 0 && approveLeave < len(roster.List) {
+			err = client.ApproveMembership(services.MemberLeave, roster.List[approveLeave], private)
+		}
+		if err == nil && approveTransfer != "" {
+			var target *onet.Roster
+			target, err = parseGroupToml(approveTransfer)
+			if err == nil {
+				err = client.ApproveTransferTarget(target.List[0], private)
+			}
+		}
+		if err != nil {
+			log.Error("Could not approve : ", err)
+			return
+		}
+		log.Lvl1("Approved by ", roster.List[id])
+	}
+	if join >= 0 && join < len(roster.List) {
+		log.Lvl1("Request to add ", roster.List[join], " to the roster")
+		err := client.SendJoinQuery(roster.List[join])
+		if err != nil {
+			log.Error("Could not add the server : ", err)
+			return
+		}
+		log.Lvl1("Server added to the roster")
+	}
+	if leave >= 0 && leave < len(roster.List) {
+		log.Lvl1("Request to remove ", roster.List[leave], " from the roster")
+		err := client.SendLeaveQuery(roster.List[leave])
+		if err != nil {
+			log.Error("Could not remove the server : ", err)
+			return
+		}
+		log.Lvl1("Server removed from the roster")
+	}
+
 	if write != "" {
 		if typeData == "" {
 			typeData = "string"
@@ -103,14 +186,90 @@ func runLattigo(c *cli.Context) {
 			return
 		}
 		log.Lvl1("Wrote data at id : ", id)
+		if name != "" {
+			err = client.SendRegisterNameQuery(name, *id)
+			if err != nil {
+				log.Error("Could not register the name : ", err)
+				return
+			}
+			log.Lvl1("Registered ", id, " as ", name)
+		}
 		return
 
 	}
+	if rename != "" || alias != "" {
+		values := strings.Split(rename+alias, ",")
+		if len(values) != 2 {
+			log.Error("Invalid input expected two names comma separated got ", values)
+			return
+		}
+		var err error
+		if rename != "" {
+			err = client.SendRenameQuery(values[0], values[1])
+		} else {
+			err = client.SendAliasQuery(values[0], values[1])
+		}
+		if err != nil {
+			log.Error("Could not send name query : ", err)
+			return
+		}
+		log.Lvl1("Registered ", values[1], " for ", values[0])
+		return
+	}
+	if transfer != "" {
+		values := strings.Split(transfer, ",")
+		if len(values) != 2 {
+			log.Error("Transfer format : <UUID or name>,<group toml>")
+			return
+		}
+		id, err := client.Reference(values[0])
+		if err != nil {
+			log.Error("Incorrect id or name :", err)
+			return
+		}
+		target, err := parseGroupToml(values[1])
+		if err != nil {
+			log.Error("Could not parse group toml file :", values[1])
+			return
+		}
+		noise, err := parseNoise(c.String("noise"))
+		if err != nil {
+			log.Error("Incorrect noise :", err)
+			return
+		}
+		transferred, err := client.SendNoisyTransferQuery(id, target, noise)
+		if err != nil {
+			log.Error("Could not transfer the ciphertext : ", err)
+			return
+		}
+		log.Lvl1("Transferred ", id, " to the other collective under id ", transferred)
+		return
+	}
 	if get != "" {
 		log.Lvl1("Request to get data from server")
-		id, err := uuid.FromString(get)
+		id, name := services.ParseReference(get)
+		noise, err := parseNoise(c.String("noise"))
 		if err != nil {
-			log.Error("Incorrect UUID :", err)
+			log.Error("Incorrect noise :", err)
+			return
+		}
+		if name != "" {
+			//the name is resolved by the root.
+			values, err := client.GetNamedPlaintext(name, noise)
+			if err != nil {
+				log.Error("Could not get the data : ", err)
+				return
+			}
+			log.Lvl1("Retrieved data of ", name, " : ", values.Text())
+			return
+		}
+		if noise != nil {
+			values, err := client.GetNoisyPlaintext(&id, noise)
+			if err != nil {
+				log.Error("Could not get the data with noise : ", err)
+				return
+			}
+			log.Lvl1("Retrieved data with noise at id ", id, " : ", values.Text())
 			return
 		}
 		data, err := client.GetPlaintext(&id)
@@ -131,16 +290,10 @@ func runLattigo(c *cli.Context) {
 			log.Error("Invalid input expected two id comma separated got ", values)
 			return
 		}
-		id1, err := uuid.FromString(values[0])
-		if err != nil {
-			log.Error("incorrect id ", err)
-		}
-		id2, err := uuid.FromString(values[1])
-		if err != nil {
-			log.Error("incorrect id ", err)
-		}
+		id1, name1 := services.ParseReference(values[0])
+		id2, name2 := services.ParseReference(values[1])
 
-		res, err := client.SendSumQuery(id1, id2)
+		res, err := client.SendEvaluationQuery(&services.SumQuery{UUID: id1, Other: id2, Name: name1, OtherName: name2})
 		if err != nil {
 			log.Error("Could not send sum query : ", err)
 			return
@@ -157,16 +310,10 @@ func runLattigo(c *cli.Context) {
 			log.Error("Invalid input expected two id comma separated got ", values)
 			return
 		}
-		id1, err := uuid.FromString(values[0])
-		if err != nil {
-			log.Error("incorrect id ", err)
-		}
-		id2, err := uuid.FromString(values[1])
-		if err != nil {
-			log.Error("incorrect id ", err)
-		}
+		id1, name1 := services.ParseReference(values[0])
+		id2, name2 := services.ParseReference(values[1])
 
-		res, err := client.SendMultiplyQuery(id1, id2)
+		res, err := client.SendEvaluationQuery(&services.MultiplyQuery{UUID: id1, Other: id2, Name: name1, OtherName: name2})
 		if err != nil {
 			log.Error("Could not send multiply query : ", err)
 			return
@@ -180,7 +327,7 @@ func runLattigo(c *cli.Context) {
 	if refresh != "" {
 		log.Lvl1("Query to refresh values on the root")
 
-		id, err := uuid.FromString(refresh)
+		id, err := client.Reference(refresh)
 		if err != nil {
 			log.Error("incorrect id ", err)
 		}
@@ -197,7 +344,7 @@ func runLattigo(c *cli.Context) {
 
 	if relin != "" {
 		log.Lvl1("Query to relinearize a cipher")
-		id, err := uuid.FromString(relin)
+		id, err := client.Reference(relin)
 		if err != nil {
 			log.Error("incorrect id ", err)
 		}
@@ -216,7 +363,7 @@ func runLattigo(c *cli.Context) {
 		log.Lvl1("Query to rotate a cipher")
 		values := strings.Split(rotate, ",")
 
-		id, err := uuid.FromString(values[0])
+		id, err := client.Reference(values[0])
 		if err != nil {
 			log.Error("incorrect id ", err)
 			return
@@ -244,6 +391,529 @@ func runLattigo(c *cli.Context) {
 		return
 	}
 
+	if contribute != "" {
+		log.Lvl1("Contribution of a local CSV column")
+		values := strings.Split(contribute, ",")
+		if len(values) < 4 {
+			log.Error("Contribution format : <dataset>,<csv file>,<column>,<uint|int|fixed|bool>[,<scale>]")
+			return
+		}
+		descriptor, err := parseColumnType(values[3:])
+		if err != nil {
+			log.Error("Incorrect type of the column : ", err)
+			return
+		}
+		file, err := os.Open(values[1])
+		if err != nil {
+			log.Error("Could not open the CSV file : ", err)
+			return
+		}
+		defer file.Close()
+		column, err := utils.ReadCSVColumn(file, values[2], descriptor)
+		if err != nil {
+			log.Error("Could not read the CSV file : ", err)
+			return
+		}
+		private, err := loadPrivate(c.String("private"))
+		if err != nil {
+			log.Error("Could not read the private key of the server : ", err)
+			return
+		}
+		res, err := client.SendContributionQuery(values[0], column, c.Bool("replace"), private)
+		if err != nil {
+			log.Error("Could not contribute to the dataset : ", err)
+			return
+		}
+		log.Lvl1("Contributed ", column.Descriptor.Length, " values to ", values[0], " at id ", res)
+		return
+	}
+
+	if aggregate != "" {
+		log.Lvl1("Query to aggregate the contributions of the members")
+		res, err := client.SendAggregationQuery(aggregate)
+		if err != nil {
+			log.Error("Could not aggregate the contributions : ", err)
+			return
+		}
+		log.Lvl1("Aggregate of ", aggregate, " is stored at id ", res)
+		return
+	}
+
+	if stats != "" {
+		log.Lvl1("Query for a statistic of the columns")
+		values := strings.Split(stats, ",")
+		statistic, err := parseStatistic(values[0])
+		if err != nil {
+			log.Error("Incorrect statistic : ", err)
+			return
+		}
+		if len(values) < 2 {
+			log.Error("Statistics format : <statistic>,<id1>[,<id2>...]")
+			return
+		}
+		ids := make([]uuid.UUID, len(values)-1)
+		for i, v := range values[1:] {
+			ids[i], err = client.Reference(v)
+			if err != nil {
+				log.Error("incorrect id ", err)
+				return
+			}
+		}
+		res, err := client.SendStatisticsQuery(statistic, ids, c.Uint64("buckets"))
+		if err != nil {
+			log.Error("Could not send statistics query : ", err)
+			return
+		}
+		log.Lvl1("Statistic stored at ids count : ", res.Count, " sum : ", res.Sum, " sum of squares : ", res.SumOfSquares, " histogram : ", res.Histogram)
+		return
+	}
+
+}
+
+//parseColumnType parses the type of a CSV column <uint|int|fixed|bool>[,<scale>], the scale is needed by the fixed-point numbers.
+func parseColumnType(values []string) (utils.DataDescriptor, error) {
+	descriptor := utils.DataDescriptor{}
+	switch values[0] {
+	case "uint":
+		descriptor.Type = utils.TypeUint
+	case "int":
+		descriptor.Type = utils.TypeInt
+	case "fixed":
+		descriptor.Type = utils.TypeFixed
+		if len(values) < 2 {
+			return descriptor, errors.New("fixed-point numbers need a scale")
+		}
+		scale, err := strconv.ParseUint(values[1], 10, 64)
+		if err != nil {
+			return descriptor, err
+		}
+		descriptor.Scale = scale
+	case "bool":
+		descriptor.Type = utils.TypeBool
+	default:
+		return descriptor, errors.New("unknown type " + values[0])
+	}
+	return descriptor, nil
+}
+
+//parseStatistic parses the name of a statistic.
+func parseStatistic(s string) (services.Statistic, error) {
+	switch s {
+	case "count":
+		return services.StatisticCount, nil
+	case "sum":
+		return services.StatisticSum, nil
+	case "sumofsquares":
+		return services.StatisticSumOfSquares, nil
+	case "mean":
+		return services.StatisticMean, nil
+	case "variance":
+		return services.StatisticVariance, nil
+	case "histogram":
+		return services.StatisticHistogram, nil
+	}
+	return 0, errors.New("unknown statistic " + s)
+}
+
+func runCatalog(c *cli.Context) {
+	groupToml := c.String("grouptoml")
+	if groupToml == "" {
+		groupToml = "server.toml"
+		log.Lvl1("Using default grouptoml :", groupToml)
+	}
+	roster, err := parseGroupToml(groupToml)
+	if err != nil {
+		log.ErrFatal(err, "Could not parse group toml file :", groupToml)
+	}
+	id := c.Int("id")
+	client := services.NewLattigoSMCClient(roster.List[id], strconv.Itoa(id))
+
+	query := services.CatalogQuery{
+		Owner:     c.String("owner"),
+		Operation: c.String("operation"),
+		Offset:    c.Uint64("offset"),
+		Limit:     c.Uint64("limit"),
+		Dataset:   c.String("dataset"),
+	}
+	entries, total, err := client.SendCatalogQuery(&query)
+	if err != nil {
+		log.Error("Could not get the catalog : ", err)
+		return
+	}
+	log.Info("Showing ", len(entries), " of ", total, " ciphertexts")
+	for _, entry := range entries {
+		log.Infof("%s %v created %s by %s : %s of %v, degree %d, %d bytes in %d ciphertexts",
+			entry.UUID, entry.Names, entry.Created.Format(time.RFC3339), entry.Owner, entry.Operation, entry.Inputs, entry.Degree, entry.Size, entry.Chunks)
+	}
+}
+
+func runStatus(c *cli.Context) {
+	groupToml := c.String("grouptoml")
+	if groupToml == "" {
+		groupToml = "server.toml"
+		log.Lvl1("Using default grouptoml :", groupToml)
+	}
+	roster, err := parseGroupToml(groupToml)
+	if err != nil {
+		log.ErrFatal(err, "Could not parse group toml file :", groupToml)
+	}
+	id := c.Int("id")
+	client := services.NewLattigoSMCClient(roster.List[id], strconv.Itoa(id))
+
+	status, err := client.GetStatus()
+	if err != nil {
+		log.Error("Could not get the status : ", err)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tPARAMS\tSEED\tPK\tRLK\tROT\tFINGERPRINT\tROTATIONS\tERROR")
+	for _, node := range status.Nodes {
+		params := "-"
+		if node.Setup {
+			params = fmt.Sprintf("N=%d,T=%d #%.8s", 1<<node.LogN, node.T, node.ParamsHash)
+		}
+		seed := "-"
+		if node.Seed != "" {
+			seed = fmt.Sprintf("%.8s", node.Seed)
+		}
+		fingerprint := node.Fingerprint
+		if len(fingerprint) > 16 {
+			fingerprint = fingerprint[:16]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%t\t%s\t%d\t%s\n",
+			node.Server, params, seed, node.PublicKey, node.EvaluationKey, node.RotationKeys, fingerprint, len(node.Rotations), node.Error)
+	}
+	w.Flush()
+	if status.Agree {
+		fmt.Println("All the servers agree on the setup")
+	} else {
+		fmt.Println("The servers do not agree on the setup : ", status.Disagreement)
+	}
+}
+
+func runAnalyst(c *cli.Context) {
+	name := c.String("name")
+	key := c.String("key")
+	params, err := analystParameters(c)
+	if err != nil {
+		log.Error("Could not read the parameters : ", err)
+		return
+	}
+
+	if c.Bool("keygen") {
+		keygen := bfv.NewKeyGenerator(params)
+		sk := keygen.GenSecretKey()
+		err = writeKey(key+".sk", sk)
+		if err == nil {
+			err = writeKey(key+".pk", keygen.GenPublicKey(sk))
+		}
+		var signing *kyberkey.Pair
+		if err == nil {
+			signing, err = services.AnalystSigningKey(sk)
+		}
+		if err == nil {
+			err = writeKey(key+".id", signing.Public)
+		}
+		if err != nil {
+			log.Error("Could not write the key pair : ", err)
+			return
+		}
+		fmt.Println("Key pair written to", key+".sk", "and", key+".pk", "with the signing key in", key+".id")
+	}
+	if decrypt := c.String("decrypt"); decrypt != "" {
+		err = decryptResult(params, key+".sk", decrypt)
+		if err != nil {
+			log.Error("Could not decrypt the result : ", err)
+		}
+		return
+	}
+	if !c.Bool("register") && !c.Bool("approve") && c.String("result") == "" && c.String("download") == "" {
+		return
+	}
+
+	groupToml := c.String("grouptoml")
+	if groupToml == "" {
+		groupToml = "server.toml"
+		log.Lvl1("Using default grouptoml :", groupToml)
+	}
+	roster, err := parseGroupToml(groupToml)
+	if err != nil {
+		log.ErrFatal(err, "Could not parse group toml file :", groupToml)
+	}
+	id := c.Int("id")
+	client := services.NewLattigoSMCClient(roster.List[id], strconv.Itoa(id))
+
+	if c.Bool("register") {
+		pk, signingKey, err := readAnalystKeys(key)
+		if err == nil {
+			err = client.RegisterAnalyst(name, pk, signingKey)
+		}
+		if err != nil {
+			log.Error("Could not register the analyst : ", err)
+			return
+		}
+		fmt.Println("Analyst", name, "registered, waiting for the approval of the members")
+	}
+	if c.Bool("approve") {
+		private, err := loadPrivate(c.String("private"))
+		if err != nil {
+			log.Error("Could not read the private key of the server : ", err)
+			return
+		}
+		pk, signingKey, err := readAnalystKeys(key)
+		if err == nil {
+			err = client.ApproveAnalyst(name, pk, signingKey, private)
+		}
+		if err != nil {
+			log.Error("Could not approve the analyst : ", err)
+			return
+		}
+		fmt.Println("Analyst", name, "approved by", roster.List[id])
+	}
+	if ref := c.String("result"); ref != "" {
+		ctID, err := client.Reference(ref)
+		if err != nil {
+			log.Error("Incorrect id or name :", err)
+			return
+		}
+		noise, err := parseNoise(c.String("noise"))
+		if err != nil {
+			log.Error("Incorrect noise :", err)
+			return
+		}
+		result, err := client.SendNoisyAnalystResultQuery(name, ctID, noise)
+		if err != nil {
+			log.Error("Could not switch the ciphertext to the analyst : ", err)
+			return
+		}
+		fmt.Println("Result for", name, "held at id", result)
+	}
+	if download := c.String("download"); download != "" {
+		resultID, err := uuid.FromString(download)
+		if err != nil {
+			log.Error("Incorrect id :", err)
+			return
+		}
+		signing, err := readSigningKey(key + ".sk")
+		if err != nil {
+			log.Error("Could not read the secret key : ", err)
+			return
+		}
+		ciphertext, descriptor, err := client.DownloadAnalystResult(name, resultID, signing.Private)
+		if err != nil {
+			log.Error("Could not download the result : ", err)
+			return
+		}
+		data, err := network.Marshal(&services.ExportCiphertextReply{UUID: resultID, Ciphertext: ciphertext, Descriptor: descriptor})
+		if err == nil {
+			err = ioutil.WriteFile(c.String("out"), data, 0600)
+		}
+		if err != nil {
+			log.Error("Could not write the result : ", err)
+			return
+		}
+		fmt.Println("Result written to", c.String("out"))
+	}
+}
+
+//analystParameters reads the parameters of the session from the file, or returns the default parameters of the index.
+func analystParameters(c *cli.Context) (*bfv.Parameters, error) {
+	file := c.String("params")
+	if file == "" {
+		idx := c.Int("paramsidx")
+		if idx < 0 || idx >= len(bfv.DefaultParams) {
+			return nil, errors.New("no default parameters at index " + strconv.Itoa(idx))
+		}
+		return bfv.DefaultParams[idx], nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	params := new(bfv.Parameters)
+	err = params.UnmarshalBinary(data)
+	return params, err
+}
+
+//writeKey writes the serialized key to the file, readable only by its owner.
+func writeKey(file string, key interface{ MarshalBinary() ([]byte, error) }) error {
+	data, err := key.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+//readAnalystKeys reads the public key of the analyst in <key>.pk and its signing key in <key>.id.
+func readAnalystKeys(key string) (*bfv.PublicKey, kyber.Point, error) {
+	data, err := ioutil.ReadFile(key + ".pk")
+	if err != nil {
+		return nil, nil, err
+	}
+	pk := new(bfv.PublicKey)
+	err = pk.UnmarshalBinary(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err = ioutil.ReadFile(key + ".id")
+	if err != nil {
+		return nil, nil, err
+	}
+	signingKey := utils.SUITE.Point()
+	err = signingKey.UnmarshalBinary(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pk, signingKey, nil
+}
+
+//readSigningKey derives the signing key of the analyst from its secret key in the file.
+func readSigningKey(skFile string) (*kyberkey.Pair, error) {
+	data, err := ioutil.ReadFile(skFile)
+	if err != nil {
+		return nil, err
+	}
+	sk := new(bfv.SecretKey)
+	err = sk.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return services.AnalystSigningKey(sk)
+}
+
+//decryptResult decrypts the result downloaded in the file with the secret key of the analyst and prints its values.
+func decryptResult(params *bfv.Parameters, skFile, file string) error {
+	data, err := ioutil.ReadFile(skFile)
+	if err != nil {
+		return err
+	}
+	sk := new(bfv.SecretKey)
+	err = sk.UnmarshalBinary(data)
+	if err != nil {
+		return err
+	}
+	data, err = ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	_, msg, err := network.Unmarshal(data, utils.SUITE)
+	if err != nil {
+		return err
+	}
+	result, ok := msg.(*services.ExportCiphertextReply)
+	if !ok {
+		return errors.New(file + " is not a downloaded result")
+	}
+	values, err := services.DecryptAnalystResult(params, sk, result.Ciphertext, result.Descriptor)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Result", result.UUID, ":", values.Text())
+	return nil
+}
+
+//setupRequest returns the setup request of the values parsed from the setup flag, with the privacy budget of the datasets and the sensitivity of their values.
+func setupRequest(roster *onet.Roster, values SetupValues, seed []byte, budget, sensitivity float64) *services.SetupRequest {
+	return &services.SetupRequest{
+		Roster:                *roster,
+		ParamsIdx:             uint64(values.paramsIdx),
+		Seed:                  seed,
+		GeneratePublicKey:     values.genPublicKey,
+		GenerateEvaluationKey: values.genEvalKey,
+		GenerateRotationKey:   values.genRotKey,
+		K:                     values.K,
+		RotIdx:                values.rotIdx,
+		PrivacyBudget:         budget,
+		Sensitivity:           sensitivity,
+	}
+}
+
+//setupWithParameters sends the setup request with the parameters serialized in the file.
+func setupWithParameters(client *services.API, request *services.SetupRequest, paramsFile string) error {
+	data, err := ioutil.ReadFile(paramsFile)
+	if err != nil {
+		return err
+	}
+	params := new(bfv.Parameters)
+	err = params.UnmarshalBinary(data)
+	if err != nil {
+		return err
+	}
+	return client.SendSetupWithParameters(request, params)
+}
+
+//parseNoise parses the differential privacy noise <laplace|gaussian>,<epsilon>,<sensitivity>,<slots>[,<delta>], nil if the flag is empty.
+func parseNoise(s string) (*utils.NoiseParameters, error) {
+	if s == "" {
+		return nil, nil
+	}
+	values := strings.Split(s, ",")
+	if len(values) < 4 {
+		return nil, errors.New("noise format : <laplace|gaussian>,<epsilon>,<sensitivity>,<slots>[,<delta>]")
+	}
+	noise := &utils.NoiseParameters{}
+	switch values[0] {
+	case "laplace":
+		noise.Mechanism = utils.NoiseLaplace
+	case "gaussian":
+		noise.Mechanism = utils.NoiseGaussian
+	default:
+		return nil, errors.New("unknown noise mechanism " + values[0])
+	}
+	var err error
+	if noise.Epsilon, err = strconv.ParseFloat(values[1], 64); err != nil {
+		return nil, err
+	}
+	if noise.Sensitivity, err = strconv.ParseFloat(values[2], 64); err != nil {
+		return nil, err
+	}
+	if noise.Slots, err = strconv.ParseUint(values[3], 10, 64); err != nil {
+		return nil, err
+	}
+	if len(values) > 4 {
+		if noise.Delta, err = strconv.ParseFloat(values[4], 64); err != nil {
+			return nil, err
+		}
+	}
+	return noise, noise.Validate()
+}
+
+func runParams(c *cli.Context) {
+	circuit := utils.Circuit{
+		Depth:         c.Int("depth"),
+		Additions:     c.Int("additions"),
+		PlaintextBits: c.Int("bits"),
+		Parties:       c.Int("parties"),
+		Security:      c.Int("security"),
+	}
+	suggestion, err := utils.SuggestParameters(circuit)
+	if err != nil {
+		log.Error("Could not find parameters : ", err)
+		return
+	}
+	params := suggestion.Params
+	fmt.Printf("LogN %d, T %d, log Q %.1f, log QP %.1f\n", params.LogN, params.T, utils.LogQ(params), utils.LogQP(params))
+	fmt.Printf("Security %d bits, noise budget after the circuit %.1f bits\n", suggestion.Security, suggestion.NoiseBudget)
+	if suggestion.NeedsRefresh {
+		fmt.Printf("The circuit needs %d collective refreshes\n", suggestion.Refreshes)
+	} else {
+		fmt.Println("The circuit does not need any refresh")
+	}
+
+	out := c.String("out")
+	if out != "" {
+		data, err := params.MarshalBinary()
+		if err != nil {
+			log.Error("Could not serialize the parameters : ", err)
+			return
+		}
+		err = ioutil.WriteFile(out, data, 0644)
+		if err != nil {
+			log.Error("Could not write the parameters : ", err)
+			return
+		}
+		fmt.Println("Parameters written to", out, ", use them with run -setup=... -params="+out)
+	}
 }
 
 func parseSetup(s string) SetupValues {
@@ -269,6 +939,19 @@ func parseSetup(s string) SetupValues {
 	return sv
 }
 
+//loadPrivate returns the private key of the server from its private toml.
+func loadPrivate(s string) (kyber.Scalar, error) {
+	config, err := app.LoadCothority(s)
+	if err != nil {
+		return nil, err
+	}
+	si, err := config.GetServerIdentity()
+	if err != nil {
+		return nil, err
+	}
+	return si.GetPrivate(), nil
+}
+
 func parseGroupToml(s string) (*onet.Roster, error) {
 	file, err := os.Open(s)
 	if err != nil {
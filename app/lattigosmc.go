@@ -27,18 +27,80 @@ func main() {
 	clientFlags := []cli.Flag{
 		cli.StringFlag{Name: "write, w", Usage: "Store data <data>"},
 		cli.StringFlag{Name: "type, t", Usage: "What is the type of data stored (string or byte)"},
-		cli.StringFlag{Name: "get, g", Usage: "Get data stored at <UUID>"},
+		cli.StringFlag{Name: "get, g", Usage: "Get data stored at <UUID> or <name>"},
+		cli.StringFlag{Name: "name, n", Usage: "Register the data written under <name>"},
+		cli.StringFlag{Name: "rename", Usage: "Rename a ciphertext : <name>,<newName>"},
+		cli.StringFlag{Name: "alias", Usage: "Add a name to a ciphertext : <name>,<alias>"},
 		cli.StringFlag{Name: "retrievekey", Usage: "Retrieve key with boolean <collkey>,<evalkey>,<rottype>,<rotType>,<K>"},
 		cli.StringFlag{Name: "grouptoml, gt", Usage: "Give the gorup toml"},
 		cli.IntFlag{Name: "id", Usage: "id of the client"},
 		cli.StringFlag{Name: "setup", Usage: "Setup the server <paramsIdx>,<genColKey>,<genEvalKey>,<genRotKey>,<rottype>,<K>"},
+		cli.StringFlag{Name: "params", Usage: "Setup with the parameters serialized in <file> instead of paramsIdx"},
+		cli.Float64Flag{Name: "budget", Usage: "Setup with a privacy budget <epsilon> per dataset for the data decrypted with noise"},
+		cli.Float64Flag{Name: "sensitivity", Usage: "Sensitivity of the values of the datasets, required with -budget"},
+		cli.StringFlag{Name: "noise", Usage: "Get the data with differential privacy noise <laplace|gaussian>,<epsilon>,<sensitivity>,<slots>[,<delta>]"},
+		cli.BoolFlag{Name: "rekey", Usage: "Rotate the collective key and switch the stored ciphertexts to the new key"},
+		cli.IntFlag{Name: "join", Usage: "Add the server <index> of the group toml to the roster", Value: -1},
+		cli.StringFlag{Name: "transfer", Usage: "Move a ciphertext to another collective without decryption, with the noise of -noise : <UUID or name>,<group toml of the other collective>"},
+		cli.IntFlag{Name: "leave", Usage: "Remove the server <index> of the group toml from the roster", Value: -1},
+		cli.IntFlag{Name: "approvejoin", Usage: "Approve the join of the server <index> in the name of the server <id>, signed with the key of -private", Value: -1},
+		cli.IntFlag{Name: "approveleave", Usage: "Approve the leave of the server <index> in the name of the server <id>, signed with the key of -private", Value: -1},
+		cli.StringFlag{Name: "approvetransfer", Usage: "Approve the transfers to the collective of <group toml> in the name of the server <id>, signed with the key of -private"},
+		cli.StringFlag{Name: "private", Usage: "Private toml of the server <id>, to sign its approvals and contributions"},
 
-		cli.StringFlag{Name: "sum ,s", Usage: "Get sum of two ciphers comma separated : <id1>,<id2>"},
+		cli.StringFlag{Name: "sum ,s", Usage: "Get sum of two ciphers comma separated, by id or name : <id1>,<id2>"},
 
-		cli.StringFlag{Name: "multiply ,m", Usage: "Get product of two ciphers comma separeted : <id1>,<id2>"},
+		cli.StringFlag{Name: "multiply ,m", Usage: "Get product of two ciphers comma separeted, by id or name : <id1>,<id2>"},
 		cli.StringFlag{Name: "refresh, ref", Usage: "Refresh a ciphertext with <UUID>"},
 		cli.StringFlag{Name: "relin, rel", Usage: "Relinearize a cipher with <UUID>"},
 		cli.StringFlag{Name: "rotate , rot", Usage: "Rotate a ciphertext format <UUID>,<rotType>,<K>"},
+		cli.StringFlag{Name: "stats", Usage: "Compute a statistic of columns by id or name : <count|sum|sumofsquares|mean|variance|histogram>,<id1>[,<id2>...]"},
+		cli.Uint64Flag{Name: "buckets", Usage: "Number of buckets of the columns of a histogram, a power of two"},
+		cli.StringFlag{Name: "contribute", Usage: "Contribute a column of a local CSV file to a federated dataset, encrypted by the server <id> and signed with the key of -private : <dataset>,<csv file>,<column>,<uint|int|fixed|bool>[,<scale>]"},
+		cli.BoolFlag{Name: "replace", Usage: "Replace the previous contribution of the server <id> with -contribute"},
+		cli.StringFlag{Name: "aggregate", Usage: "Sum the contributions of the members to the federated <dataset>"},
+	}
+
+	catalogFlags := []cli.Flag{
+		cli.StringFlag{Name: "grouptoml, gt", Usage: "Give the gorup toml"},
+		cli.IntFlag{Name: "id", Usage: "id of the client"},
+		cli.StringFlag{Name: "owner", Usage: "Only list the ciphertexts of the server <owner>"},
+		cli.StringFlag{Name: "operation, op", Usage: "Only list the ciphertexts produced by <operation>"},
+		cli.StringFlag{Name: "dataset", Usage: "Only list the contributions to the federated <dataset>"},
+		cli.Uint64Flag{Name: "offset", Usage: "Skip the first <offset> entries"},
+		cli.Uint64Flag{Name: "limit", Usage: "List at most <limit> entries"},
+	}
+
+	statusFlags := []cli.Flag{
+		cli.StringFlag{Name: "grouptoml, gt", Usage: "Give the gorup toml"},
+		cli.IntFlag{Name: "id", Usage: "id of the client"},
+	}
+
+	paramsFlags := []cli.Flag{
+		cli.IntFlag{Name: "depth", Usage: "Multiplicative depth of the circuit"},
+		cli.IntFlag{Name: "additions", Usage: "Number of ciphertexts added together"},
+		cli.IntFlag{Name: "bits", Usage: "Bit size of the plaintext values", Value: 16},
+		cli.IntFlag{Name: "parties", Usage: "Number of parties", Value: 3},
+		cli.IntFlag{Name: "security", Usage: "Minimum security level in bits", Value: 128},
+		cli.StringFlag{Name: "out", Usage: "Write the serialized parameters to <file>"},
+	}
+
+	analystFlags := []cli.Flag{
+		cli.StringFlag{Name: "grouptoml, gt", Usage: "Give the gorup toml"},
+		cli.IntFlag{Name: "id", Usage: "id of the client"},
+		cli.StringFlag{Name: "name, n", Usage: "Name of the analyst"},
+		cli.StringFlag{Name: "key, k", Usage: "Key pair of the analyst in <key>.sk and <key>.pk, with its signing key in <key>.id", Value: "analyst"},
+		cli.StringFlag{Name: "params", Usage: "Parameters of the session serialized in <file>"},
+		cli.IntFlag{Name: "paramsidx", Usage: "Index of the default parameters of the session, if no parameters file is given"},
+		cli.BoolFlag{Name: "keygen", Usage: "Generate the key pair of the analyst"},
+		cli.BoolFlag{Name: "register", Usage: "Register the public key of the analyst"},
+		cli.BoolFlag{Name: "approve", Usage: "Approve the analyst with the public key <key>.pk and the signing key <key>.id in the name of the server <id>, signed with the key of -private"},
+		cli.StringFlag{Name: "private", Usage: "Private toml of the server <id>, to sign the approval"},
+		cli.StringFlag{Name: "result", Usage: "Switch the ciphertext <UUID or name> to the key of the analyst"},
+		cli.StringFlag{Name: "noise", Usage: "Add differential privacy noise to the result <laplace|gaussian>,<epsilon>,<sensitivity>,<slots>[,<delta>]"},
+		cli.StringFlag{Name: "download", Usage: "Download the result <UUID> of the analyst to the file given by -out, signed with the key derived from <key>.sk"},
+		cli.StringFlag{Name: "out", Usage: "File of the downloaded result", Value: "result.bin"},
+		cli.StringFlag{Name: "decrypt", Usage: "Decrypt the downloaded result in <file> with the secret key of the analyst"},
 	}
 
 	serverFlags := []cli.Flag{
@@ -58,6 +120,39 @@ func main() {
 			Flags:   clientFlags,
 		},
 
+		//Catalog of the root
+		{
+			Name:    "catalog",
+			Aliases: []string{"c"},
+			Usage:   "List the ciphertexts stored at the root",
+			Action:  runCatalog,
+			Flags:   catalogFlags,
+		},
+
+		//Status of the setup
+		{
+			Name:   "status",
+			Usage:  "Show the status of the setup of every server",
+			Action: runStatus,
+			Flags:  statusFlags,
+		},
+
+		//Parameters for a circuit
+		{
+			Name:   "params",
+			Usage:  "Suggest parameters for a circuit",
+			Action: runParams,
+			Flags:  paramsFlags,
+		},
+
+		//Decryption delegated to an analyst
+		{
+			Name:   "analyst",
+			Usage:  "Generate the key of an analyst, register and approve it, get and decrypt its results",
+			Action: runAnalyst,
+			Flags:  analystFlags,
+		},
+
 		//Server run
 		{
 			Name:  "server",
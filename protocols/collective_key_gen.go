@@ -7,16 +7,21 @@
 // 3. Send the result of aggregation to the parent ( note the leaf will just send the partial key share and the root nothing )
 // 4. The root generates the public key and sends it to its children
 // 5. Get the public key from the parents and forward to the children
+// In the verifiable mode, the individual shares travel up the tree instead of their aggregation. The root sends all the shares
+// with the public key it generated down the tree, and every node recomputes the key from the shares and the CRP and checks it against the one of the root.
+// Anyone with the shares and the seed of the CRP can recompute the key with RecomputePublicKey.
 
 package protocols
 
 import (
+	"bytes"
 	"errors"
 	"github.com/ldsec/lattigo/bfv"
 	"github.com/ldsec/lattigo/dbfv"
 	"github.com/ldsec/lattigo/ring"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"strconv"
 	"sync"
 )
 
@@ -77,14 +82,45 @@ func (ckgp *CollectiveKeyGenerationProtocol) Dispatch() error {
 		log.ErrFatal(err, "Could not send wake up message ")
 	}
 
+	if ckgp.Verifiable {
+		err = ckgp.dispatchVerifiable()
+		if err != nil {
+			log.Error(ckgp.ServerIdentity(), " could not verify the collective public key : ", err)
+			ckgp.Err = err
+		}
+		ckgp.finish()
+		ckgp.Done()
+		return err
+	}
+
 	//if parent get share from child and aggregate
+	var check shareCheck
 	if !ckgp.IsLeaf() {
 		for i := 0; i < len(ckgp.Children()); i++ {
-			child := <-ckgp.ChannelPublicKeyShares
-			log.Lvl3(ckgp.ServerIdentity(), "Got share from child ")
-			ckgp.AggregateShares(child.CKGShare, ckgp.CKGShare, ckgp.CKGShare)
+			select {
+			case child := <-ckgp.ChannelPublicKeyShares:
+				log.Lvl3(ckgp.ServerIdentity(), "Got share from child ")
+				if err := CheckCKGShare(ckgp.Params, child.CKGShare); err != nil {
+					check.reject(child.TreeNode, err)
+					continue
+				}
+				ckgp.AggregateShares(child.CKGShare, ckgp.CKGShare, ckgp.CKGShare)
+			case report := <-ckgp.ChannelInvalidShares:
+				check.add(report.InvalidShares)
+			}
+		}
+	}
 
+	//report the invalid shares to the parent instead of the share.
+	if check.failed() {
+		ckgp.Err = check.err()
+		err = ckgp.SendToParent(check.report())
+		ckgp.finish()
+		ckgp.Done()
+		if err != nil {
+			return err
 		}
+		return ckgp.Err
 	}
 
 	//send to parent
@@ -99,17 +135,123 @@ func (ckgp *CollectiveKeyGenerationProtocol) Dispatch() error {
 	}
 
 	log.Lvl2(ckgp.ServerIdentity(), "completed Collective Public Key Generation protocol ")
-	ckgp.Cond.Broadcast()
+	ckgp.finish()
 
 	ckgp.Done()
 
 	return nil
 }
 
-//Wait blocks until the dispatch is finished
+//dispatchVerifiable publishes the share of every node to all the nodes and checks the public key announced by the root against them.
+func (ckgp *CollectiveKeyGenerationProtocol) dispatchVerifiable() error {
+	index := ckgp.TreeNode().RosterIndex
+	size := len(ckgp.Roster().List)
+	own, err := ckgp.CKGShare.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	shares := make([][]byte, size)
+	shares[index] = own
+	for i := 0; i < len(ckgp.Children()); i++ {
+		child := <-ckgp.ChannelShares
+		merge(shares, child.Shares)
+	}
+
+	var announced []byte
+	if ckgp.IsRoot() {
+		if err = complete(shares, size); err != nil {
+			return err
+		}
+		pk, err := RecomputePublicKey(ckgp.Params, ckgp.CKG1, shares)
+		if err != nil {
+			return err
+		}
+		announced, err = pk.MarshalBinary()
+		if err != nil {
+			return err
+		}
+	} else {
+		err = ckgp.SendToParent(&PublicKeyShares{Shares: shares})
+		if err != nil {
+			return err
+		}
+		transcript := <-ckgp.ChannelTranscript
+		shares = transcript.Shares
+		announced = transcript.PublicKey
+	}
+	err = ckgp.SendToChildren(&PublicKeyTranscript{Shares: shares, PublicKey: announced})
+	if err != nil {
+		return err
+	}
+
+	//every node checks the key announced by the root, including the root itself.
+	if err = complete(shares, size); err != nil {
+		return err
+	}
+	if !bytes.Equal(shares[index], own) {
+		return errors.New("the share of the node has been altered")
+	}
+	pk, err := RecomputePublicKey(ckgp.Params, ckgp.CKG1, shares)
+	if err != nil {
+		return err
+	}
+	data, err := pk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, announced) {
+		return errors.New("the public key announced by the root does not match the shares")
+	}
+	ckgp.Pk = pk
+	ckgp.Shares = shares
+	return nil
+}
+
+//RecomputePublicKey returns the collective public key generated from the serialized shares of all the parties and the CRP.
+func RecomputePublicKey(params *bfv.Parameters, crp *ring.Poly, shares [][]byte) (*bfv.PublicKey, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares")
+	}
+	ckg := dbfv.NewCKGProtocol(params)
+	aggregate := ckg.AllocateShares()
+	share := ckg.AllocateShares()
+	//the decoder of lattigo trusts the sizes written in the data and panics on a share of the wrong size.
+	empty, err := share.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	for i, data := range shares {
+		if len(data) != len(empty) {
+			return nil, errors.New("invalid share " + strconv.Itoa(i) + " : size " + strconv.Itoa(len(data)) + " instead of " + strconv.Itoa(len(empty)))
+		}
+		if err := share.UnmarshalBinary(data); err != nil {
+			return nil, errors.New("could not read share " + strconv.Itoa(i) + " : " + err.Error())
+		}
+		if err := CheckCKGShare(params, share); err != nil {
+			return nil, errors.New("invalid share " + strconv.Itoa(i) + " : " + err.Error())
+		}
+		ckg.AggregateShares(share, aggregate, aggregate)
+	}
+	pk := bfv.NewPublicKey(params)
+	ckg.GenPublicKey(aggregate, crp, pk)
+	return pk, nil
+}
+
+//finish marks the dispatch as finished and wakes up the callers of Wait.
+func (ckgp *CollectiveKeyGenerationProtocol) finish() {
+	ckgp.Cond.L.Lock()
+	ckgp.finished = true
+	ckgp.Cond.L.Unlock()
+	ckgp.Cond.Broadcast()
+}
+
+//Wait blocks until the dispatch is finished. It returns at once if the dispatch finished before it was called.
 func (ckgp *CollectiveKeyGenerationProtocol) Wait() {
 	ckgp.Cond.L.Lock()
-	ckgp.Cond.Wait()
+	for !ckgp.finished {
+		ckgp.Cond.Wait()
+	}
 	ckgp.Cond.L.Unlock()
 }
 
@@ -123,7 +265,7 @@ func NewCollectiveKeyGeneration(n *onet.TreeNodeInstance) (onet.ProtocolInstance
 		Initialized:      make(chan bool),
 	}
 
-	if e := p.RegisterChannels(&p.ChannelPublicKeyShares, &p.ChannelPublicKey, &p.ChannelStart); e != nil {
+	if e := p.RegisterChannels(&p.ChannelPublicKeyShares, &p.ChannelPublicKey, &p.ChannelShares, &p.ChannelTranscript, &p.ChannelInvalidShares, &p.ChannelStart); e != nil {
 		return nil, errors.New("Could not register channel: " + e.Error())
 	}
 
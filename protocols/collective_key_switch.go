@@ -52,7 +52,7 @@ func NewCollectiveKeySwitching(n *onet.TreeNodeInstance) (onet.ProtocolInstance,
 		Cond:             sync.NewCond(&sync.Mutex{}),
 	}
 
-	if e := p.RegisterChannels(&p.ChannelCKSShare, &p.ChannelCiphertext, &p.ChannelStart); e != nil {
+	if e := p.RegisterChannels(&p.ChannelCKSShare, &p.ChannelCiphertext, &p.ChannelInvalidShares, &p.ChannelStart); e != nil {
 		return nil, errors.New("Could not register channel: " + e.Error())
 	}
 
@@ -81,20 +81,41 @@ func (cks *CollectiveKeySwitchingProtocol) Dispatch() error {
 
 	//start the key switching
 
+	var check shareCheck
 	if !cks.IsLeaf() {
 
 		for i := 0; i < len(cks.Children()); i++ {
-			child := <-cks.ChannelCKSShare
-			log.Lvl4(cks.ServerIdentity(), " : aggregating !  ")
-
-			//aggregate
-			share := child.CKSShare
-			cks.CKSProtocol.AggregateShares(share, cks.CKSShare, cks.CKSShare)
+			select {
+			case child := <-cks.ChannelCKSShare:
+				log.Lvl4(cks.ServerIdentity(), " : aggregating !  ")
+				if err := CheckCKSShare(cks.Params.Params, child.CKSShare); err != nil {
+					check.reject(child.TreeNode, err)
+					continue
+				}
+
+				//aggregate
+				share := child.CKSShare
+				cks.CKSProtocol.AggregateShares(share, cks.CKSShare, cks.CKSShare)
+			case report := <-cks.ChannelInvalidShares:
+				check.add(report.InvalidShares)
+			}
 
 		}
 
 	}
 
+	//report the invalid shares to the parent instead of the share.
+	if check.failed() {
+		cks.Err = check.err()
+		err = cks.SendToParent(check.report())
+		cks.Cond.Broadcast()
+		cks.Done()
+		if err != nil {
+			return err
+		}
+		return cks.Err
+	}
+
 	//send to parent.
 	err = cks.SendToParent(cks.CKSShare)
 	if err != nil {
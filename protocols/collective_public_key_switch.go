@@ -40,6 +40,20 @@ func (pcks *CollectivePublicKeySwitchingProtocol) Init(params bfv.Parameters, pu
 
 }
 
+//AddPlaintext adds the plaintext to the share of the node, so it is added to the result of the key switching. The share masks the plaintext,
+//the other nodes do not learn it. Used to add a share of the noise of the differential privacy. Should be done after Init and before dispatching.
+func (pcks *CollectivePublicKeySwitchingProtocol) AddPlaintext(pt *bfv.Plaintext) {
+	//the trivial encryption (pt, 0) scales the plaintext to the ciphertext modulus.
+	trivial := bfv.NewCiphertext(&pcks.Params, 1)
+	bfv.NewEvaluator(&pcks.Params).Add(trivial, pt, trivial)
+	share := pcks.PCKSShare[0]
+	for i, qi := range pcks.Params.Moduli.Qi {
+		for j, c := range trivial.Value()[0].Coeffs[i] {
+			share.Coeffs[i][j] = (share.Coeffs[i][j] + c) % qi
+		}
+	}
+}
+
 //NewCollectivePublicKeySwitching initialize a new protocol, register the channels for onet.
 func NewCollectivePublicKeySwitching(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 
@@ -48,7 +62,7 @@ func NewCollectivePublicKeySwitching(n *onet.TreeNodeInstance) (onet.ProtocolIns
 		Cond:             sync.NewCond(&sync.Mutex{}),
 	}
 
-	if e := p.RegisterChannels(&p.ChannelStart, &p.ChannelCiphertext, &p.ChannelPCKS); e != nil {
+	if e := p.RegisterChannels(&p.ChannelStart, &p.ChannelCiphertext, &p.ChannelPCKS, &p.ChannelInvalidShares); e != nil {
 		return nil, errors.New("Could not register channel: " + e.Error())
 	}
 
@@ -72,11 +86,32 @@ func (pcks *CollectivePublicKeySwitchingProtocol) Dispatch() error {
 		return err
 	}
 
+	var check shareCheck
 	for range pcks.Children() {
 		log.Lvl3("Getting a child PCKSShare")
-		children := (<-pcks.ChannelPCKS).PCKSShare
-		pcks.PublicKeySwitchProtocol.AggregateShares(children, pcks.PCKSShare, pcks.PCKSShare)
+		select {
+		case child := <-pcks.ChannelPCKS:
+			if err := CheckPCKSShare(&pcks.Params, child.PCKSShare); err != nil {
+				check.reject(child.TreeNode, err)
+				continue
+			}
+			pcks.PublicKeySwitchProtocol.AggregateShares(child.PCKSShare, pcks.PCKSShare, pcks.PCKSShare)
+		case report := <-pcks.ChannelInvalidShares:
+			check.add(report.InvalidShares)
+		}
+
+	}
 
+	//report the invalid shares to the parent instead of the share.
+	if check.failed() {
+		pcks.Err = check.err()
+		err = pcks.SendToParent(check.report())
+		pcks.Cond.Broadcast()
+		pcks.Done()
+		if err != nil {
+			return err
+		}
+		return pcks.Err
 	}
 
 	//send the share to the parent..
@@ -8,5 +8,7 @@
 //	- switch the key under which a ciphertext is encrypted to a different public key ( collective_public_key_switch )
 //	- refresh a ciphertext to remove the noise
 //	- generate a rotation key that can be used to perform a rotation on the plaintext vector without leaking plaintext.
+//	- agree on the seed of the common reference polynomials with a commit-then-reveal of random contributions ( seed_agreement )
+// The shares received from the children are checked against the parameters before they are aggregated ( validation ), the invalid ones are reported to the root with the tree node that sent them.
 // The nodes are generated in a tree like fashion and the message passing is done with onet.
 package protocols
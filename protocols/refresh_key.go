@@ -46,7 +46,7 @@ func NewCollectiveRefresh(n *onet.TreeNodeInstance) (onet.ProtocolInstance, erro
 		Cond:             sync.NewCond(&sync.Mutex{}),
 	}
 
-	if e := p.RegisterChannels(&p.ChannelCiphertext, &p.ChannelRShare, &p.ChannelStart); e != nil {
+	if e := p.RegisterChannels(&p.ChannelCiphertext, &p.ChannelRShare, &p.ChannelInvalidShares, &p.ChannelStart); e != nil {
 		return nil, errors.New("Could not register channel: " + e.Error())
 	}
 
@@ -76,14 +76,34 @@ func (rkp *RefreshProtocol) Dispatch() error {
 	//Set up the parameters - context and the crp
 
 	//if parent get share from child and aggregate
+	var check shareCheck
 	if !rkp.IsLeaf() {
 		for i := 0; i < len(rkp.Children()); i++ {
-			child := <-rkp.ChannelRShare
-			rkp.RefreshProto.Aggregate(child.RefreshShare, rkp.RShare, rkp.RShare)
+			select {
+			case child := <-rkp.ChannelRShare:
+				if err := CheckRefreshShare(&rkp.Params, child.RefreshShare); err != nil {
+					check.reject(child.TreeNode, err)
+					continue
+				}
+				rkp.RefreshProto.Aggregate(child.RefreshShare, rkp.RShare, rkp.RShare)
+			case report := <-rkp.ChannelInvalidShares:
+				check.add(report.InvalidShares)
+			}
 
 		}
 	}
 
+	//report the invalid shares to the parent instead of the share.
+	if check.failed() {
+		rkp.Err = check.err()
+		err = rkp.SendToParent(check.report())
+		rkp.Done()
+		if err != nil {
+			return err
+		}
+		return rkp.Err
+	}
+
 	//send to parent
 	err = rkp.SendToParent(&rkp.RShare)
 
@@ -9,6 +9,8 @@
 // 8. Get result of round 2 from parent
 // 9. Same as 5-6-7-8 for round 3 shares
 // 10. With shares of round 2 and 3 - generate the relinearization key.
+// The shares received are checked in every round. The invalid ones are reported up to the root, which sends the report down the tree to abort
+// the protocol. At the end the root sends an empty report to confirm that the key was generated.
 
 package protocols
 
@@ -51,7 +53,7 @@ func NewRelinearizationKey(n *onet.TreeNodeInstance) (instance onet.ProtocolInst
 		Cond:             sync.NewCond(&sync.Mutex{}),
 	}
 
-	if e := p.RegisterChannels(&p.ChannelStart, &p.ChannelRoundOne, &p.ChannelRoundTwo, &p.ChannelRoundThree, &p.ChannelEvalKey); e != nil {
+	if e := p.RegisterChannels(&p.ChannelStart, &p.ChannelRoundOne, &p.ChannelRoundTwo, &p.ChannelRoundThree, &p.ChannelEvalKey, &p.ChannelInvalidShares); e != nil {
 		return nil, errors.New("Could not register channel: " + e.Error())
 	}
 
@@ -77,14 +79,27 @@ func (rlp *RelinearizationKeyProtocol) Dispatch() error {
 	}
 	//get the parameters..
 	log.Lvl1(rlp.ServerIdentity(), " : starting relin key ")
+	count := len(rlp.Crp.A)
 
 	//aggregate the shares.
+	var check shareCheck
 	if !rlp.IsLeaf() {
 		for range rlp.Children() {
-			h0 := (<-rlp.ChannelRoundOne).RKGShareRoundOne
-			rlp.RelinProto.AggregateShareRoundOne(h0, rlp.RoundOneShare, rlp.RoundOneShare)
+			select {
+			case child := <-rlp.ChannelRoundOne:
+				if err := CheckRKGShareRoundOne(&rlp.Params, child.RKGShareRoundOne, count); err != nil {
+					check.reject(child.TreeNode, err)
+					continue
+				}
+				rlp.RelinProto.AggregateShareRoundOne(child.RKGShareRoundOne, rlp.RoundOneShare, rlp.RoundOneShare)
+			case report := <-rlp.ChannelInvalidShares:
+				check.add(report.InvalidShares)
+			}
 		}
 	}
+	if check.failed() {
+		return rlp.stop(conclude(rlp.TreeNodeInstance, rlp.ChannelInvalidShares, &check))
+	}
 
 	//send to parent
 	err = rlp.SendToParent(&rlp.RoundOneShare)
@@ -93,8 +108,18 @@ func (rlp *RelinearizationKeyProtocol) Dispatch() error {
 	}
 
 	if !rlp.IsRoot() {
-		rlp.RoundOneShare = (<-rlp.ChannelRoundOne).RKGShareRoundOne
-
+		select {
+		case parent := <-rlp.ChannelRoundOne:
+			if err := CheckRKGShareRoundOne(&rlp.Params, parent.RKGShareRoundOne, count); err != nil {
+				check.reject(parent.TreeNode, err)
+				return rlp.stop(conclude(rlp.TreeNodeInstance, rlp.ChannelInvalidShares, &check))
+			}
+			rlp.RoundOneShare = parent.RKGShareRoundOne
+		case report := <-rlp.ChannelInvalidShares:
+			//the root aborts the protocol.
+			_ = rlp.SendToChildren(&report.InvalidShares)
+			return rlp.stop(report.err())
+		}
 	}
 	_ = rlp.SendToChildren(&rlp.RoundOneShare)
 	log.Lvl3(rlp.ServerIdentity().String(), ": round 1 share finished")
@@ -103,10 +128,21 @@ func (rlp *RelinearizationKeyProtocol) Dispatch() error {
 	rlp.RelinProto.GenShareRoundTwo(rlp.RoundOneShare, rlp.Sk.Get(), rlp.Crp.A, rlp.RoundTwoShare)
 	if !rlp.IsLeaf() {
 		for range rlp.Children() {
-			h0 := (<-rlp.ChannelRoundTwo).RKGShareRoundTwo
-			rlp.RelinProto.AggregateShareRoundTwo(h0, rlp.RoundTwoShare, rlp.RoundTwoShare)
+			select {
+			case child := <-rlp.ChannelRoundTwo:
+				if err := CheckRKGShareRoundTwo(&rlp.Params, child.RKGShareRoundTwo, count); err != nil {
+					check.reject(child.TreeNode, err)
+					continue
+				}
+				rlp.RelinProto.AggregateShareRoundTwo(child.RKGShareRoundTwo, rlp.RoundTwoShare, rlp.RoundTwoShare)
+			case report := <-rlp.ChannelInvalidShares:
+				check.add(report.InvalidShares)
+			}
 		}
 	}
+	if check.failed() {
+		return rlp.stop(conclude(rlp.TreeNodeInstance, rlp.ChannelInvalidShares, &check))
+	}
 
 	//send to parent
 	err = rlp.SendToParent(&rlp.RoundTwoShare)
@@ -115,9 +151,18 @@ func (rlp *RelinearizationKeyProtocol) Dispatch() error {
 	}
 
 	if !rlp.IsRoot() {
-
-		rlp.RoundTwoShare = (<-rlp.ChannelRoundTwo).RKGShareRoundTwo
-
+		select {
+		case parent := <-rlp.ChannelRoundTwo:
+			if err := CheckRKGShareRoundTwo(&rlp.Params, parent.RKGShareRoundTwo, count); err != nil {
+				check.reject(parent.TreeNode, err)
+				return rlp.stop(conclude(rlp.TreeNodeInstance, rlp.ChannelInvalidShares, &check))
+			}
+			rlp.RoundTwoShare = parent.RKGShareRoundTwo
+		case report := <-rlp.ChannelInvalidShares:
+			//the root aborts the protocol.
+			_ = rlp.SendToChildren(&report.InvalidShares)
+			return rlp.stop(report.err())
+		}
 	}
 
 	_ = rlp.SendToChildren(&rlp.RoundTwoShare)
@@ -127,11 +172,23 @@ func (rlp *RelinearizationKeyProtocol) Dispatch() error {
 
 	if !rlp.IsLeaf() {
 		for range rlp.Children() {
-			h0 := (<-rlp.ChannelRoundThree).RKGShareRoundThree
-			rlp.RelinProto.AggregateShareRoundThree(h0, rlp.RoundThreeShare, rlp.RoundThreeShare)
+			select {
+			case child := <-rlp.ChannelRoundThree:
+				if err := CheckRKGShareRoundThree(&rlp.Params, child.RKGShareRoundThree, count); err != nil {
+					check.reject(child.TreeNode, err)
+					continue
+				}
+				rlp.RelinProto.AggregateShareRoundThree(child.RKGShareRoundThree, rlp.RoundThreeShare, rlp.RoundThreeShare)
+			case report := <-rlp.ChannelInvalidShares:
+				check.add(report.InvalidShares)
+			}
 		}
 	}
 
+	if check.failed() {
+		return rlp.stop(conclude(rlp.TreeNodeInstance, rlp.ChannelInvalidShares, &check))
+	}
+
 	_ = rlp.SendToParent(&rlp.RoundThreeShare)
 	//now we can generate key.
 	log.Lvl3(rlp.ServerIdentity(), ": generating the relin key ! ")
@@ -140,11 +197,18 @@ func (rlp *RelinearizationKeyProtocol) Dispatch() error {
 		rlp.RelinProto.GenRelinearizationKey(rlp.RoundTwoShare, rlp.RoundThreeShare, rlp.EvaluationKey)
 	}
 
-	rlp.Done()
+	//the nodes wait for the root to know if the key was generated.
+	err = rlp.stop(conclude(rlp.TreeNodeInstance, rlp.ChannelInvalidShares, &check))
+	log.Lvl3(rlp.ServerIdentity(), " : exiting dispatch ")
+	return err
+}
 
+//stop ends the protocol with the outcome err.
+func (rlp *RelinearizationKeyProtocol) stop(err error) error {
+	rlp.Err = err
+	rlp.Done()
 	rlp.Cond.Broadcast()
-	log.Lvl3(rlp.ServerIdentity(), " : exiting dispatch ")
-	return nil
+	return err
 }
 
 //Wait blocks until the protocol completes.
@@ -43,7 +43,7 @@ func NewRotationKey(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
 		TreeNodeInstance: n,
 		Cond:             sync.NewCond(&sync.Mutex{}),
 	}
-	if e := p.RegisterChannels(&p.ChannelStart, &p.ChannelRTShare); e != nil {
+	if e := p.RegisterChannels(&p.ChannelStart, &p.ChannelRTShare, &p.ChannelInvalidShares); e != nil {
 		return nil, errors.New("Could not register channel : " + e.Error())
 	}
 
@@ -65,13 +65,27 @@ func (rkp *RotationKeyProtocol) Dispatch() error {
 	}
 
 	log.Lvl2(rkp.ServerIdentity(), "Starting rotation key protocol")
+	var check shareCheck
 	if !rkp.IsLeaf() {
 		for range rkp.Children() {
-			share := (<-rkp.ChannelRTShare).RTGShare
-			rkp.RotationProtocol.Aggregate(rkp.RTShare, share, rkp.RTShare)
+			select {
+			case child := <-rkp.ChannelRTShare:
+				if err := CheckRTGShare(&rkp.Params, child.RTGShare, rkp.RTShare.Type, rkp.RTShare.K, len(rkp.Crp)); err != nil {
+					check.reject(child.TreeNode, err)
+					continue
+				}
+				rkp.RotationProtocol.Aggregate(rkp.RTShare, child.RTGShare, rkp.RTShare)
+			case report := <-rkp.ChannelInvalidShares:
+				check.add(report.InvalidShares)
+			}
 		}
 	}
 
+	//report the invalid shares to the parent instead of the share, the root aborts the protocol.
+	if check.failed() {
+		return rkp.stop(conclude(rkp.TreeNodeInstance, rkp.ChannelInvalidShares, &check))
+	}
+
 	//send share to parent
 	err = rkp.SendToParent(&rkp.RTShare)
 	if err != nil {
@@ -84,12 +98,19 @@ func (rkp *RotationKeyProtocol) Dispatch() error {
 		rkp.RotationProtocol.Finalize(rkp.RTShare, rkp.Crp, &rkp.RotKey)
 	}
 
+	//the nodes wait for the root to know if the key was generated.
+	err = rkp.stop(conclude(rkp.TreeNodeInstance, rkp.ChannelInvalidShares, &check))
 	log.Lvl2("Rotation protocol done. ")
+	return err
+
+}
 
+//stop ends the protocol with the outcome err.
+func (rkp *RotationKeyProtocol) stop(err error) error {
+	rkp.Err = err
 	rkp.Done()
 	rkp.Cond.Broadcast()
-	return nil
-
+	return err
 }
 
 //Wait blocks until the protocol completes
@@ -0,0 +1,231 @@
+// Seed agreement : the nodes agree on the seed of the common reference polynomials ( CRP ) so no single party can choose it.
+// Every node contributes randomness with a commit-then-reveal scheme. The protocol has the following steps :
+// 0. Set-up : every node samples its random contribution and commits to it with its hash
+// 1. Aggregate the commitments of the children and send them to the parent
+// 2. The root sends all the commitments down the tree, so every node knows them before any contribution is revealed
+// 3. Aggregate the contributions of the children and send them to the parent
+// 4. The root sends all the contributions down the tree
+// 5. Every node checks the contributions against the commitments. The seed is the hash of the contributions in the order of the roster.
+// 6. Every node sets the seed ( see SetSeed ) and acknowledges it to its parent once its children did, so the root finishes once all the nodes use the seed.
+// A node that does not reveal its contribution makes the protocol fail, it can not bias the seed.
+
+package protocols
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"strconv"
+	"sync"
+)
+
+//SeedAgreementProtocolName name of protocol for onet
+const SeedAgreementProtocolName = "SeedAgreement"
+
+//SeedContributionSize size in bytes of the random contribution of each node.
+const SeedContributionSize = 32
+
+func init() {
+
+	if _, err := onet.GlobalProtocolRegister(SeedAgreementProtocolName, NewSeedAgreement); err != nil {
+		log.ErrFatal(err, "Could not register SeedAgreement protocol : ")
+	}
+
+}
+
+//Init initialize the contribution of the node. A random contribution is sampled if contribution is nil. Should be done before dispatching
+func (sap *SeedAgreementProtocol) Init(contribution []byte) error {
+	if contribution == nil {
+		contribution = make([]byte, SeedContributionSize)
+		if _, err := rand.Read(contribution); err != nil {
+			return err
+		}
+	}
+	sap.Contribution = contribution
+	commitment := sha256.Sum256(contribution)
+	sap.Commitment = commitment[:]
+	return nil
+}
+
+/****************ONET HANDLERS ******************/
+
+//Start starts the protocol only at root
+func (sap *SeedAgreementProtocol) Start() error {
+	log.Lvl2(sap.ServerIdentity(), "Started Seed Agreement protocol")
+
+	return nil
+}
+
+//Dispatch is called at each node to then run the protocol
+func (sap *SeedAgreementProtocol) Dispatch() error {
+	log.Lvl3(sap.ServerIdentity(), " Dispatching ; is root = ", sap.IsRoot())
+
+	err := sap.dispatch()
+	if err != nil {
+		log.Error(sap.ServerIdentity(), " seed agreement failed : ", err)
+		sap.Err = err
+	} else {
+		log.Lvl2(sap.ServerIdentity(), "completed Seed Agreement protocol ")
+	}
+	sap.finish()
+
+	sap.Done()
+
+	return err
+}
+
+func (sap *SeedAgreementProtocol) dispatch() error {
+	//When running a simulation we need to send a wake up message to the children so all nodes can run!
+	err := sap.SendToChildren(&Start{})
+	if err != nil {
+		return err
+	}
+
+	index := sap.TreeNode().RosterIndex
+	size := len(sap.Roster().List)
+
+	//Commit phase
+	commitments := make([][]byte, size)
+	commitments[index] = sap.Commitment
+	for i := 0; i < len(sap.Children()); i++ {
+		child := <-sap.ChannelCommitments
+		merge(commitments, child.Commitments)
+	}
+	if !sap.IsRoot() {
+		err = sap.SendToParent(&SeedCommitments{Commitments: commitments})
+		if err != nil {
+			return err
+		}
+		commitments = (<-sap.ChannelCommitmentList).Commitments
+	}
+	if err = complete(commitments, size); err != nil {
+		return err
+	}
+	if !bytes.Equal(commitments[index], sap.Commitment) {
+		return errors.New("the commitment of the node has been altered")
+	}
+	err = sap.SendToChildren(&SeedCommitmentList{Commitments: commitments})
+	if err != nil {
+		return err
+	}
+
+	//Reveal phase
+	contributions := make([][]byte, size)
+	contributions[index] = sap.Contribution
+	for i := 0; i < len(sap.Children()); i++ {
+		child := <-sap.ChannelContributions
+		merge(contributions, child.Contributions)
+	}
+	if !sap.IsRoot() {
+		err = sap.SendToParent(&SeedContributions{Contributions: contributions})
+		if err != nil {
+			return err
+		}
+		contributions = (<-sap.ChannelContributionList).Contributions
+	}
+	err = sap.SendToChildren(&SeedContributionList{Contributions: contributions})
+	if err != nil {
+		return err
+	}
+
+	err = sap.agree(commitments, contributions, size)
+
+	//Acknowledgement phase, the failures of the nodes are reported to the root.
+	ack := SeedAck{}
+	if err != nil {
+		ack.Error = err.Error()
+	}
+	for i := 0; i < len(sap.Children()); i++ {
+		child := <-sap.ChannelSeedAcks
+		if ack.Error == "" {
+			ack.Error = child.Error
+		}
+	}
+	if !sap.IsRoot() {
+		if sendErr := sap.SendToParent(&ack); sendErr != nil && err == nil {
+			err = sendErr
+		}
+	}
+	if err == nil && ack.Error != "" {
+		err = errors.New(ack.Error)
+	}
+	return err
+}
+
+//agree checks the contributions against the commitments, computes the seed and sets it.
+func (sap *SeedAgreementProtocol) agree(commitments, contributions [][]byte, size int) error {
+	if err := complete(contributions, size); err != nil {
+		return err
+	}
+	seed := sha256.New()
+	for i, contribution := range contributions {
+		commitment := sha256.Sum256(contribution)
+		if !bytes.Equal(commitment[:], commitments[i]) {
+			return errors.New("contribution of node " + strconv.Itoa(i) + " does not match its commitment")
+		}
+		seed.Write(contribution)
+	}
+	sap.Seed = seed.Sum(nil)
+	if sap.SetSeed != nil {
+		sap.SetSeed(sap.Seed)
+	}
+	return nil
+}
+
+//merge copies the values received from a child into the values indexed by the roster.
+func merge(values, received [][]byte) {
+	for i, value := range received {
+		if i < len(values) && len(value) > 0 {
+			values[i] = value
+		}
+	}
+}
+
+//complete returns an error if a node of the roster did not send its value.
+func complete(values [][]byte, size int) error {
+	if len(values) != size {
+		return errors.New("received " + strconv.Itoa(len(values)) + " values for " + strconv.Itoa(size) + " nodes")
+	}
+	for i, value := range values {
+		if len(value) == 0 {
+			return errors.New("node " + strconv.Itoa(i) + " did not send its value")
+		}
+	}
+	return nil
+}
+
+//finish marks the dispatch as finished and wakes up the callers of Wait.
+func (sap *SeedAgreementProtocol) finish() {
+	sap.Cond.L.Lock()
+	sap.finished = true
+	sap.Cond.L.Unlock()
+	sap.Cond.Broadcast()
+}
+
+//Wait blocks until the dispatch is finished. It returns at once if the dispatch finished before it was called.
+func (sap *SeedAgreementProtocol) Wait() {
+	sap.Cond.L.Lock()
+	for !sap.finished {
+		sap.Cond.Wait()
+	}
+	sap.Cond.L.Unlock()
+}
+
+//NewSeedAgreement is called when a new protocol is started. Will initialize the channels used to communicate between the nodes.
+func NewSeedAgreement(n *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl1("NewSeedAgreement called")
+
+	p := &SeedAgreementProtocol{
+		TreeNodeInstance: n,
+		Cond:             sync.NewCond(&sync.Mutex{}),
+	}
+
+	if e := p.RegisterChannels(&p.ChannelCommitments, &p.ChannelCommitmentList, &p.ChannelContributions, &p.ChannelContributionList, &p.ChannelSeedAcks, &p.ChannelStart); e != nil {
+		return nil, errors.New("Could not register channel: " + e.Error())
+	}
+
+	return p, nil
+}
@@ -30,12 +30,27 @@ type CollectiveKeyGenerationProtocol struct {
 	//Public key generated in the protocol
 	Pk *bfv.PublicKey
 
+	//Verifiable publishes the share of every node to all the nodes so they check the public key generated by the root.
+	Verifiable bool
+	//Shares serialized shares of all the nodes indexed by the roster, set in the verifiable mode.
+	Shares [][]byte
+	//Err set if the public key announced by the root does not match the shares, or if a share is invalid.
+	Err error
+	//finished set once the dispatch is finished, so Wait does not miss the end of a dispatch that finished before it was called.
+	finished bool
+
 	Initialized chan bool
 
 	//ChannelPublicKeyShares to send the public key shares
 	ChannelPublicKeyShares chan StructPublicKeyShare
 	//ChannelPublicKey send the key at the end.
 	ChannelPublicKey chan StructPublicKey
+	//ChannelShares to send the individual shares in the verifiable mode
+	ChannelShares chan StructPublicKeyShares
+	//ChannelTranscript to send all the shares and the public key in the verifiable mode
+	ChannelTranscript chan StructPublicKeyTranscript
+	//ChannelInvalidShares to report the invalid shares of the subtree
+	ChannelInvalidShares chan StructInvalidShares
 	//ChannelStart to get the wake up
 	ChannelStart chan StructStart
 }
@@ -54,6 +69,10 @@ type CollectiveKeySwitchingProtocol struct {
 	ChannelCiphertext chan StructCiphertext
 	//ChannelCKSShare to forward the CKSS share
 	ChannelCKSShare chan StructCKSShare
+	//ChannelInvalidShares to report the invalid shares of the subtree
+	ChannelInvalidShares chan StructInvalidShares
+	//Err set if a share is invalid
+	Err error
 
 	//ChannelStart to wake up
 	ChannelStart chan StructStart
@@ -82,6 +101,10 @@ type CollectivePublicKeySwitchingProtocol struct {
 	ChannelCiphertext chan StructCiphertext
 	//ChannelPCKS to forward the shares.
 	ChannelPCKS chan StructPCKS
+	//ChannelInvalidShares to report the invalid shares of the subtree
+	ChannelInvalidShares chan StructInvalidShares
+	//Err set if a share is invalid
+	Err error
 	//ChannelStart to wake up
 	ChannelStart chan StructStart
 }
@@ -113,6 +136,10 @@ type RelinearizationKeyProtocol struct {
 
 	//ChannelEvalKey These are used for testing.
 	ChannelEvalKey chan StructEvalKey
+	//ChannelInvalidShares to report the invalid shares of the subtree, or to abort from the root
+	ChannelInvalidShares chan StructInvalidShares
+	//Err set if a share is invalid
+	Err error
 
 	//Chan to wake up nodes
 	ChannelStart chan StructStart
@@ -133,9 +160,12 @@ type RefreshProtocol struct {
 
 	RefreshProto *dbfv.RefreshProtocol
 
-	ChannelCiphertext chan StructCiphertext
-	ChannelRShare     chan StructRShare
-	ChannelStart      chan StructStart
+	ChannelCiphertext    chan StructCiphertext
+	ChannelRShare        chan StructRShare
+	ChannelInvalidShares chan StructInvalidShares
+	ChannelStart         chan StructStart
+	//Err set if a share is invalid
+	Err error
 }
 
 //RotationKeyProtocol handler for onet for the rotaiton key protocol
@@ -150,8 +180,42 @@ type RotationKeyProtocol struct {
 
 	Crp []*ring.Poly
 
-	ChannelRTShare chan StructRTGShare
-	ChannelStart   chan StructStart
+	ChannelRTShare       chan StructRTGShare
+	ChannelInvalidShares chan StructInvalidShares
+	ChannelStart         chan StructStart
+	//Err set if a share is invalid
+	Err error
+}
+
+//SeedAgreementProtocol handler for onet for the agreement on the seed of the CRP
+type SeedAgreementProtocol struct {
+	*onet.TreeNodeInstance
+	*sync.Cond
+
+	//Contribution random contribution of the node to the seed
+	Contribution []byte
+	//Commitment hash of the contribution
+	Commitment []byte
+	//Seed agreed at the end of the protocol
+	Seed []byte
+	//SetSeed called by every node with the agreed seed before it acknowledges it, nil to only record it in Seed.
+	SetSeed func(seed []byte)
+	//Err set if the nodes could not agree on the seed
+	Err error
+	//finished set once the dispatch is finished, so Wait does not miss the end of a dispatch that finished before it was called.
+	finished bool
+
+	//ChannelCommitments to send the commitments to the parent
+	ChannelCommitments chan StructSeedCommitments
+	//ChannelCommitmentList to send all the commitments to the children
+	ChannelCommitmentList chan StructSeedCommitmentList
+	//ChannelContributions to send the contributions to the parent
+	ChannelContributions chan StructSeedContributions
+	//ChannelContributionList to send all the contributions to the children
+	ChannelContributionList chan StructSeedContributionList
+	//ChannelSeedAcks to acknowledge the seed to the parent
+	ChannelSeedAcks chan StructSeedAck
+	ChannelStart    chan StructStart
 }
 
 //StructRTGShare handler for onet
@@ -260,3 +324,93 @@ type StructRelinKeyRoundThree struct {
 	*onet.TreeNode
 	dbfv.RKGShareRoundThree
 }
+
+//SeedCommitments commitments of the nodes of a subtree, indexed by the roster.
+type SeedCommitments struct {
+	Commitments [][]byte
+}
+
+//StructSeedCommitments handler for onet
+type StructSeedCommitments struct {
+	*onet.TreeNode
+	SeedCommitments
+}
+
+//SeedCommitmentList commitments of all the nodes, sent by the root.
+type SeedCommitmentList struct {
+	Commitments [][]byte
+}
+
+//StructSeedCommitmentList handler for onet
+type StructSeedCommitmentList struct {
+	*onet.TreeNode
+	SeedCommitmentList
+}
+
+//SeedContributions contributions of the nodes of a subtree, indexed by the roster.
+type SeedContributions struct {
+	Contributions [][]byte
+}
+
+//StructSeedContributions handler for onet
+type StructSeedContributions struct {
+	*onet.TreeNode
+	SeedContributions
+}
+
+//SeedContributionList contributions of all the nodes, sent by the root.
+type SeedContributionList struct {
+	Contributions [][]byte
+}
+
+//StructSeedContributionList handler for onet
+type StructSeedContributionList struct {
+	*onet.TreeNode
+	SeedContributionList
+}
+
+//SeedAck acknowledgement of the seed by a node and its children. Error is the failure of one of them, empty if they all set the seed.
+type SeedAck struct {
+	Error string
+}
+
+//StructSeedAck handler for onet
+type StructSeedAck struct {
+	*onet.TreeNode
+	SeedAck
+}
+
+//PublicKeyShares serialized public key shares of the nodes of a subtree, indexed by the roster.
+type PublicKeyShares struct {
+	Shares [][]byte
+}
+
+//StructPublicKeyShares handler for onet
+type StructPublicKeyShares struct {
+	*onet.TreeNode
+	PublicKeyShares
+}
+
+//PublicKeyTranscript shares of all the nodes and the serialized public key generated by the root.
+type PublicKeyTranscript struct {
+	Shares    [][]byte
+	PublicKey []byte
+}
+
+//StructPublicKeyTranscript handler for onet
+type StructPublicKeyTranscript struct {
+	*onet.TreeNode
+	PublicKeyTranscript
+}
+
+//InvalidShares report of the invalid shares of a subtree, sent to the parent instead of the share.
+type InvalidShares struct {
+	Offenders []string
+	Reasons   []string
+}
+
+//StructInvalidShares handler for onet
+type StructInvalidShares struct {
+	*onet.TreeNode
+	InvalidShares
+}
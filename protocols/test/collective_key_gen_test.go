@@ -1,6 +1,7 @@
 package test
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/ldsec/lattigo/bfv"
 	"github.com/ldsec/lattigo/dbfv"
@@ -9,6 +10,7 @@ import (
 	"go.dedis.ch/onet/v3/log"
 	"lattigo-smc/protocols"
 	"lattigo-smc/utils"
+	"sync"
 	"testing"
 	"time"
 )
@@ -116,3 +118,107 @@ func testLocalCKG(t *testing.T, params *bfv.Parameters, N int, local *onet.Local
 
 	log.Lvl1("Success")
 }
+
+func TestVerifiableCollectiveKeyGeneration(t *testing.T) {
+	params := bfv.DefaultParams[0]
+	var storageDirectory = "/tmp/"
+	N := 5
+	log.SetDebugVisible(1)
+
+	var lt *utils.LocalTest
+	var lock sync.Mutex
+	instances := make(map[string]*protocols.CollectiveKeyGenerationProtocol)
+	if _, err := onet.GlobalProtocolRegister("VerifiableCollectiveKeyGenerationTest",
+		func(tni *onet.TreeNodeInstance) (instance onet.ProtocolInstance, e error) {
+			instance, err := protocols.NewCollectiveKeyGeneration(tni)
+			if err != nil {
+				return nil, err
+			}
+			if tni.IsRoot() {
+				lt, err = utils.GetLocalTestForRoster(tni.Roster(), params, storageDirectory)
+				if err != nil {
+					return nil, err
+				}
+			}
+			crp := dbfv.NewCRPGenerator(params, []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}).ClockNew()
+			ckgp := instance.(*protocols.CollectiveKeyGenerationProtocol)
+			e = ckgp.Init(params, lt.SecretKeyShares0[tni.ServerIdentity().ID], crp)
+			ckgp.Verifiable = true
+			lock.Lock()
+			instances[tni.ServerIdentity().String()] = ckgp
+			lock.Unlock()
+			return
+		}); err != nil {
+		t.Fatal("Could not register VerifiableCollectiveKeyGenerationTest : ", err)
+	}
+
+	local := onet.NewLocalTest(suites.MustFind("Ed25519"))
+	defer local.CloseAll()
+	_, roster, tree := local.GenTree(N, true)
+	lt, err := utils.GetLocalTestForRoster(roster, params, storageDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lt.TearDown(false)
+
+	pi, err := local.CreateProtocol("VerifiableCollectiveKeyGenerationTest", tree)
+	if err != nil {
+		t.Fatal("Couldn't create new node:", err)
+	}
+	ckgp := pi.(*protocols.CollectiveKeyGenerationProtocol)
+	err = ckgp.Start()
+	if err != nil {
+		t.Fatal("Could not start the tree : ", err)
+	}
+	ckgp.Wait()
+	if ckgp.Err != nil {
+		t.Fatal("Root could not verify the key : ", ckgp.Err)
+	}
+	<-time.After(500 * time.Millisecond)
+
+	//every node checked the key of the root.
+	expected, _ := ckgp.Pk.MarshalBinary()
+	for server, instance := range instances {
+		if instance.Err != nil {
+			t.Fatal(server, " refused the key : ", instance.Err)
+		}
+		data, _ := instance.Pk.MarshalBinary()
+		if !bytes.Equal(data, expected) {
+			t.Fatal(server, " has a different key")
+		}
+	}
+
+	//anyone can recompute the key from the shares, a missing share gives another key.
+	crp := dbfv.NewCRPGenerator(params, []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}).ClockNew()
+	pk, err := protocols.RecomputePublicKey(params, crp, ckgp.Shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := pk.MarshalBinary()
+	if !bytes.Equal(data, expected) {
+		t.Fatal("Recomputed key does not match")
+	}
+	pk, err = protocols.RecomputePublicKey(params, crp, ckgp.Shares[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = pk.MarshalBinary()
+	if bytes.Equal(data, expected) {
+		t.Fatal("Key recomputed without all the shares")
+	}
+	//a share of the wrong size is rejected instead of crashing the node.
+	for _, malformed := range [][]byte{{}, ckgp.Shares[0][:len(ckgp.Shares[0])/2]} {
+		shares := append([][]byte{malformed}, ckgp.Shares[1:]...)
+		if _, err = protocols.RecomputePublicKey(params, crp, shares); err == nil {
+			t.Fatal("Malformed share should be rejected")
+		}
+	}
+
+	enc := bfv.NewEncryptorFromPk(params, ckgp.Pk)
+	dec := bfv.NewDecryptor(params, lt.IdealSecretKey0)
+	pt := bfv.NewPlaintext(params)
+	ptp := dec.DecryptNew(enc.EncryptNew(pt))
+	if !utils.Equalslice(pt.Value()[0].Coeffs[0], bfv.NewEncoder(params).DecodeUint(ptp)) {
+		t.Fatal("Decryption failed")
+	}
+}
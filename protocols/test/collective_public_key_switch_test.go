@@ -112,3 +112,82 @@ func testLocalPCKS(t *testing.T, params *bfv.Parameters, N int, local *onet.Loca
 
 	log.Lvl1("Success")
 }
+
+func TestPublicKeySwitchingAddPlaintext(t *testing.T) {
+	params := bfv.DefaultParams[0]
+	var storageDirectory = "tmp/"
+	N := 3
+	log.SetDebugVisible(1)
+
+	encoder := bfv.NewEncoder(params)
+	values := make([]uint64, 1<<params.LogN)
+	for i := range values {
+		values[i] = uint64(i) % params.T
+	}
+	pt := bfv.NewPlaintext(params)
+	encoder.EncodeUint(values, pt)
+	//every node adds one to the slots through its share.
+	ones := make([]uint64, 1<<params.LogN)
+	for i := range ones {
+		ones[i] = 1
+	}
+	added := bfv.NewPlaintext(params)
+	encoder.EncodeUint(ones, added)
+
+	var ciphertext bfv.Ciphertext
+	var publicKey bfv.PublicKey
+	if _, err := onet.GlobalProtocolRegister("CollectivePublicKeySwitchingAddPlaintextTest",
+		func(tni *onet.TreeNodeInstance) (instance onet.ProtocolInstance, err error) {
+			instance, err = protocols.NewCollectivePublicKeySwitching(tni)
+			if err != nil {
+				return nil, err
+			}
+			lt, err := utils.GetLocalTestForRoster(tni.Roster(), params, storageDirectory)
+			if err != nil {
+				return nil, err
+			}
+			if tni.IsRoot() {
+				publicKey = *bfv.NewKeyGenerator(params).GenPublicKey(lt.IdealSecretKey1)
+				ciphertext = *bfv.NewEncryptorFromSk(params, lt.IdealSecretKey0).EncryptNew(pt)
+			}
+			pcks := instance.(*protocols.CollectivePublicKeySwitchingProtocol)
+			err = pcks.Init(*params, publicKey, *lt.SecretKeyShares0[tni.ServerIdentity().ID], &ciphertext)
+			pcks.AddPlaintext(added)
+			return
+		}); err != nil {
+		t.Fatal("Could not register the protocol : ", err)
+	}
+
+	local := onet.NewLocalTest(suites.MustFind("Ed25519"))
+	defer local.CloseAll()
+	_, roster, tree := local.GenTree(N, true)
+	lt, err := utils.GetLocalTestForRoster(roster, params, storageDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err = lt.TearDown(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	pi, err := local.CreateProtocol("CollectivePublicKeySwitchingAddPlaintextTest", tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcks := pi.(*protocols.CollectivePublicKeySwitchingProtocol)
+	err = pcks.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcks.Wait()
+
+	decoded := encoder.DecodeUint(bfv.NewDecryptor(params, lt.IdealSecretKey1).DecryptNew(&pcks.CiphertextOut))
+	for i := range values {
+		values[i] = (values[i] + uint64(N)) % params.T
+	}
+	if !utils.Equalslice(values, decoded) {
+		t.Fatal("The plaintexts of the nodes were not added to the result")
+	}
+}
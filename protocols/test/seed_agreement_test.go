@@ -0,0 +1,116 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"lattigo-smc/protocols"
+	"sync"
+	"testing"
+)
+
+func TestSeedAgreement(t *testing.T) {
+	var nbnodes = []int{3, 8, 16}
+	if testing.Short() {
+		nbnodes = nbnodes[:1]
+	}
+
+	log.SetDebugVisible(1)
+
+	//instances of the protocol at every node, to compare the seeds.
+	var lock sync.Mutex
+	instances := make(map[string]*protocols.SeedAgreementProtocol)
+	newInstance := func(cheat bool) func(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+		return func(tni *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+			instance, err := protocols.NewSeedAgreement(tni)
+			if err != nil {
+				return nil, err
+			}
+			sap := instance.(*protocols.SeedAgreementProtocol)
+			err = sap.Init(nil)
+			if cheat && tni.IsLeaf() {
+				//the leaves reveal another contribution than the one they committed to.
+				sap.Contribution = make([]byte, protocols.SeedContributionSize)
+			}
+			lock.Lock()
+			instances[tni.ServerIdentity().String()] = sap
+			lock.Unlock()
+			return instance, err
+		}
+	}
+	if _, err := onet.GlobalProtocolRegister("SeedAgreementTest", newInstance(false)); err != nil {
+		t.Fatal("Could not register SeedAgreementTest : ", err)
+	}
+	if _, err := onet.GlobalProtocolRegister("SeedAgreementCheatTest", newInstance(true)); err != nil {
+		t.Fatal("Could not register SeedAgreementCheatTest : ", err)
+	}
+
+	for _, N := range nbnodes {
+		t.Run(fmt.Sprintf("/local/nbnodes=%d", N), func(t *testing.T) {
+			instances = make(map[string]*protocols.SeedAgreementProtocol)
+			testSeedAgreement(t, N, onet.NewLocalTest(suites.MustFind("Ed25519")), instances)
+		})
+		t.Run(fmt.Sprintf("/TCP/nbnodes=%d", N), func(t *testing.T) {
+			instances = make(map[string]*protocols.SeedAgreementProtocol)
+			testSeedAgreement(t, N, onet.NewTCPTest(suites.MustFind("Ed25519")), instances)
+		})
+		t.Run(fmt.Sprintf("/cheat/nbnodes=%d", N), func(t *testing.T) {
+			instances = make(map[string]*protocols.SeedAgreementProtocol)
+			testSeedAgreementCheat(t, N, onet.NewLocalTest(suites.MustFind("Ed25519")))
+		})
+	}
+}
+
+func testSeedAgreement(t *testing.T, N int, local *onet.LocalTest, instances map[string]*protocols.SeedAgreementProtocol) {
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(N, true)
+
+	pi, err := local.CreateProtocol("SeedAgreementTest", tree)
+	if err != nil {
+		t.Fatal("Couldn't create new node:", err)
+	}
+	sap := pi.(*protocols.SeedAgreementProtocol)
+	err = sap.Start()
+	if err != nil {
+		t.Fatal("Could not start the tree : ", err)
+	}
+	sap.Wait()
+	if sap.Err != nil {
+		t.Fatal("Seed agreement failed : ", sap.Err)
+	}
+	if len(sap.Seed) == 0 || bytes.Equal(sap.Seed, sap.Contribution) {
+		t.Fatal("Root did not compute the seed from all the contributions")
+	}
+
+	//the root finishes once all the nodes acknowledged the seed.
+	if len(instances) != N {
+		t.Fatal("Only ", len(instances), " nodes took part in the protocol")
+	}
+	for server, instance := range instances {
+		if instance.Err != nil || !bytes.Equal(instance.Seed, sap.Seed) {
+			t.Fatal(server, " did not agree on the seed : ", instance.Err)
+		}
+	}
+	log.Lvl1("Success")
+}
+
+func testSeedAgreementCheat(t *testing.T, N int, local *onet.LocalTest) {
+	defer local.CloseAll()
+	_, _, tree := local.GenTree(N, true)
+
+	pi, err := local.CreateProtocol("SeedAgreementCheatTest", tree)
+	if err != nil {
+		t.Fatal("Couldn't create new node:", err)
+	}
+	sap := pi.(*protocols.SeedAgreementProtocol)
+	err = sap.Start()
+	if err != nil {
+		t.Fatal("Could not start the tree : ", err)
+	}
+	sap.Wait()
+	if sap.Err == nil || sap.Seed != nil {
+		t.Fatal("Root accepted a contribution that does not match its commitment")
+	}
+}
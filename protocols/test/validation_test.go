@@ -0,0 +1,200 @@
+package test
+
+import (
+	"github.com/ldsec/lattigo/bfv"
+	"github.com/ldsec/lattigo/dbfv"
+	"github.com/ldsec/lattigo/ring"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"lattigo-smc/protocols"
+	"lattigo-smc/utils"
+	"testing"
+)
+
+func TestCheckShares(t *testing.T) {
+	params := bfv.DefaultParams[0]
+
+	ckgShare := dbfv.NewCKGProtocol(params).AllocateShares()
+	if err := protocols.CheckCKGShare(params, ckgShare); err != nil {
+		t.Fatal("Valid CKG share rejected : ", err)
+	}
+	cksShare := dbfv.NewCKSProtocol(params, params.Sigma).AllocateShare()
+	if err := protocols.CheckCKSShare(params, cksShare); err != nil {
+		t.Fatal("Valid CKS share rejected : ", err)
+	}
+	if err := protocols.CheckPCKSShare(params, dbfv.NewPCKSProtocol(params, params.Sigma).AllocateShares()); err != nil {
+		t.Fatal("Valid PCKS share rejected : ", err)
+	}
+	if err := protocols.CheckRefreshShare(params, dbfv.NewRefreshProtocol(params).AllocateShares()); err != nil {
+		t.Fatal("Valid refresh share rejected : ", err)
+	}
+	//the key generations have a share for each element of the CRP, one per modulus of the ciphertexts.
+	count := len(params.Moduli.Qi)
+	r1, r2, r3 := dbfv.NewEkgProtocol(params).AllocateShares()
+	if err := protocols.CheckRKGShareRoundOne(params, r1, count); err != nil {
+		t.Fatal("Valid RKG round one share rejected : ", err)
+	}
+	if err := protocols.CheckRKGShareRoundTwo(params, r2, count); err != nil {
+		t.Fatal("Valid RKG round two share rejected : ", err)
+	}
+	if err := protocols.CheckRKGShareRoundThree(params, r3, count); err != nil {
+		t.Fatal("Valid RKG round three share rejected : ", err)
+	}
+	if err := protocols.CheckRKGShareRoundOne(params, r1[1:], count); err == nil {
+		t.Fatal("RKG share with a missing polynomial accepted")
+	}
+	rtgShare := dbfv.NewRotKGProtocol(params).AllocateShare()
+	if err := protocols.CheckRTGShare(params, rtgShare, rtgShare.Type, rtgShare.K, count); err != nil {
+		t.Fatal("Valid RTG share rejected : ", err)
+	}
+	if err := protocols.CheckRTGShare(params, rtgShare, rtgShare.Type, rtgShare.K+1, count); err == nil {
+		t.Fatal("RTG share of another rotation accepted")
+	}
+
+	//a share of the key generation has the moduli of the keys, not the ones of the ciphertexts.
+	if err := protocols.CheckCKSShare(params, dbfv.CKSShare{Poly: ckgShare.Poly}); err == nil {
+		t.Fatal("Share with the wrong number of moduli accepted")
+	}
+	//wrong ring degree.
+	half := &ring.Poly{Coeffs: make([][]uint64, len(params.Moduli.Qi))}
+	for i := range half.Coeffs {
+		half.Coeffs[i] = make([]uint64, 1<<(params.LogN-1))
+	}
+	if err := protocols.CheckPoly(half, params.Moduli.Qi, params.LogN); err == nil {
+		t.Fatal("Polynomial with the wrong ring degree accepted")
+	}
+	//coefficient out of range.
+	cksShare.Coeffs[0][0] = params.Moduli.Qi[0]
+	if err := protocols.CheckCKSShare(params, cksShare); err == nil {
+		t.Fatal("Coefficient larger than its modulus accepted")
+	}
+	if err := protocols.CheckPoly(nil, params.Moduli.Qi, params.LogN); err == nil {
+		t.Fatal("Missing polynomial accepted")
+	}
+}
+
+func TestInvalidShareReported(t *testing.T) {
+	params := bfv.DefaultParams[0]
+	var storageDirectory = "/tmp/"
+	log.SetDebugVisible(1)
+
+	var lt *utils.LocalTest
+	var offender string
+	if _, err := onet.GlobalProtocolRegister("InvalidShareTest",
+		func(tni *onet.TreeNodeInstance) (instance onet.ProtocolInstance, e error) {
+			instance, err := protocols.NewCollectiveKeyGeneration(tni)
+			if err != nil {
+				return nil, err
+			}
+			if tni.IsRoot() {
+				lt, err = utils.GetLocalTestForRoster(tni.Roster(), params, storageDirectory)
+				if err != nil {
+					return nil, err
+				}
+			}
+			crp := dbfv.NewCRPGenerator(params, []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}).ClockNew()
+			ckgp := instance.(*protocols.CollectiveKeyGenerationProtocol)
+			e = ckgp.Init(params, lt.SecretKeyShares0[tni.ServerIdentity().ID], crp)
+			if tni.IsLeaf() && offender == "" {
+				//the first leaf sends a share with a single modulus.
+				offender = tni.ServerIdentity().String()
+				ckgp.CKGShare = dbfv.CKGShare{Poly: &ring.Poly{Coeffs: [][]uint64{make([]uint64, 1<<params.LogN)}}}
+			}
+			return
+		}); err != nil {
+		t.Fatal("Could not register InvalidShareTest : ", err)
+	}
+
+	local := onet.NewLocalTest(suites.MustFind("Ed25519"))
+	defer local.CloseAll()
+	_, roster, tree := local.GenTree(3, true)
+	lt, err := utils.GetLocalTestForRoster(roster, params, storageDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lt.TearDown(false)
+
+	pi, err := local.CreateProtocol("InvalidShareTest", tree)
+	if err != nil {
+		t.Fatal("Couldn't create new node:", err)
+	}
+	ckgp := pi.(*protocols.CollectiveKeyGenerationProtocol)
+	err = ckgp.Start()
+	if err != nil {
+		t.Fatal("Could not start the tree : ", err)
+	}
+	ckgp.Wait()
+
+	invalid, ok := ckgp.Err.(*protocols.InvalidShareError)
+	if !ok {
+		t.Fatal("Root did not report the invalid share : ", ckgp.Err)
+	}
+	if len(invalid.Offenders) != 1 || invalid.Offenders[0] != offender {
+		t.Fatal("Wrong offenders : ", invalid.Offenders, " expected ", offender)
+	}
+}
+
+func TestInvalidRotationShareAborts(t *testing.T) {
+	params := bfv.DefaultParams[0]
+	var storageDirectory = "/tmp/"
+	log.SetDebugVisible(1)
+
+	ctxPQ, _ := ring.NewContextWithParams(1<<params.LogN, append(params.Moduli.Qi, params.Moduli.Pi...))
+	crpGenerator := ring.NewCRPGenerator(nil, ctxPQ)
+	crp := make([]*ring.Poly, len(params.Moduli.Qi))
+	for j := range crp {
+		crp[j] = crpGenerator.ClockNew()
+	}
+
+	var offender string
+	if _, err := onet.GlobalProtocolRegister("InvalidRotationShareTest",
+		func(tni *onet.TreeNodeInstance) (instance onet.ProtocolInstance, e error) {
+			instance, err := protocols.NewRotationKey(tni)
+			if err != nil {
+				return nil, err
+			}
+			lt, err := utils.GetLocalTestForRoster(tni.Roster(), params, storageDirectory)
+			if err != nil {
+				return nil, err
+			}
+			rkp := instance.(*protocols.RotationKeyProtocol)
+			e = rkp.Init(params, *lt.SecretKeyShares0[tni.ServerIdentity().ID], bfv.RotationLeft, 1, crp, true, nil)
+			if tni.IsLeaf() && offender == "" {
+				//the first leaf sends a share of another rotation.
+				offender = tni.ServerIdentity().String()
+				rkp.RTShare.K = 2
+			}
+			return
+		}); err != nil {
+		t.Fatal("Could not register InvalidRotationShareTest : ", err)
+	}
+
+	local := onet.NewLocalTest(suites.MustFind("Ed25519"))
+	defer local.CloseAll()
+	_, roster, tree := local.GenTree(3, true)
+	lt, err := utils.GetLocalTestForRoster(roster, params, storageDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lt.TearDown(false)
+
+	pi, err := local.CreateProtocol("InvalidRotationShareTest", tree)
+	if err != nil {
+		t.Fatal("Couldn't create new node:", err)
+	}
+	rkp := pi.(*protocols.RotationKeyProtocol)
+	err = rkp.Start()
+	if err != nil {
+		t.Fatal("Could not start the tree : ", err)
+	}
+	rkp.Wait()
+
+	invalid, ok := rkp.Err.(*protocols.InvalidShareError)
+	if !ok {
+		t.Fatal("Root did not abort the protocol : ", rkp.Err)
+	}
+	if len(invalid.Offenders) != 1 || invalid.Offenders[0] != offender {
+		t.Fatal("Wrong offenders : ", invalid.Offenders, " expected ", offender)
+	}
+}
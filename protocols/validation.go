@@ -0,0 +1,203 @@
+//Validation of the shares received from the children. A share with the wrong ring degree or number of moduli could make the aggregation panic,
+//and a coefficient larger than its modulus silently corrupts the result. The shares of the key generation, key switching and refresh
+//are masked by the secret key shares so they are uniform : their noise can not be bounded, only their structure and range are checked.
+//A node that receives an invalid share does not aggregate it and sends the report of the offending tree nodes to its parent instead of its share,
+//so the root fails with the list of the offenders. In the relinearization and rotation key generations the nodes wait for the outcome of the root :
+//it sends the report down the tree so that they abort, or an empty report once the key is generated.
+
+package protocols
+
+import (
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"github.com/ldsec/lattigo/dbfv"
+	"github.com/ldsec/lattigo/ring"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"strconv"
+	"strings"
+)
+
+//InvalidShareError error of a protocol that received invalid shares. Offenders are the tree nodes that sent them.
+type InvalidShareError struct {
+	Offenders []string
+	Reasons   []string
+}
+
+func (e *InvalidShareError) Error() string {
+	reports := make([]string, len(e.Offenders))
+	for i := range e.Offenders {
+		reports[i] = e.Offenders[i] + " : " + e.Reasons[i]
+	}
+	return "invalid shares from " + strings.Join(reports, ", ")
+}
+
+//shareCheck collects the invalid shares received by a node from its subtree.
+type shareCheck struct {
+	InvalidShareError
+}
+
+//reject records the invalid share sent by the tree node.
+func (c *shareCheck) reject(tn *onet.TreeNode, err error) {
+	log.Error("Invalid share from ", tn, " : ", err)
+	c.Offenders = append(c.Offenders, tn.ServerIdentity.String())
+	c.Reasons = append(c.Reasons, err.Error())
+}
+
+//add records the invalid shares reported by a child for its subtree.
+func (c *shareCheck) add(report InvalidShares) {
+	c.Offenders = append(c.Offenders, report.Offenders...)
+	c.Reasons = append(c.Reasons, report.Reasons...)
+}
+
+//failed returns true if the node received an invalid share.
+func (c *shareCheck) failed() bool {
+	return len(c.Offenders) > 0
+}
+
+//err returns the error of the invalid shares, or nil if all the shares are valid.
+func (c *shareCheck) err() error {
+	if !c.failed() {
+		return nil
+	}
+	return &InvalidShareError{Offenders: c.Offenders, Reasons: c.Reasons}
+}
+
+//report returns the message sent to the parent instead of the share.
+func (c *shareCheck) report() *InvalidShares {
+	return &InvalidShares{Offenders: c.Offenders, Reasons: c.Reasons}
+}
+
+//err returns the error of the report, or nil if it has no offenders.
+func (r *InvalidShares) err() error {
+	if len(r.Offenders) == 0 {
+		return nil
+	}
+	return &InvalidShareError{Offenders: r.Offenders, Reasons: r.Reasons}
+}
+
+//conclude ends a protocol whose nodes wait for the outcome of the root. A node that received invalid shares reports them to its parent,
+//the root sends its report down the tree, empty if the protocol succeeded, and the other nodes forward it to their children.
+//It returns the error of the report of the root.
+func conclude(tn *onet.TreeNodeInstance, reports chan StructInvalidShares, check *shareCheck) error {
+	report := check.report()
+	if !tn.IsRoot() {
+		if check.failed() {
+			err := tn.SendToParent(report)
+			if err != nil {
+				log.Error("Could not report the invalid shares to parent : ", err)
+				return check.err()
+			}
+		}
+		root := <-reports
+		report = &root.InvalidShares
+	}
+	err := tn.SendToChildren(report)
+	if err != nil {
+		log.Error("Could not send the outcome of the protocol to children : ", err)
+	}
+	return report.err()
+}
+
+//CheckPoly checks that the polynomial has a coefficient vector of the ring degree 2^logN for each modulus, with coefficients smaller than the modulus.
+func CheckPoly(poly *ring.Poly, moduli []uint64, logN uint64) error {
+	if poly == nil {
+		return errors.New("missing polynomial")
+	}
+	if len(poly.Coeffs) != len(moduli) {
+		return errors.New("polynomial has " + strconv.Itoa(len(poly.Coeffs)) + " moduli instead of " + strconv.Itoa(len(moduli)))
+	}
+	for i, coeffs := range poly.Coeffs {
+		if uint64(len(coeffs)) != 1<<logN {
+			return errors.New("polynomial does not have the ring degree of the parameters")
+		}
+		for _, c := range coeffs {
+			if c >= moduli[i] {
+				return errors.New("coefficient is larger than its modulus")
+			}
+		}
+	}
+	return nil
+}
+
+//keyModuli returns the moduli of the ring of the keys QP.
+func keyModuli(params *bfv.Parameters) []uint64 {
+	return append(append([]uint64{}, params.Moduli.Qi...), params.Moduli.Pi...)
+}
+
+//checkKeyPolys checks that there are count polynomials in the ring of the keys QP, one for each element of the CRP.
+func checkKeyPolys(params *bfv.Parameters, polys []*ring.Poly, count int) error {
+	if len(polys) != count {
+		return errors.New("share has " + strconv.Itoa(len(polys)) + " polynomials instead of " + strconv.Itoa(count))
+	}
+	moduli := keyModuli(params)
+	for _, poly := range polys {
+		if err := CheckPoly(poly, moduli, params.LogN); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//CheckCKGShare checks the structure of a collective key generation share, a polynomial in the ring of the keys QP.
+func CheckCKGShare(params *bfv.Parameters, share dbfv.CKGShare) error {
+	return CheckPoly(share.Poly, keyModuli(params), params.LogN)
+}
+
+//CheckRKGShareRoundOne checks the structure of a share of the first round of the relinearization key generation,
+//a polynomial in the ring of the keys QP for each of the count elements of the CRP.
+func CheckRKGShareRoundOne(params *bfv.Parameters, share dbfv.RKGShareRoundOne, count int) error {
+	return checkKeyPolys(params, share, count)
+}
+
+//CheckRKGShareRoundTwo checks the structure of a share of the second round of the relinearization key generation,
+//a pair of polynomials in the ring of the keys QP for each of the count elements of the CRP.
+func CheckRKGShareRoundTwo(params *bfv.Parameters, share dbfv.RKGShareRoundTwo, count int) error {
+	if len(share) != count {
+		return errors.New("share has " + strconv.Itoa(len(share)) + " pairs of polynomials instead of " + strconv.Itoa(count))
+	}
+	for _, pair := range share {
+		if err := checkKeyPolys(params, pair[:], 2); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//CheckRKGShareRoundThree checks the structure of a share of the third round of the relinearization key generation,
+//a polynomial in the ring of the keys QP for each of the count elements of the CRP.
+func CheckRKGShareRoundThree(params *bfv.Parameters, share dbfv.RKGShareRoundThree, count int) error {
+	return checkKeyPolys(params, share, count)
+}
+
+//CheckRTGShare checks that a rotation key generation share is for the rotation of the node and has a polynomial in the ring of the keys QP
+//for each of the count elements of the CRP.
+func CheckRTGShare(params *bfv.Parameters, share dbfv.RTGShare, rotation bfv.Rotation, k uint64, count int) error {
+	if share.Type != rotation || share.K != k {
+		return errors.New("share is for another rotation")
+	}
+	return checkKeyPolys(params, share.Value, count)
+}
+
+//CheckCKSShare checks the structure of a collective key switching share, a polynomial in the ring of the ciphertexts Q.
+func CheckCKSShare(params *bfv.Parameters, share dbfv.CKSShare) error {
+	return CheckPoly(share.Poly, params.Moduli.Qi, params.LogN)
+}
+
+//CheckPCKSShare checks the structure of a collective public key switching share, two polynomials in the ring of the ciphertexts Q.
+func CheckPCKSShare(params *bfv.Parameters, share dbfv.PCKSShare) error {
+	for _, poly := range share {
+		if err := CheckPoly(poly, params.Moduli.Qi, params.LogN); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//CheckRefreshShare checks the structure of a refresh share, a decryption and a recryption polynomial in the ring of the ciphertexts Q.
+func CheckRefreshShare(params *bfv.Parameters, share dbfv.RefreshShare) error {
+	if err := CheckPoly(share.RefreshShareDecrypt, params.Moduli.Qi, params.LogN); err != nil {
+		return err
+	}
+	return CheckPoly(share.RefreshShareRecrypt, params.Moduli.Qi, params.LogN)
+}
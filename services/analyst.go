@@ -0,0 +1,225 @@
+//analyst contains the decryption delegated to an analyst that does not run a server. The analyst registers a public key at the root,
+//the operator of every member of the roster approves it with the key of its server ( see AnalystSubject ), then the results asked for the analyst are switched to its key
+//with the collective public key switching and held at the root until the analyst downloads them. Only the analyst can decrypt them, with its secret key.
+//The analyst also registers a signing key derived from its secret key ( see AnalystSigningKey ), a download is only accepted with its signature.
+//The results held count against the capacity of the store, they are bounded per analyst and expire if they are not downloaded.
+package services
+
+import (
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/utils"
+	"time"
+)
+
+//maxAnalystResults maximum number of results held for an analyst until it downloads them.
+const maxAnalystResults = 64
+
+//analystResultTTL time a result is held for an analyst that does not download it.
+const analystResultTTL = 24 * time.Hour
+
+//Analyst public key of an analyst registered at the root, the key that signs its downloads, the subject approved by the members and the results switched to the key.
+type Analyst struct {
+	PublicKey  *bfv.PublicKey
+	SigningKey kyber.Point
+	Subject    string
+	Results    map[uuid.UUID]*AnalystResult
+}
+
+//AnalystResult ciphertext switched to the key of an analyst and the descriptor of its values, removed after Expiry.
+type AnalystResult struct {
+	Ciphertext *bfv.Ciphertext
+	Descriptor utils.DataDescriptor
+	Expiry     time.Time
+}
+
+//AnalystSubject returns the subject the members approve for the analyst name with the public key pk and the signing key of its downloads.
+func AnalystSubject(name string, pk *bfv.PublicKey, signingKey kyber.Point) (string, error) {
+	fingerprint, err := keyFingerprint(pk)
+	if err != nil {
+		return "", err
+	}
+	return "analyst " + name + " with the key " + fingerprint + " signing with " + signingKey.String(), nil
+}
+
+//AnalystSigningKey returns the key pair with which the analyst signs its downloads. It is derived from the secret key of the analyst, so it only keeps one secret.
+func AnalystSigningKey(sk *bfv.SecretKey) (*key.Pair, error) {
+	data, err := sk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	private := utils.SUITE.Scalar().Pick(utils.SUITE.XOF(data))
+	return &key.Pair{Public: utils.SUITE.Point().Mul(private, nil), Private: private}, nil
+}
+
+//downloadSubject returns the subject the analyst name signs to download the result id. A result is removed once downloaded, so the signature can not be replayed.
+func downloadSubject(name string, id uuid.UUID) string {
+	return "download of " + id.String() + " by analyst " + name
+}
+
+//SignDownload signs the download of the result id by the analyst name with its signing key.
+func SignDownload(private kyber.Scalar, name string, id uuid.UUID) ([]byte, error) {
+	return schnorr.Sign(utils.SUITE, private, []byte(downloadSubject(name, id)))
+}
+
+//HandleAnalystRegistrationQuery handler for an analyst to register its public key under a name.
+func (s *Service) HandleAnalystRegistrationQuery(query *AnalystRegistrationQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got registration of analyst ", query.Name)
+	if query.Name == "" {
+		return nil, errors.New("analyst has no name")
+	}
+	if query.SigningKey == nil {
+		return nil, errors.New("analyst has no signing key")
+	}
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//HandleAnalystResultQuery handler to switch a ciphertext to the key of an approved analyst. Replies with the id of the result held for the analyst.
+func (s *Service) HandleAnalystResultQuery(query *AnalystResultQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got request of ", query.UUID, " for analyst ", query.Name)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//HandleAnalystDownloadQuery handler for an analyst to download a result switched to its key.
+func (s *Service) HandleAnalystDownloadQuery(query *AnalystDownloadQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got download of ", query.UUID, " for analyst ", query.Name)
+	if len(query.Signature) == 0 {
+		return nil, errors.New("the download is not signed")
+	}
+	query.QueryID = uuid.NewV1()
+	return s.sendExportQuery(query.QueryID, query)
+}
+
+//registerAnalyst stores the public key of the analyst, it has to be approved before any result is switched to it. Should be called by the root.
+func (s *Service) registerAnalyst(query *AnalystRegistrationQuery) error {
+	pk, err := s.targetPublicKey(query.PublicKey)
+	if err != nil {
+		return err
+	}
+	subject, err := AnalystSubject(query.Name, pk, query.SigningKey)
+	if err != nil {
+		return err
+	}
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	if _, ok := s.Analysts[query.Name]; ok {
+		return errors.New("analyst " + query.Name + " is already registered")
+	}
+	s.Analysts[query.Name] = &Analyst{
+		PublicKey:  pk,
+		SigningKey: query.SigningKey,
+		Subject:    subject,
+		Results:    make(map[uuid.UUID]*AnalystResult),
+	}
+	return nil
+}
+
+//switchToAnalyst switches the ciphertext of the query to the key of the analyst and holds the result for download. Should be called by the root.
+func (s *Service) switchToAnalyst(query *AnalystResultQuery) (uuid.UUID, error) {
+	analyst, err := s.getAnalyst(query.Name)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err = s.approvedBy(analyst.Subject, s.Roster.List); err != nil {
+		return uuid.Nil, errors.New("analyst " + query.Name + " has not been approved by all the members : " + err.Error())
+	}
+	if err = s.checkAnalystResults(query.Name, analyst); err != nil {
+		return uuid.Nil, err
+	}
+	ct, err := s.getCiphertext(query.UUID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if ct.Degree() > 1 {
+		return uuid.Nil, errors.New("ciphertext " + query.UUID.String() + " should be relinearized before the switching")
+	}
+	if err = s.checkCapacity(ciphertextSize(ct)); err != nil {
+		return uuid.Nil, err
+	}
+	if query.Noise, err = s.calibrateNoise(query.Noise); err != nil {
+		return uuid.Nil, err
+	}
+	var sources []uuid.UUID
+	if query.Noise != nil {
+		if sources, err = s.reservePrivacyBudget(query.UUID, query.Noise); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	switched, err := s.switchToPublicKey(s.Roster.GenerateBinaryTree(), query.UUID, ct, analyst.PublicKey, query.Noise)
+	if err != nil {
+		s.refundPrivacyBudget(sources, query.Noise)
+		return uuid.Nil, err
+	}
+	result := &AnalystResult{Ciphertext: switched, Descriptor: s.descriptor(query.UUID), Expiry: time.Now().Add(analystResultTTL)}
+	//the results may have been filled during the switching, the result is dropped.
+	if err = s.checkAnalystResults(query.Name, analyst); err != nil {
+		s.refundPrivacyBudget(sources, query.Noise)
+		return uuid.Nil, err
+	}
+	id := uuid.NewV1()
+	s.storeLock.Lock()
+	analyst.Results[id] = result
+	s.storeLock.Unlock()
+	return id, nil
+}
+
+//checkAnalystResults returns an error if the analyst name holds the maximum number of results.
+func (s *Service) checkAnalystResults(name string, analyst *Analyst) error {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	if len(analyst.Results) >= maxAnalystResults {
+		return errors.New("analyst " + name + " holds too many results, they should be downloaded first")
+	}
+	return nil
+}
+
+//analystResult returns the result held for the analyst and removes it, it is only downloaded once. The download should be signed by the analyst.
+//Should be called by the root.
+func (s *Service) analystResult(query *AnalystDownloadQuery) (*AnalystResult, error) {
+	analyst, err := s.getAnalyst(query.Name)
+	if err != nil {
+		return nil, err
+	}
+	err = schnorr.Verify(utils.SUITE, analyst.SigningKey, []byte(downloadSubject(query.Name, query.UUID)), query.Signature)
+	if err != nil {
+		return nil, errors.New("invalid signature of the download for analyst " + query.Name + " : " + err.Error())
+	}
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	result, ok := analyst.Results[query.UUID]
+	if !ok {
+		return nil, errors.New("no result " + query.UUID.String() + " for analyst " + query.Name)
+	}
+	delete(analyst.Results, query.UUID)
+	return result, nil
+}
+
+//getAnalyst returns the analyst registered under the name.
+func (s *Service) getAnalyst(name string) (*Analyst, error) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	analyst, ok := s.Analysts[name]
+	if !ok {
+		return nil, errors.New("analyst " + name + " is not registered")
+	}
+	return analyst, nil
+}
+
+//DecryptAnalystResult decrypts a downloaded result with the secret key of the analyst and decodes its values.
+func DecryptAnalystResult(params *bfv.Parameters, sk *bfv.SecretKey, ciphertext []byte, descriptor utils.DataDescriptor) (*utils.TypedValues, error) {
+	ct := new(bfv.Ciphertext)
+	err := ct.UnmarshalBinary(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	plain := bfv.NewDecryptor(params, sk).DecryptNew(ct)
+	return utils.DecodeTypedValues(bfv.NewEncoder(params).DecodeUint(plain), descriptor, params.T)
+}
@@ -2,11 +2,15 @@
 package services
 
 import (
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
 	uuid "gopkg.in/satori/go.uuid.v1"
 	"lattigo-smc/utils"
+	"time"
 )
 
 //API represents a client
@@ -31,9 +35,23 @@ func NewLattigoSMCClient(entryPoint *network.ServerIdentity, clientID string) *A
 func (c *API) SendSetupQuery(entities *onet.Roster, generatePublicKey, generateEvaluationKey, genRotationKey bool, K uint64, rotIdx int, paramsIdx uint64, seed []byte) error {
 	log.Lvl1(c, "Sending a setup query to the roster")
 
-	setupQuery := SetupRequest{*entities, paramsIdx, seed, generatePublicKey, generateEvaluationKey, genRotationKey, K, rotIdx}
+	setupQuery := SetupRequest{
+		Roster:                *entities,
+		ParamsIdx:             paramsIdx,
+		Seed:                  seed,
+		GeneratePublicKey:     generatePublicKey,
+		GenerateEvaluationKey: generateEvaluationKey,
+		GenerateRotationKey:   genRotationKey,
+		K:                     K,
+		RotIdx:                rotIdx,
+	}
+	return c.SendSetupRequest(&setupQuery)
+}
+
+//SendSetupRequest sends the setup request to the roster. It allows to set all the options of the setup.
+func (c *API) SendSetupRequest(request *SetupRequest) error {
 	resp := SetupReply{}
-	err := c.SendProtobuf(c.entryPoint, &setupQuery, &resp)
+	err := c.SendProtobuf(c.entryPoint, request, &resp)
 	if err != nil {
 		return err
 	}
@@ -43,6 +61,17 @@ func (c *API) SendSetupQuery(entities *onet.Roster, generatePublicKey, generateE
 
 }
 
+//SendSetupWithParameters sends the setup request with the custom parameters instead of the default parameters.
+//The parameters are validated by every node before the keys are generated.
+func (c *API) SendSetupWithParameters(request *SetupRequest, params *bfv.Parameters) error {
+	data, err := params.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	request.Parameters = data
+	return c.SendSetupRequest(request)
+}
+
 //SendKeyRequest sends a request for the server to retrieve the keys needed.
 func (c *API) SendKeyRequest(publickey, evaluationkey, rotationkey bool, RotIdx int) (int, error) {
 	kr := KeyRequest{
@@ -80,6 +109,59 @@ func (c *API) SendWriteQuery(roster *onet.Roster, data []byte) (*uuid.UUID, erro
 	return &id, nil
 }
 
+//SendTypedWriteQuery send a query to write the typed values. returns the UUID of the corresponding ciphertext.
+//The type of the values is stored with the ciphertext so GetTypedPlaintext returns the same type.
+func (c *API) SendTypedWriteQuery(roster *onet.Roster, values *utils.TypedValues) (*uuid.UUID, error) {
+	result := ServiceState{}
+	query := QueryData{Roster: *roster, Values: values}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Lvl1(c, "sent a typed query to the server.")
+	if result.Pending {
+		log.Warn("Pending transaction")
+	}
+	return &result.Id, nil
+}
+
+//GetTypedPlaintext send a request to retrieve the values of the ciphertext encrypted under id, decoded with their type.
+func (c *API) GetTypedPlaintext(id *uuid.UUID) (*utils.TypedValues, error) {
+	return c.GetNoisyPlaintext(id, nil)
+}
+
+//GetNoisyPlaintext retrieves the values of the ciphertext id decrypted with the differential privacy noise, the epsilon of the noise is spent
+//on the datasets the ciphertext is computed from. The values should be signed to decode the negative noise.
+func (c *API) GetNoisyPlaintext(id *uuid.UUID, noise *utils.NoiseParameters) (*utils.TypedValues, error) {
+	query := QueryPlaintext{UUID: *id, Noise: noise}
+	response := PlaintextReply{}
+	err := c.SendProtobuf(c.entryPoint, &query, &response)
+	if err != nil {
+		log.Lvl1("Error while sending : ", err)
+		return nil, err
+	}
+	if response.Values == nil {
+		return nil, errors.New("no typed values in the reply")
+	}
+	return response.Values, nil
+}
+
+//GetNamedPlaintext retrieves the values of the ciphertext or dataset registered under name, decrypted with the differential privacy noise if it is not nil.
+func (c *API) GetNamedPlaintext(name string, noise *utils.NoiseParameters) (*utils.TypedValues, error) {
+	query := QueryPlaintext{Name: name, Noise: noise}
+	response := PlaintextReply{}
+	err := c.SendProtobuf(c.entryPoint, &query, &response)
+	if err != nil {
+		log.Lvl1("Error while sending : ", err)
+		return nil, err
+	}
+	if response.Values == nil {
+		return nil, errors.New("no typed values in the reply")
+	}
+	return response.Values, nil
+}
+
 //GetPlaintext send a request to retrieve the plaintext of the ciphertetx encrypted under id
 func (c *API) GetPlaintext(id *uuid.UUID) ([]byte, error) {
 	query := QueryPlaintext{UUID: *id}
@@ -172,6 +254,738 @@ func (c *API) SendRotationQuery(id uuid.UUID, K uint64, rotType int) (uuid.UUID,
 	return result.Id, err
 }
 
+//SendSubQuery sends a query to subtract ciphertext id2 from id1.
+func (c *API) SendSubQuery(id1, id2 uuid.UUID) (uuid.UUID, error) {
+	query := SubQuery{
+		UUID:  id1,
+		Other: id2,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of sub query :", result.Id)
+	return result.Id, nil
+}
+
+//SendNegQuery sends a query to negate ciphertext id.
+func (c *API) SendNegQuery(id uuid.UUID) (uuid.UUID, error) {
+	query := NegQuery{
+		UUID: id,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of neg query :", result.Id)
+	return result.Id, nil
+}
+
+//SendPlaintextAddQuery sends a query to add the plaintext vector to ciphertext id. The values should be smaller than the plaintext modulus.
+func (c *API) SendPlaintextAddQuery(id uuid.UUID, plaintext []uint64) (uuid.UUID, error) {
+	return c.sendPlaintextOperationQuery(id, OperationAdd, plaintext)
+}
+
+//SendPlaintextSubQuery sends a query to subtract the plaintext vector from ciphertext id.
+func (c *API) SendPlaintextSubQuery(id uuid.UUID, plaintext []uint64) (uuid.UUID, error) {
+	return c.sendPlaintextOperationQuery(id, OperationSub, plaintext)
+}
+
+//SendPlaintextMultiplyQuery sends a query to multiply slot-wise ciphertext id by the plaintext vector.
+func (c *API) SendPlaintextMultiplyQuery(id uuid.UUID, plaintext []uint64) (uuid.UUID, error) {
+	return c.sendPlaintextOperationQuery(id, OperationMul, plaintext)
+}
+
+//SendScalarAddQuery sends a query to add scalar to all the slots of ciphertext id.
+func (c *API) SendScalarAddQuery(id uuid.UUID, scalar uint64) (uuid.UUID, error) {
+	return c.sendScalarOperationQuery(id, OperationAdd, scalar)
+}
+
+//SendScalarSubQuery sends a query to subtract scalar from all the slots of ciphertext id.
+func (c *API) SendScalarSubQuery(id uuid.UUID, scalar uint64) (uuid.UUID, error) {
+	return c.sendScalarOperationQuery(id, OperationSub, scalar)
+}
+
+//SendScalarMultiplyQuery sends a query to multiply ciphertext id by scalar.
+func (c *API) SendScalarMultiplyQuery(id uuid.UUID, scalar uint64) (uuid.UUID, error) {
+	return c.sendScalarOperationQuery(id, OperationMul, scalar)
+}
+
+//SendInnerSumQuery sends a query to sum all the slots of ciphertext id. Every slot of the result contains the sum.
+func (c *API) SendInnerSumQuery(id uuid.UUID) (uuid.UUID, error) {
+	query := InnerSumQuery{
+		UUID: id,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of inner sum query :", result.Id)
+	return result.Id, nil
+}
+
+//SendInnerProductQuery sends a query for the inner product of ciphertexts id1 and id2. Every slot of the result contains the inner product.
+func (c *API) SendInnerProductQuery(id1, id2 uuid.UUID) (uuid.UUID, error) {
+	query := InnerProductQuery{
+		UUID:  id1,
+		Other: id2,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of inner product query :", result.Id)
+	return result.Id, nil
+}
+
+//SendReplicateQuery sends a query to replicate the value of slot of ciphertext id in all the slots.
+func (c *API) SendReplicateQuery(id uuid.UUID, slot uint64) (uuid.UUID, error) {
+	query := ReplicateQuery{
+		UUID: id,
+		Slot: slot,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of replicate query :", result.Id)
+	return result.Id, nil
+}
+
+//SendMatrixVectorQuery sends a query to multiply the vector id by the plaintext matrix. Returns the id of the result vector.
+func (c *API) SendMatrixVectorQuery(id uuid.UUID, matrix [][]uint64) (uuid.UUID, error) {
+	query := MatrixVectorQuery{
+		UUID: id,
+		Rows: uint64(len(matrix)),
+	}
+	if len(matrix) > 0 {
+		query.Cols = uint64(len(matrix[0]))
+	}
+	query.Matrix = make([]uint64, 0, query.Rows*query.Cols)
+	for _, row := range matrix {
+		if uint64(len(row)) != query.Cols {
+			return uuid.UUID{}, errors.New("rows of the matrix have different lengths")
+		}
+		query.Matrix = append(query.Matrix, row...)
+	}
+
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of matrix vector query :", result.Id)
+	return result.Id, nil
+}
+
+//SendEncryptedMatrixVectorQuery sends a query to multiply the vector id by the matrix stored as its encrypted diagonals.
+//Diagonal i contains M[j][(j+i) mod d] in slot j. Returns the id of the result vector.
+func (c *API) SendEncryptedMatrixVectorQuery(id uuid.UUID, diagonals []uuid.UUID) (uuid.UUID, error) {
+	query := MatrixVectorQuery{
+		UUID:      id,
+		Rows:      uint64(len(diagonals)),
+		Cols:      uint64(len(diagonals)),
+		Diagonals: diagonals,
+	}
+
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of encrypted matrix vector query :", result.Id)
+	return result.Id, nil
+}
+
+//SendPolynomialQuery sends a query to evaluate the polynomial with coefficients coeffs ( constant term first ) on every slot of ciphertext id.
+func (c *API) SendPolynomialQuery(id uuid.UUID, coeffs []uint64) (uuid.UUID, error) {
+	query := PolynomialQuery{
+		UUID:   id,
+		Coeffs: coeffs,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of polynomial query :", result.Id)
+	return result.Id, nil
+}
+
+//SendStatisticsQuery sends a query for the statistic over the columns ids. Returns the ids of the encrypted results, decrypted with GetTypedPlaintext.
+//The histogram needs the number of buckets of the columns, the other statistics ignore it.
+func (c *API) SendStatisticsQuery(statistic Statistic, ids []uuid.UUID, buckets uint64) (*StatisticsReply, error) {
+	query := StatisticsQuery{
+		Statistic: statistic,
+		UUIDs:     ids,
+		Buckets:   buckets,
+	}
+	result := StatisticsReply{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return nil, err
+	}
+	log.Lvl1("Got reply of statistics query :", result)
+	return &result, nil
+}
+
+//GetMean returns the decrypted mean of the columns ids.
+func (c *API) GetMean(ids []uuid.UUID) (float64, error) {
+	result, err := c.SendStatisticsQuery(StatisticMean, ids, 0)
+	if err != nil {
+		return 0, err
+	}
+	sum, err := c.GetTypedPlaintext(&result.Sum)
+	if err != nil {
+		return 0, err
+	}
+	count, err := c.GetTypedPlaintext(&result.Count)
+	if err != nil {
+		return 0, err
+	}
+	return utils.Mean(sum, count)
+}
+
+//GetVariance returns the decrypted variance of the columns ids.
+func (c *API) GetVariance(ids []uuid.UUID) (float64, error) {
+	result, err := c.SendStatisticsQuery(StatisticVariance, ids, 0)
+	if err != nil {
+		return 0, err
+	}
+	squares, err := c.GetTypedPlaintext(&result.SumOfSquares)
+	if err != nil {
+		return 0, err
+	}
+	sum, err := c.GetTypedPlaintext(&result.Sum)
+	if err != nil {
+		return 0, err
+	}
+	count, err := c.GetTypedPlaintext(&result.Count)
+	if err != nil {
+		return 0, err
+	}
+	return utils.Variance(squares, sum, count)
+}
+
+//SendContributionQuery contributes the values to the federated dataset name. The values are encrypted by the server of the entry point,
+//which should be the server of the member holding them, private is the private key of this server. The previous contribution of the member
+//is only replaced if replace is set. Returns the id of the contribution.
+func (c *API) SendContributionQuery(name string, values *utils.TypedValues, replace bool, private kyber.Scalar) (uuid.UUID, error) {
+	subject, err := ContributionSubject(name, c.entryPoint, values, replace)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	signature, err := SignApproval(private, subject)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	query := ContributionQuery{
+		Name:      name,
+		Values:    values,
+		Replace:   replace,
+		Signature: signature,
+	}
+	result := ServiceState{}
+	err = c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of contribution query :", result.Id)
+	return result.Id, nil
+}
+
+//SendAggregationQuery sends a query for the sum of the contributions to the federated dataset name.
+func (c *API) SendAggregationQuery(name string) (uuid.UUID, error) {
+	query := AggregationQuery{
+		Name: name,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of aggregation query :", result.Id)
+	return result.Id, nil
+}
+
+//SendImportCiphertextQuery sends a serialized ciphertext encrypted under the collective public key to be stored.
+//The descriptor gives the type of the values, a zero descriptor means the slots are unsigned values. Returns the UUID of the stored ciphertext.
+func (c *API) SendImportCiphertextQuery(ciphertext []byte, descriptor utils.DataDescriptor) (uuid.UUID, error) {
+	query := ImportCiphertextQuery{
+		Ciphertext: ciphertext,
+		Descriptor: descriptor,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of import query :", result.Id)
+	return result.Id, nil
+}
+
+//SendTransferQuery moves the ciphertext id to the collective of the target roster, which ran its own setup with the same parameters.
+//The ciphertext is switched to the collective public key of the target without decryption. Returns the id of the ciphertext in the target collective.
+func (c *API) SendTransferQuery(id uuid.UUID, target *onet.Roster) (uuid.UUID, error) {
+	return c.SendNoisyTransferQuery(id, target, nil)
+}
+
+//SendNoisyTransferQuery moves the ciphertext id to the collective of the target roster with the differential privacy noise.
+func (c *API) SendNoisyTransferQuery(id uuid.UUID, target *onet.Roster, noise *utils.NoiseParameters) (uuid.UUID, error) {
+	query := TransferQuery{
+		UUID:   id,
+		Target: *target,
+		Noise:  noise,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of transfer query :", result.Id)
+	return result.Id, nil
+}
+
+//RegisterAnalyst registers the public key of the analyst name and the key that signs its downloads ( see AnalystSigningKey ).
+//The members have to approve them before any result is switched to the analyst.
+func (c *API) RegisterAnalyst(name string, pk *bfv.PublicKey, signingKey kyber.Point) error {
+	data, err := pk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	result := ServiceState{}
+	return c.SendProtobuf(c.entryPoint, &AnalystRegistrationQuery{Name: name, PublicKey: data, SigningKey: signingKey}, &result)
+}
+
+//ApproveAnalyst approves the analyst name with the public key pk and the signing key in the name of the member the client is connected to,
+//private is the private key of its server.
+func (c *API) ApproveAnalyst(name string, pk *bfv.PublicKey, signingKey kyber.Point, private kyber.Scalar) error {
+	subject, err := AnalystSubject(name, pk, signingKey)
+	if err != nil {
+		return err
+	}
+	return c.sendApproval(subject, private)
+}
+
+//SendAnalystResultQuery switches the ciphertext id to the key of the approved analyst name. Returns the id of the result held for the analyst.
+func (c *API) SendAnalystResultQuery(name string, id uuid.UUID) (uuid.UUID, error) {
+	return c.SendNoisyAnalystResultQuery(name, id, nil)
+}
+
+//SendNoisyAnalystResultQuery switches the ciphertext id to the key of the analyst name with the differential privacy noise.
+func (c *API) SendNoisyAnalystResultQuery(name string, id uuid.UUID, noise *utils.NoiseParameters) (uuid.UUID, error) {
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &AnalystResultQuery{Name: name, UUID: id, Noise: noise}, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of analyst result query :", result.Id)
+	return result.Id, nil
+}
+
+//DownloadAnalystResult retrieves the serialized result id switched to the key of the analyst name and the descriptor of its values.
+//The download is signed with the private signing key of the analyst.
+func (c *API) DownloadAnalystResult(name string, id uuid.UUID, private kyber.Scalar) ([]byte, utils.DataDescriptor, error) {
+	signature, err := SignDownload(private, name, id)
+	if err != nil {
+		return nil, utils.DataDescriptor{}, err
+	}
+	response := ExportCiphertextReply{}
+	err = c.SendProtobuf(c.entryPoint, &AnalystDownloadQuery{Name: name, UUID: id, Signature: signature}, &response)
+	if err != nil {
+		return nil, utils.DataDescriptor{}, err
+	}
+	return response.Ciphertext, response.Descriptor, nil
+}
+
+//GetCiphertext retrieves the serialized ciphertext stored under id and the descriptor of its values.
+func (c *API) GetCiphertext(id uuid.UUID) ([]byte, utils.DataDescriptor, error) {
+	query := ExportCiphertextQuery{UUID: id}
+	response := ExportCiphertextReply{}
+	err := c.SendProtobuf(c.entryPoint, &query, &response)
+	if err != nil {
+		return nil, utils.DataDescriptor{}, err
+	}
+	return response.Ciphertext, response.Descriptor, nil
+}
+
+//SendDeleteQuery releases the reference to the ciphertext or dataset id. It is removed from the root when no reference is left.
+func (c *API) SendDeleteQuery(id uuid.UUID) error {
+	return c.sendStorageQuery(id, StorageDelete, 0)
+}
+
+//SendRetainQuery adds a reference to the ciphertext or dataset id, for example before sharing it with an other client.
+func (c *API) SendRetainQuery(id uuid.UUID) error {
+	return c.sendStorageQuery(id, StorageRetain, 0)
+}
+
+//SendExpireQuery sets the time to live of the ciphertext or dataset id. A ttl of 0 removes the expiry.
+func (c *API) SendExpireQuery(id uuid.UUID, ttl time.Duration) error {
+	return c.sendStorageQuery(id, StorageExpire, uint64(ttl/time.Second))
+}
+
+//SendCatalogQuery lists the ciphertexts and datasets stored at the root that match the filters of the query.
+//Returns the entries of the page and the total number of matching entries.
+func (c *API) SendCatalogQuery(query *CatalogQuery) ([]CatalogEntry, uint64, error) {
+	response := CatalogReply{}
+	err := c.SendProtobuf(c.entryPoint, query, &response)
+	if err != nil {
+		return nil, 0, err
+	}
+	if response.Error != "" {
+		return nil, 0, errors.New(response.Error)
+	}
+	return response.Entries, response.Total, nil
+}
+
+//SendRegisterNameQuery registers the name for the ciphertext or dataset id. The name can then be resolved with Resolve.
+func (c *API) SendRegisterNameQuery(name string, id uuid.UUID) error {
+	_, err := c.sendNameQuery(&NameQuery{Operation: NameRegister, Name: name, UUID: id})
+	return err
+}
+
+//SendRenameQuery renames name to newName.
+func (c *API) SendRenameQuery(name, newName string) error {
+	_, err := c.sendNameQuery(&NameQuery{Operation: NameRename, Name: name, NewName: newName})
+	return err
+}
+
+//SendAliasQuery registers alias for the ciphertext or dataset of name.
+func (c *API) SendAliasQuery(name, alias string) error {
+	_, err := c.sendNameQuery(&NameQuery{Operation: NameAlias, Name: name, NewName: alias})
+	return err
+}
+
+//SendUnregisterNameQuery removes the name. The ciphertext is removed when no name or id refers to it.
+func (c *API) SendUnregisterNameQuery(name string) error {
+	_, err := c.sendNameQuery(&NameQuery{Operation: NameUnregister, Name: name})
+	return err
+}
+
+//Resolve returns the id of the ciphertext or dataset registered under the name.
+func (c *API) Resolve(name string) (uuid.UUID, error) {
+	return c.sendNameQuery(&NameQuery{Operation: NameResolve, Name: name})
+}
+
+//Reference returns the id for ref, which is either an id or a registered name.
+//The name is resolved when the call is made, the evaluation and decryption queries can instead carry the names
+//so that the root resolves them when it evaluates the query.
+func (c *API) Reference(ref string) (uuid.UUID, error) {
+	if id, err := uuid.FromString(ref); err == nil {
+		return id, nil
+	}
+	return c.Resolve(ref)
+}
+
+//ParseReference returns the id if ref is an id, the name otherwise.
+func ParseReference(ref string) (uuid.UUID, string) {
+	if id, err := uuid.FromString(ref); err == nil {
+		return id, ""
+	}
+	return uuid.Nil, ref
+}
+
+//SendEvaluationQuery sends an evaluation query, its operands can be given by their ids or by their names. Returns the id of the result.
+func (c *API) SendEvaluationQuery(query interface{}) (uuid.UUID, error) {
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of evaluation query :", result.Id)
+	return result.Id, nil
+}
+
+//SubmitSetupJob submits the setup request as a job. Returns the id of the job.
+func (c *API) SubmitSetupJob(request *SetupRequest) (uuid.UUID, error) {
+	return c.submitJob(&SubmitJobQuery{Kind: JobSetup, Setup: request})
+}
+
+//SubmitRefreshJob submits the refresh of the ciphertext id as a job. Returns the id of the job.
+func (c *API) SubmitRefreshJob(id uuid.UUID) (uuid.UUID, error) {
+	return c.submitJob(&SubmitJobQuery{Kind: JobRefresh, Refresh: &RefreshQuery{id, true, nil}})
+}
+
+//SubmitPlaintextJob submits the decryption of the ciphertext id as a job. Returns the id of the job.
+func (c *API) SubmitPlaintextJob(id uuid.UUID) (uuid.UUID, error) {
+	return c.submitJob(&SubmitJobQuery{Kind: JobPlaintext, Plaintext: &QueryPlaintext{UUID: id}})
+}
+
+//SubmitWriteJob submits the write of the typed values as a job. Returns the id of the job.
+func (c *API) SubmitWriteJob(roster *onet.Roster, values *utils.TypedValues) (uuid.UUID, error) {
+	return c.submitJob(&SubmitJobQuery{Kind: JobWrite, Write: &QueryData{Roster: *roster, Values: values}})
+}
+
+//GetJobStatus returns the status of the job without waiting.
+func (c *API) GetJobStatus(jobID uuid.UUID) (*JobReply, error) {
+	return c.sendJobQuery(&JobQuery{JobID: jobID})
+}
+
+//WaitJob waits for the job to finish or for the timeout to expire and returns its status.
+//The error of a failed job is returned as an error.
+func (c *API) WaitJob(jobID uuid.UUID, timeout time.Duration) (*JobReply, error) {
+	reply, err := c.sendJobQuery(&JobQuery{JobID: jobID, Wait: uint64(timeout / time.Millisecond)})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Status == JobFailed {
+		return reply, errors.New(reply.Error)
+	}
+	return reply, nil
+}
+
+//CancelJob cancels the job. A running job finishes but its result is discarded.
+func (c *API) CancelJob(jobID uuid.UUID) error {
+	_, err := c.sendJobQuery(&JobQuery{JobID: jobID, Cancel: true})
+	return err
+}
+
+//GetStatus returns the status of the setup of every node of the roster and whether they agree on it.
+func (c *API) GetStatus() (*StatusReply, error) {
+	reply := StatusReply{}
+	err := c.SendProtobuf(c.entryPoint, &StatusQuery{}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+//GetPublicKey returns the collective public key with its fingerprint.
+func (c *API) GetPublicKey() (*bfv.PublicKey, string, error) {
+	data, fingerprint, err := c.getCollectiveKey(KeyPublic)
+	if err != nil {
+		return nil, "", err
+	}
+	pk := new(bfv.PublicKey)
+	return pk, fingerprint, pk.UnmarshalBinary(data)
+}
+
+//GetEvaluationKey returns the collective relinearization key with its fingerprint.
+func (c *API) GetEvaluationKey() (*bfv.EvaluationKey, string, error) {
+	data, fingerprint, err := c.getCollectiveKey(KeyEvaluation)
+	if err != nil {
+		return nil, "", err
+	}
+	evk := new(bfv.EvaluationKey)
+	return evk, fingerprint, evk.UnmarshalBinary(data)
+}
+
+//GetRotationKeys returns the collective rotation keys with their fingerprint.
+func (c *API) GetRotationKeys() (*bfv.RotationKeys, string, error) {
+	data, fingerprint, err := c.getCollectiveKey(KeyRotation)
+	if err != nil {
+		return nil, "", err
+	}
+	rtk := new(bfv.RotationKeys)
+	return rtk, fingerprint, rtk.UnmarshalBinary(data)
+}
+
+//VerifyKeyFingerprint asks every server of the roster for the fingerprint of its copy of the key.
+//Returns the number of servers that hold the key with the same fingerprint, or an error if a server holds a different key.
+func (c *API) VerifyKeyFingerprint(roster *onet.Roster, key KeyType, expected string) (int, error) {
+	confirmed := 0
+	for _, si := range roster.List {
+		reply := KeyFingerprintReply{}
+		err := c.SendProtobuf(si, &KeyFingerprintQuery{Key: key}, &reply)
+		if err != nil {
+			return confirmed, err
+		}
+		if reply.Fingerprint == "" {
+			log.Lvl1(c, si, " does not hold the key")
+			continue
+		}
+		if reply.Fingerprint != expected {
+			return confirmed, errors.New(si.String() + " holds a different key")
+		}
+		confirmed++
+	}
+	return confirmed, nil
+}
+
+//GetPublicKeyTranscript gets the transcript of the generation of the verifiable collective public key from the entry server and checks it.
+//Returns the collective public key recomputed from the shares.
+func (c *API) GetPublicKeyTranscript() (*bfv.PublicKey, *PublicKeyTranscriptReply, error) {
+	reply := PublicKeyTranscriptReply{}
+	err := c.SendProtobuf(c.entryPoint, &PublicKeyTranscriptQuery{}, &reply)
+	if err != nil {
+		return nil, nil, err
+	}
+	pk, err := VerifyPublicKeyTranscript(&reply)
+	if err != nil {
+		return nil, &reply, err
+	}
+	log.Lvl1(c, " verified the collective public key from ", len(reply.Shares), " shares")
+	return pk, &reply, nil
+}
+
+//SendRekeyQuery asks the roster to rotate the collective key. The stored ciphertexts are switched to the new key and the old secret key shares are erased.
+//The collective public key held by the client should be retrieved again.
+func (c *API) SendRekeyQuery() error {
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &RekeyQuery{}, &result)
+	if err != nil {
+		return err
+	}
+	log.Lvl1(c, " rotated the collective key")
+	return nil
+}
+
+//SendJoinQuery asks the roster to add the server. The server receives the parameters of the session and a share of a new collective key,
+//the stored ciphertexts are switched to the new key.
+func (c *API) SendJoinQuery(server *network.ServerIdentity) error {
+	return c.sendMembershipQuery(MemberJoin, server)
+}
+
+//SendLeaveQuery asks the roster to remove the server. The server must be online, it takes part in the rotation of the key that excludes it.
+func (c *API) SendLeaveQuery(server *network.ServerIdentity) error {
+	return c.sendMembershipQuery(MemberLeave, server)
+}
+
+//ApproveMembership approves the operation on the server in the name of the member the client is connected to, private is the private key of its server.
+//The approval is only valid until the members change.
+func (c *API) ApproveMembership(op MembershipOperation, server *network.ServerIdentity, private kyber.Scalar) error {
+	status, err := c.GetStatus()
+	if err != nil {
+		return err
+	}
+	if len(status.Nodes) == 0 {
+		return errors.New("no status of the root")
+	}
+	return c.sendApproval(MembershipSubject(op, server, status.Nodes[0].RosterVersion), private)
+}
+
+//ApproveTransferTarget approves the transfers to the collective of the root in the name of the member the client is connected to, private is the private key of its server.
+func (c *API) ApproveTransferTarget(root *network.ServerIdentity, private kyber.Scalar) error {
+	return c.sendApproval(TransferSubject(root), private)
+}
+
+func (c *API) sendApproval(subject string, private kyber.Scalar) error {
+	signature, err := SignApproval(private, subject)
+	if err != nil {
+		return err
+	}
+	result := ServiceState{}
+	err = c.SendProtobuf(c.entryPoint, &ApprovalQuery{Subject: subject, Server: c.entryPoint.ID, Signature: signature}, &result)
+	if err != nil {
+		return err
+	}
+	log.Lvl1(c, " approved ", subject)
+	return nil
+}
+
+func (c *API) sendMembershipQuery(op MembershipOperation, server *network.ServerIdentity) error {
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &MembershipQuery{Operation: op, Server: server}, &result)
+	if err != nil {
+		return err
+	}
+	log.Lvl1(c, " changed the members of the roster")
+	return nil
+}
+
+func (c *API) sendPlaintextOperationQuery(id uuid.UUID, op PlaintextOperation, plaintext []uint64) (uuid.UUID, error) {
+	query := PlaintextOperationQuery{
+		UUID:      id,
+		Operation: op,
+		Plaintext: plaintext,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of plaintext operation query :", result.Id)
+	return result.Id, nil
+}
+
+func (c *API) sendScalarOperationQuery(id uuid.UUID, op PlaintextOperation, scalar uint64) (uuid.UUID, error) {
+	query := ScalarOperationQuery{
+		UUID:      id,
+		Operation: op,
+		Scalar:    scalar,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of scalar operation query :", result.Id)
+	return result.Id, nil
+}
+
+func (c *API) sendStorageQuery(id uuid.UUID, op StorageOperation, ttl uint64) error {
+	query := StorageQuery{
+		UUID:      id,
+		Operation: op,
+		TTL:       ttl,
+	}
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, &query, &result)
+	if err != nil {
+		return err
+	}
+	log.Lvl1("Got reply of storage query :", result.Id)
+	return nil
+}
+
+func (c *API) sendNameQuery(query *NameQuery) (uuid.UUID, error) {
+	result := ServiceState{}
+	err := c.SendProtobuf(c.entryPoint, query, &result)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1("Got reply of name query :", result.Id)
+	return result.Id, nil
+}
+
+func (c *API) submitJob(query *SubmitJobQuery) (uuid.UUID, error) {
+	reply := JobReply{}
+	err := c.SendProtobuf(c.entryPoint, query, &reply)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	log.Lvl1(c, "submitted job :", reply.JobID)
+	return reply.JobID, nil
+}
+
+func (c *API) sendJobQuery(query *JobQuery) (*JobReply, error) {
+	reply := JobReply{}
+	err := c.SendProtobuf(c.entryPoint, query, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+//getCollectiveKey retrieves the serialized key chunk by chunk and checks it against its fingerprint.
+func (c *API) getCollectiveKey(key KeyType) ([]byte, string, error) {
+	data := make([]byte, 0)
+	expected := ""
+	for chunk, chunks := uint64(0), uint64(1); chunk < chunks; chunk++ {
+		reply := CollectiveKeyReply{}
+		err := c.SendProtobuf(c.entryPoint, &CollectiveKeyQuery{Key: key, Chunk: chunk}, &reply)
+		if err != nil {
+			return nil, "", err
+		}
+		if chunk > 0 && reply.Fingerprint != expected {
+			return nil, "", errors.New("key changed while it was retrieved")
+		}
+		chunks = reply.Chunks
+		expected = reply.Fingerprint
+		data = append(data, reply.Data...)
+	}
+	if fingerprint(data) != expected {
+		return nil, "", errors.New("key does not match its fingerprint")
+	}
+	log.Lvl1(c, "retrieved key ", key, " with fingerprint ", expected)
+	return data, expected, nil
+}
+
 //String returns the string representation of the client
 func (c *API) String() string {
 	return "[Client " + c.clientID + "]"
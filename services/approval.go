@@ -0,0 +1,97 @@
+//approval contains the approvals of the members of the roster. The operator of a member approves a subject by signing it with the private key of its server,
+//the root checks the signature with the public key of the member in the roster, so a client that connects to a member can not approve in its name.
+package services
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/utils"
+)
+
+//approvalDomain prefix of the signed subjects, so the signature of an approval can not be used for another purpose.
+const approvalDomain = "lattigo-smc approval : "
+
+//MembershipSubject returns the subject the members approve for the operation on the server. It is only valid for the version of the roster,
+//so the approvals can not be replayed once the members changed.
+func MembershipSubject(op MembershipOperation, server *network.ServerIdentity, rosterVersion uint64) string {
+	return fmt.Sprintf("membership %d of %s %s at version %d", op, server.ID, server.Public, rosterVersion)
+}
+
+//ContributionSubject returns the subject the operator of the member signs to contribute the values to the federated dataset name,
+//and to replace its previous contribution if replace is set.
+func ContributionSubject(name string, server *network.ServerIdentity, values *utils.TypedValues, replace bool) (string, error) {
+	data, err := values.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("contribution to %s of %s %s with values %x replace %t", name, server.ID, server.Public, sha256.Sum256(data), replace), nil
+}
+
+//SignApproval signs the subject with the private key of the server of a member.
+func SignApproval(private kyber.Scalar, subject string) ([]byte, error) {
+	return schnorr.Sign(utils.SUITE, private, []byte(approvalDomain+subject))
+}
+
+//HandleApprovalQuery handler for the operator of a member to approve a subject with the signature of its server.
+func (s *Service) HandleApprovalQuery(query *ApprovalQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got approval of ", query.Subject)
+	if len(query.Signature) == 0 {
+		return nil, errors.New("the approval is not signed")
+	}
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//approve records the approval of the subject by the member if its signature is valid. Should be called by the root.
+func (s *Service) approve(query *ApprovalQuery) error {
+	index, si := s.Roster.Search(query.Server)
+	if index < 0 {
+		return errors.New(query.Server.String() + " is not a member of the roster")
+	}
+	err := verifyApproval(si, query.Subject, query.Signature)
+	if err != nil {
+		return err
+	}
+	s.approvalsLock.Lock()
+	defer s.approvalsLock.Unlock()
+	if s.Approvals[query.Subject] == nil {
+		s.Approvals[query.Subject] = make(map[network.ServerIdentityID]bool)
+	}
+	s.Approvals[query.Subject][si.ID] = true
+	log.Lvl1(query.Subject, " approved by ", si)
+	return nil
+}
+
+//forgetApproval removes the approvals of the subject once it is done, so they can not be used again.
+func (s *Service) forgetApproval(subject string) {
+	s.approvalsLock.Lock()
+	defer s.approvalsLock.Unlock()
+	delete(s.Approvals, subject)
+}
+
+//verifyApproval returns an error if the signature is not the approval of the subject by the server.
+func verifyApproval(si *network.ServerIdentity, subject string, signature []byte) error {
+	err := schnorr.Verify(utils.SUITE, si.Public, []byte(approvalDomain+subject), signature)
+	if err != nil {
+		return errors.New("invalid signature of " + si.String() + " : " + err.Error())
+	}
+	return nil
+}
+
+//approvedBy returns an error if one of the servers did not approve the subject.
+func (s *Service) approvedBy(subject string, servers []*network.ServerIdentity) error {
+	s.approvalsLock.Lock()
+	defer s.approvalsLock.Unlock()
+	for _, si := range servers {
+		if !s.Approvals[subject][si.ID] {
+			return errors.New(si.String() + " did not approve " + subject)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+//catalog contains the listing of the ciphertexts and datasets stored at the root with their metadata.
+package services
+
+import (
+	"errors"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"sort"
+	"time"
+)
+
+//HandleCatalogQuery handler for a client to list the ciphertexts stored at the root.
+func (s *Service) HandleCatalogQuery(query *CatalogQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got catalog query")
+	tree := s.Roster.GenerateBinaryTree()
+	query.QueryID = uuid.NewV1()
+	replies := make(chan CatalogReply, 1)
+	s.repliesLock.Lock()
+	s.CatalogReplies[query.QueryID] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.CatalogReplies, query.QueryID)
+		s.repliesLock.Unlock()
+	}()
+
+	err := s.SendRaw(tree.Root.ServerIdentity, query)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-replies:
+		return &reply, nil
+	case <-time.After(10 * time.Second):
+		return nil, errors.New("timeout while waiting for the catalog")
+	}
+}
+
+//catalog returns the page of the entries that match the filters of the query and the total number of matching entries.
+//The chunks of the datasets are listed only if the query filters on their operation.
+func (s *Service) catalog(query *CatalogQuery) ([]CatalogEntry, uint64) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	entries := make([]CatalogEntry, 0)
+	for id, metadata := range s.Metadata {
+		if !matchCatalog(query, metadata) {
+			continue
+		}
+		if query.Dataset != "" && !s.isContribution(query.Dataset, id) {
+			continue
+		}
+		entry := CatalogEntry{
+			UUID:         id,
+			Created:      metadata.Created,
+			Chunks:       uint64(len(s.chunksLocked(id))),
+			Descriptor:   metadata.Descriptor,
+			Provenance:   metadata.Provenance,
+			Names:        s.namesOf(id),
+			EpsilonSpent: metadata.EpsilonSpent,
+		}
+		for i, chunk := range s.chunksLocked(id) {
+			ct, ok := s.DataBase[chunk]
+			if !ok {
+				continue
+			}
+			if i == 0 {
+				entry.Degree = ct.Degree()
+			}
+			entry.Size += ciphertextSize(ct)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+
+	total := uint64(len(entries))
+	if query.Offset >= total {
+		return []CatalogEntry{}, total
+	}
+	entries = entries[query.Offset:]
+	if query.Limit > 0 && query.Limit < uint64(len(entries)) {
+		entries = entries[:query.Limit]
+	}
+	return entries, total
+}
+
+//matchCatalog returns true if the metadata matches the filters of the query.
+func matchCatalog(query *CatalogQuery, metadata *Metadata) bool {
+	if query.Owner != "" && metadata.Owner != query.Owner {
+		return false
+	}
+	if query.Operation != "" {
+		if metadata.Operation != query.Operation {
+			return false
+		}
+	} else if metadata.Operation == ChunkOperation {
+		return false
+	}
+	if query.CreatedAfter != 0 && metadata.Created.Before(time.Unix(query.CreatedAfter, 0)) {
+		return false
+	}
+	if query.CreatedBefore != 0 && metadata.Created.After(time.Unix(query.CreatedBefore, 0)) {
+		return false
+	}
+	return true
+}
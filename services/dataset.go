@@ -0,0 +1,140 @@
+//dataset contains the handling of the datasets that are too large for one ciphertext. The root stores each chunk of N slots as a ciphertext and keeps a manifest of the chunks.
+//The evaluations are applied chunk by chunk, a single ciphertext being a dataset of one chunk.
+package services
+
+import (
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/onet/v3/log"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/utils"
+	"time"
+)
+
+//ChunkOperation operation of the provenance of the chunks of a dataset.
+const ChunkOperation = "chunk"
+
+//chunks returns the ids of the ciphertexts of the dataset id, or id itself if it is a single ciphertext.
+func (s *Service) chunks(id uuid.UUID) []uuid.UUID {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	return s.chunksLocked(id)
+}
+
+//chunksLocked is chunks with the store lock held.
+func (s *Service) chunksLocked(id uuid.UUID) []uuid.UUID {
+	if dataset, ok := s.Datasets[id]; ok {
+		return dataset.Chunks
+	}
+	return []uuid.UUID{id}
+}
+
+//datasetDescriptor returns the descriptor of all the values of the dataset id.
+func (s *Service) datasetDescriptor(id uuid.UUID) utils.DataDescriptor {
+	s.storeLock.Lock()
+	dataset, ok := s.Datasets[id]
+	s.storeLock.Unlock()
+	if ok {
+		return dataset.Descriptor
+	}
+	return s.descriptor(id)
+}
+
+//storeDataset stores the ciphertexts and returns the id of the dataset. A single ciphertext is stored directly without manifest.
+//The chunks have the operation ChunkOperation and the dataset as input.
+func (s *Service) storeDataset(cts []*bfv.Ciphertext, descriptor utils.DataDescriptor, provenance Provenance) uuid.UUID {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	return s.storeDatasetLocked(cts, descriptor, provenance)
+}
+
+//storeDatasetLocked is storeDataset with the store lock held.
+func (s *Service) storeDatasetLocked(cts []*bfv.Ciphertext, descriptor utils.DataDescriptor, provenance Provenance) uuid.UUID {
+	id := uuid.NewV1()
+	if len(cts) == 1 {
+		s.storeCiphertextLocked(id, cts[0], descriptor, provenance)
+		return id
+	}
+	descriptors := utils.ChunkDescriptors(descriptor, len(cts), 1<<s.Params.LogN, s.Params.T)
+	dataset := &Dataset{Chunks: make([]uuid.UUID, len(cts)), Descriptor: descriptor}
+	for i, ct := range cts {
+		dataset.Chunks[i] = uuid.NewV1()
+		s.storeCiphertextLocked(dataset.Chunks[i], ct, descriptors[i], Provenance{Owner: provenance.Owner, Operation: ChunkOperation, Inputs: []uuid.UUID{id}})
+	}
+	s.Datasets[id] = dataset
+	s.retainInputs(provenance)
+	s.Metadata[id] = &Metadata{Descriptor: descriptor, References: 1, Created: time.Now(), Provenance: provenance}
+	log.Lvl1("Stored dataset ", id, " in ", len(cts), " ciphertexts")
+	return id
+}
+
+//evaluateDataset evaluates chunk by chunk on the datasets ids and stores the result with the descriptor. The datasets should have the same number of chunks.
+//The ids are recorded as the inputs of the provenance.
+func (s *Service) evaluateDataset(descriptor utils.DataDescriptor, provenance Provenance, evaluate func(cts ...*bfv.Ciphertext) (*bfv.Ciphertext, error), ids ...uuid.UUID) (uuid.UUID, error) {
+	chunks := make([][]uuid.UUID, len(ids))
+	for i, id := range ids {
+		chunks[i] = s.chunks(id)
+		if len(chunks[i]) != len(chunks[0]) {
+			return uuid.UUID{}, errors.New("datasets do not have the same number of ciphertexts")
+		}
+	}
+
+	results := make([]*bfv.Ciphertext, len(chunks[0]))
+	for j := range results {
+		cts := make([]*bfv.Ciphertext, len(ids))
+		for i := range ids {
+			ct, err := s.getCiphertext(chunks[i][j])
+			if err != nil {
+				return uuid.UUID{}, err
+			}
+			cts[i] = ct
+		}
+		res, err := evaluate(cts...)
+		if err != nil {
+			return uuid.UUID{}, err
+		}
+		results[j] = res
+	}
+	size := uint64(0)
+	for _, res := range results {
+		size += ciphertextSize(res)
+	}
+	err := s.checkCapacity(size)
+	if err == nil {
+		err = s.checkRekeying()
+	}
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	provenance.Inputs = ids
+	return s.storeDataset(results, descriptor, provenance), nil
+}
+
+//getDataset queries the root for the manifest of the dataset id, or of the dataset registered under name if it is not empty.
+func (s *Service) getDataset(id uuid.UUID, name string) (*Dataset, error) {
+	tree := s.Roster.GenerateBinaryTree()
+	query := &DatasetQuery{QueryID: uuid.NewV1(), UUID: id, Name: name}
+	replies := make(chan DatasetReply, 1)
+	s.repliesLock.Lock()
+	s.DatasetReplies[query.QueryID] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.DatasetReplies, query.QueryID)
+		s.repliesLock.Unlock()
+	}()
+
+	err := s.SendRaw(tree.Root.ServerIdentity, query)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
+		}
+		return &reply.Dataset, nil
+	case <-time.After(10 * time.Second):
+		return nil, errors.New("timeout while waiting for the manifest of " + id.String() + name)
+	}
+}
@@ -1,9 +1,11 @@
 //evaluation contains the handler for different evaluation functionalinities. Evaluation are performed on existing ciphertexts and are the following :
-// Sum of c1,c2; multiply c1,c2; refresh c1; relinearize c1; rotate on c1.
+// Sum of c1,c2; multiply c1,c2; refresh c1; relinearize c1; rotate on c1; operations with a plaintext on c1; sum of the slots of c1;
+// inner product of c1,c2; replication of a slot of c1; product of a matrix and c1; polynomial on c1.
 package services
 
 import (
 	"errors"
+	"github.com/ldsec/lattigo/bfv"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
 	uuid "gopkg.in/satori/go.uuid.v1"
@@ -12,20 +14,37 @@ import (
 	"time"
 )
 
+//evaluationTimeout time to wait for the root to evaluate a query. The root can run a collective refresh during the evaluation.
+const evaluationTimeout = 5 * time.Minute
+
 //HandleSumQuery the client handler for queries of sum of two ciphertext
 //Return the ID of the result of the operation
 func (s *Service) HandleSumQuery(sumQuery *SumQuery) (network.Message, error) {
 	log.Lvl1("Got request to sum up two ciphertext : ", sumQuery.UUID, "+", sumQuery.Other)
 	tree := s.Roster.GenerateBinaryTree()
+	replies := make(chan SumReply, 1)
+	s.repliesLock.Lock()
+	s.SumReplies[*sumQuery] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.SumReplies, *sumQuery)
+		s.repliesLock.Unlock()
+	}()
 	err := s.SendRaw(tree.Root.ServerIdentity, sumQuery)
 	if err != nil {
 		return nil, err
 	}
 
-	s.SumReplies[*sumQuery] = make(chan uuid.UUID)
-	id := <-s.SumReplies[*sumQuery]
-
-	return &ServiceState{id, false}, nil
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
+		}
+		return &ServiceState{reply.UUID, false}, nil
+	case <-time.After(evaluationTimeout):
+		return nil, errors.New("timeout while waiting for the sum")
+	}
 }
 
 //HandleMultiplyQuery handler for queries of multiply of two ciphertext
@@ -33,16 +52,29 @@ func (s *Service) HandleSumQuery(sumQuery *SumQuery) (network.Message, error) {
 func (s *Service) HandleMultiplyQuery(query *MultiplyQuery) (network.Message, error) {
 	log.Lvl1("Got request to multiply two ciphertext : ", query.UUID, "+", query.Other)
 	tree := s.Roster.GenerateBinaryTree()
+	replies := make(chan MultiplyReply, 1)
+	s.repliesLock.Lock()
+	s.MultiplyReplies[*query] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.MultiplyReplies, *query)
+		s.repliesLock.Unlock()
+	}()
 	err := s.SendRaw(tree.Root.ServerIdentity, query)
 	if err != nil {
 		return nil, err
 	}
 
-	s.MultiplyReplies[*query] = make(chan uuid.UUID)
-	id := <-s.MultiplyReplies[*query]
-
-	return &ServiceState{id, false}, nil
-
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
+		}
+		return &ServiceState{reply.UUID, false}, nil
+	case <-time.After(evaluationTimeout):
+		return nil, errors.New("timeout while waiting for the multiplication")
+	}
 }
 
 //HandleRefreshQuery handler for queries for a refresh of a ciphertext
@@ -70,7 +102,20 @@ func (s *Service) HandleRefreshQuery(query *RefreshQuery) (network.Message, erro
 func (s *Service) refreshProto(query *RefreshQuery) error {
 	tree := s.GenerateBinaryTree()
 	if tree.Root.ServerIdentity.Equal(s.ServerIdentity()) {
+		s.storeLock.Lock()
+		dataset, isDataset := s.Datasets[query.UUID]
 		cipher, ok := s.DataBase[query.UUID]
+		s.storeLock.Unlock()
+		if isDataset {
+			//refresh the chunks one after the other.
+			for _, id := range dataset.Chunks {
+				err := s.refreshProto(&RefreshQuery{UUID: id})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
 		if !ok {
 			log.Error("Ciphertext non existent", query.UUID)
 			return errors.New("cipher does not exist")
@@ -108,7 +153,10 @@ func (s *Service) refreshProto(query *RefreshQuery) error {
 		go refresh.Dispatch()
 
 		refresh.Wait()
-		s.DataBase[query.UUID] = &refresh.Ciphertext
+		if refresh.Err != nil {
+			return refresh.Err
+		}
+		s.replaceCiphertexts(map[uuid.UUID]*bfv.Ciphertext{query.UUID: &refresh.FinalCiphertext})
 	} else {
 		if query.Ciphertext != nil {
 			//put it in the channel
@@ -122,15 +170,9 @@ func (s *Service) refreshProto(query *RefreshQuery) error {
 //HandleRelinearizationQuery query for a ciphertext to be relinearized.
 func (s *Service) HandleRelinearizationQuery(query *RelinQuery) (network.Message, error) {
 	log.Lvl1("Got request to relinearize: ", query.UUID)
-	tree := s.Roster.GenerateBinaryTree()
-	err := s.SendRaw(tree.Root.ServerIdentity, query)
-	if err != nil {
-		return nil, err
-	}
-
-	//this returns the id that was requested as the server will store it with the same id.
-	return &ServiceState{query.UUID, false}, nil
-
+	//the root relinearizes the ciphertext in place and replies with its id, or with the error if the name is not registered.
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
 }
 
 //HandleRotationQuery handles a query for a rotation. Return the id of the rotated ciphertext.
@@ -141,14 +183,139 @@ func (s *Service) HandleRotationQuery(query *RotationQuery) (network.Message, er
 		log.Lvl1("Key has not been generated ! ")
 		return &ServiceState{uuid.UUID{}, false}, nil
 	}
+	replies := make(chan RotationReply, 1)
+	s.repliesLock.Lock()
+	s.RotationReplies[query.UUID] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.RotationReplies, query.UUID)
+		s.repliesLock.Unlock()
+	}()
 	err := s.SendRaw(tree.Root.ServerIdentity, query)
 	if err != nil {
 		return nil, err
 	}
 
-	s.RotationReplies[query.UUID] = make(chan uuid.UUID)
-	res := <-s.RotationReplies[query.UUID]
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
+		}
+		return &ServiceState{reply.New, false}, nil
+	case <-time.After(evaluationTimeout):
+		return nil, errors.New("timeout while waiting for the rotation")
+	}
+}
 
-	return &ServiceState{res, false}, nil
+//HandleSubQuery handler for queries of subtraction of two ciphertext
+//Return the ID of the result of the operation
+func (s *Service) HandleSubQuery(query *SubQuery) (network.Message, error) {
+	log.Lvl1("Got request to subtract two ciphertext : ", query.UUID, "-", query.Other)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
 
+//HandleNegQuery handler for queries of negation of a ciphertext
+//Return the ID of the result of the operation
+func (s *Service) HandleNegQuery(query *NegQuery) (network.Message, error) {
+	log.Lvl1("Got request to negate ciphertext : ", query.UUID)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//HandlePlaintextOperationQuery handler for queries of operations between a ciphertext and a plaintext vector
+//Return the ID of the result of the operation
+func (s *Service) HandlePlaintextOperationQuery(query *PlaintextOperationQuery) (network.Message, error) {
+	log.Lvl1("Got request for plaintext operation ", query.Operation, " on : ", query.UUID)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//HandleScalarOperationQuery handler for queries of operations between a ciphertext and a scalar
+//Return the ID of the result of the operation
+func (s *Service) HandleScalarOperationQuery(query *ScalarOperationQuery) (network.Message, error) {
+	log.Lvl1("Got request for scalar operation ", query.Operation, " on : ", query.UUID)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//HandleInnerSumQuery handler for queries of the sum of all the slots of a ciphertext
+//Return the ID of the result of the operation
+func (s *Service) HandleInnerSumQuery(query *InnerSumQuery) (network.Message, error) {
+	log.Lvl1("Got request for inner sum of : ", query.UUID)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//HandleInnerProductQuery handler for queries of the inner product of two ciphertexts
+//Return the ID of the result of the operation
+func (s *Service) HandleInnerProductQuery(query *InnerProductQuery) (network.Message, error) {
+	log.Lvl1("Got request for inner product of : ", query.UUID, ".", query.Other)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//HandleReplicateQuery handler for queries of replication of a slot of a ciphertext
+//Return the ID of the result of the operation
+func (s *Service) HandleReplicateQuery(query *ReplicateQuery) (network.Message, error) {
+	log.Lvl1("Got request to replicate slot ", query.Slot, " of : ", query.UUID)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//HandleMatrixVectorQuery handler for queries of the product of a matrix and a ciphertext
+//Return the ID of the result of the operation
+func (s *Service) HandleMatrixVectorQuery(query *MatrixVectorQuery) (network.Message, error) {
+	log.Lvl1("Got request for matrix vector product on : ", query.UUID)
+	if len(query.Diagonals) == 0 && uint64(len(query.Matrix)) != query.Rows*query.Cols {
+		return nil, errors.New("matrix size does not match its dimensions")
+	}
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//HandlePolynomialQuery handler for queries of evaluation of a polynomial on a ciphertext
+//Return the ID of the result of the operation
+func (s *Service) HandlePolynomialQuery(query *PolynomialQuery) (network.Message, error) {
+	log.Lvl1("Got request to evaluate a polynomial on : ", query.UUID)
+	if len(query.Coeffs) == 0 {
+		return nil, errors.New("polynomial has no coefficients")
+	}
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//sendEvaluationQuery sends the query to the root and waits for the ID of the result.
+func (s *Service) sendEvaluationQuery(queryID uuid.UUID, query interface{}) (network.Message, error) {
+	tree := s.Roster.GenerateBinaryTree()
+	return s.sendQuery(tree.Root.ServerIdentity, queryID, query)
+}
+
+//sendQuery sends the query to the root and waits for the ID of the result. The root can be the one of another collective.
+func (s *Service) sendQuery(root *network.ServerIdentity, queryID uuid.UUID, query interface{}) (network.Message, error) {
+	replies := make(chan EvaluationReply, 1)
+	s.repliesLock.Lock()
+	s.EvaluationReplies[queryID] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.EvaluationReplies, queryID)
+		s.repliesLock.Unlock()
+	}()
+
+	err := s.SendRaw(root, query)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
+		}
+		return &ServiceState{reply.UUID, false}, nil
+	case <-time.After(evaluationTimeout):
+		return nil, errors.New("timeout while waiting for the result of query " + queryID.String())
+	}
 }
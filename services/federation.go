@@ -0,0 +1,216 @@
+//federation contains the federated datasets : every member of the roster holds its own local data, encrypts it under the collective public key
+//and contributes it to a dataset of the root under a name. The values never leave the member, only the ciphertexts are sent to the root.
+//Each contribution is stored with the member as owner, so its provenance and privacy budget are per contributor, and the root sums the contributions homomorphically.
+package services
+
+import (
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/utils"
+	"sort"
+)
+
+//ContributionOperation operation of the provenance of the contributions to a federated dataset.
+const ContributionOperation = "contribution"
+
+//Federation federated dataset of the root : the type of its values and the contribution of every member, indexed by the member.
+type Federation struct {
+	Descriptor    utils.DataDescriptor
+	Contributions map[string]uuid.UUID
+}
+
+//HandleContributionQuery handler for a member to contribute its local values to a federated dataset. The values are encrypted by this server,
+//the contribution should be signed by its operator with the private key of this server.
+//Return the ID of the contribution
+func (s *Service) HandleContributionQuery(query *ContributionQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got contribution to ", query.Name)
+	if query.Values == nil {
+		return nil, errors.New("contribution has no values")
+	}
+	subject, err := ContributionSubject(query.Name, s.ServerIdentity(), query.Values, query.Replace)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyApproval(s.ServerIdentity(), subject, query.Signature)
+	if err != nil {
+		return nil, err
+	}
+	query.Signature = nil
+	cts, err := s.encryptValues(query.Values)
+	if err != nil {
+		return nil, err
+	}
+	query.Ciphertexts = make([][]byte, len(cts))
+	for i, ct := range cts {
+		query.Ciphertexts[i], err = ct.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+	}
+	query.Descriptor = query.Values.Descriptor
+	//the plaintext values stay at the member.
+	query.Values = nil
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//HandleAggregationQuery handler for queries of the sum of the contributions to a federated dataset
+//Return the ID of the result of the operation
+func (s *Service) HandleAggregationQuery(query *AggregationQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got aggregation of ", query.Name)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//contribute stores the contribution of the member to the federated dataset. The previous contribution of the member is only replaced if
+//the query asks for it. Should be called by the root.
+func (s *Service) contribute(member *network.ServerIdentity, query *ContributionQuery) (uuid.UUID, error) {
+	if err := validateName(query.Name); err != nil {
+		return uuid.Nil, err
+	}
+	if index, _ := s.Roster.Search(member.ID); index < 0 {
+		return uuid.Nil, errors.New(member.String() + " is not a member of the roster")
+	}
+	switch query.Descriptor.Type {
+	case utils.TypeUint, utils.TypeInt, utils.TypeFixed, utils.TypeBool:
+	default:
+		return uuid.Nil, errors.New("federated datasets need numeric values")
+	}
+	if len(query.Ciphertexts) == 0 {
+		return uuid.Nil, errors.New("contribution has no ciphertexts")
+	}
+	if err := s.validateDescriptor(query.Descriptor, len(query.Ciphertexts)); err != nil {
+		return uuid.Nil, err
+	}
+	cts := make([]*bfv.Ciphertext, len(query.Ciphertexts))
+	size := uint64(0)
+	for i, data := range query.Ciphertexts {
+		ct, err := s.unmarshalCiphertext(data)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		cts[i] = ct
+		size += ciphertextSize(ct)
+	}
+	if err := s.checkRekeying(); err != nil {
+		return uuid.Nil, err
+	}
+
+	//the members contribute concurrently, the contribution is checked and stored under the same lock.
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	federation, ok := s.Federations[query.Name]
+	if ok && (federation.Descriptor.Type != query.Descriptor.Type || federation.Descriptor.Scale != query.Descriptor.Scale) {
+		return uuid.Nil, errors.New("contribution does not have the type of the dataset " + query.Name)
+	}
+	previous, replaced := uuid.Nil, false
+	if ok {
+		previous, replaced = federation.Contributions[member.String()]
+	}
+	if replaced && !query.Replace {
+		return uuid.Nil, errors.New(member.String() + " already contributed to " + query.Name + ", the replacement should be explicit")
+	}
+	if !replaced && query.Replace {
+		return uuid.Nil, errors.New(member.String() + " has no contribution to " + query.Name + " to replace")
+	}
+	if err := s.checkCapacityLocked(size); err != nil {
+		return uuid.Nil, err
+	}
+
+	if !ok {
+		federation = &Federation{
+			Descriptor:    utils.DataDescriptor{Type: query.Descriptor.Type, Scale: query.Descriptor.Scale},
+			Contributions: make(map[string]uuid.UUID),
+		}
+		s.Federations[query.Name] = federation
+	}
+	id := s.storeDatasetLocked(cts, query.Descriptor, Provenance{Owner: member.String(), Operation: ContributionOperation})
+	if replaced {
+		log.Lvl1("Replacing the contribution ", previous, " of ", member)
+		s.releaseLocked(previous)
+	}
+	federation.Contributions[member.String()] = id
+	log.Lvl1("Stored contribution ", id, " of ", member, " to ", query.Name)
+	return id, nil
+}
+
+//contributions returns the ids of the contributions to the federated dataset, ordered by member, and the descriptor of the dataset.
+func (s *Service) contributions(name string) ([]uuid.UUID, utils.DataDescriptor, error) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	federation, ok := s.Federations[name]
+	if !ok {
+		return nil, utils.DataDescriptor{}, errors.New("federated dataset " + name + " does not exist")
+	}
+	members := make([]string, 0, len(federation.Contributions))
+	for member := range federation.Contributions {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	ids := make([]uuid.UUID, len(members))
+	for i, member := range members {
+		ids[i] = federation.Contributions[member]
+		if _, ok := s.Metadata[ids[i]]; !ok {
+			return nil, utils.DataDescriptor{}, errors.New("contribution of " + member + " was removed")
+		}
+	}
+	return ids, federation.Descriptor, nil
+}
+
+//isContribution returns true if the ciphertext or dataset id is a contribution to the federated dataset. The store lock should be held.
+func (s *Service) isContribution(name string, id uuid.UUID) bool {
+	federation, ok := s.Federations[name]
+	if !ok {
+		return false
+	}
+	for _, contribution := range federation.Contributions {
+		if uuid.Equal(contribution, id) {
+			return true
+		}
+	}
+	return false
+}
+
+//aggregate sums the contributions to the federated dataset chunk by chunk and stores the result. The shorter contributions count as zeros.
+//Should be called by the root.
+func (s *Service) aggregate(server *network.ServerIdentity, name string) (uuid.UUID, error) {
+	ids, descriptor, err := s.contributions(name)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	eval := bfv.NewEvaluator(s.Params)
+	if descriptor.Type == utils.TypeBool {
+		descriptor.Type = utils.TypeUint
+	}
+	results := make([]*bfv.Ciphertext, 0)
+	for _, id := range ids {
+		if length := s.datasetDescriptor(id).Length; length > descriptor.Length {
+			descriptor.Length = length
+		}
+		for j, chunk := range s.chunks(id) {
+			ct, err := s.getCiphertext(chunk)
+			if err != nil {
+				return uuid.Nil, err
+			}
+			if j == len(results) {
+				results = append(results, bfv.NewCiphertext(s.Params, 1))
+			}
+			results[j] = eval.AddNew(results[j], ct)
+		}
+	}
+	size := uint64(0)
+	for _, res := range results {
+		size += ciphertextSize(res)
+	}
+	err = s.checkCapacity(size)
+	if err == nil {
+		err = s.checkRekeying()
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return s.storeDataset(results, descriptor, Provenance{Owner: server.String(), Operation: "aggregate", Inputs: ids}), nil
+}
@@ -0,0 +1,202 @@
+//jobs contains the asynchronous execution of the long-running queries : the setup, the refresh, the decryption and the write.
+//The server that receives the query runs it as a job and replies with the job id right away. The jobs are executed one after the other
+//and are kept by the server, so they survive the disconnection of the client that submitted them. A job waits for the root for a bounded
+//time and stops waiting when it is cancelled, so it can not hold the queue. The finished jobs are kept for jobRetention.
+package services
+
+import (
+	"errors"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"sync"
+	"time"
+)
+
+//jobQueueSize maximum number of jobs waiting to be executed by a server.
+const jobQueueSize = 64
+
+//jobRetention time a finished job is kept for its client to get the result.
+const jobRetention = 10 * time.Minute
+
+var errJobCancelled = errors.New("job cancelled")
+
+//Job a query executed asynchronously by the server.
+type Job struct {
+	sync.Mutex
+	ID     uuid.UUID
+	Query  *SubmitJobQuery
+	Status JobStatus
+	Error  string
+	Result network.Message
+	//cancelled is set when the client cancels the job. A running job stops at its next wait for the root, its result is discarded.
+	cancelled bool
+	//cancel is closed when the job is cancelled.
+	cancel chan struct{}
+	//done is closed when the job is done or failed.
+	done chan struct{}
+	//finished time at which the job was done or failed.
+	finished time.Time
+}
+
+//HandleSubmitJobQuery handler for a client to submit a job. Replies with the id of the job.
+func (s *Service) HandleSubmitJobQuery(query *SubmitJobQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got job of kind : ", query.Kind)
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	job := &Job{ID: uuid.NewV1(), Query: query, Status: JobQueued, cancel: make(chan struct{}), done: make(chan struct{})}
+	s.jobsLock.Lock()
+	s.pruneJobs()
+	s.Jobs[job.ID] = job
+	s.jobsLock.Unlock()
+
+	select {
+	case s.jobQueue <- job:
+	default:
+		s.finishJob(job, nil, errors.New("too many jobs are queued"))
+	}
+	return job.reply(), nil
+}
+
+//HandleJobQuery handler for a client to poll, wait for or cancel a job. Replies with the status of the job.
+func (s *Service) HandleJobQuery(query *JobQuery) (network.Message, error) {
+	s.jobsLock.Lock()
+	job, ok := s.Jobs[query.JobID]
+	s.jobsLock.Unlock()
+	if !ok {
+		return nil, errors.New("job " + query.JobID.String() + " does not exist")
+	}
+
+	if query.Cancel {
+		log.Lvl1(s.ServerIdentity(), "cancelling job : ", job.ID)
+		job.Lock()
+		finished := job.Status == JobDone || job.Status == JobFailed
+		if !finished && !job.cancelled {
+			job.cancelled = true
+			close(job.cancel)
+		}
+		queued := job.Status == JobQueued
+		job.Unlock()
+		if finished {
+			return nil, errors.New("job " + job.ID.String() + " is already finished")
+		}
+		if queued {
+			s.finishJob(job, nil, nil)
+		}
+		return job.reply(), nil
+	}
+
+	if query.Wait > 0 {
+		select {
+		case <-job.done:
+		case <-time.After(time.Duration(query.Wait) * time.Millisecond):
+		}
+	}
+	return job.reply(), nil
+}
+
+//runJobs executes the queued jobs one after the other.
+func (s *Service) runJobs() {
+	for job := range s.jobQueue {
+		job.Lock()
+		if job.cancelled {
+			job.Unlock()
+			continue
+		}
+		job.Status = JobRunning
+		job.Unlock()
+
+		log.Lvl1(s.ServerIdentity(), "running job : ", job.ID)
+		result, err := s.runJob(job.Query, job.cancel)
+		s.finishJob(job, result, err)
+	}
+}
+
+//pruneJobs removes the jobs finished for more than jobRetention. The lock of the jobs should be held.
+func (s *Service) pruneJobs() {
+	for id, job := range s.Jobs {
+		job.Lock()
+		expired := !job.finished.IsZero() && time.Since(job.finished) > jobRetention
+		job.Unlock()
+		if expired {
+			delete(s.Jobs, id)
+		}
+	}
+}
+
+//runJob executes the query of the job with the handler of the synchronous query. The waits of the decryption and the write stop when cancel is closed.
+func (s *Service) runJob(query *SubmitJobQuery, cancel <-chan struct{}) (network.Message, error) {
+	switch query.Kind {
+	case JobSetup:
+		result, err := s.HandleSetupQuery(query.Setup)
+		if err == nil && result.(*SetupReply).Done < 0 {
+			err = errors.New("setup failed")
+		}
+		return result, err
+	case JobRefresh:
+		return s.HandleRefreshQuery(query.Refresh)
+	case JobPlaintext:
+		return s.retrievePlaintext(query.Plaintext, cancel)
+	case JobWrite:
+		return s.sendData(query.Write, cancel)
+	default:
+		return nil, errors.New("unknown job kind")
+	}
+}
+
+//finishJob records the result of the job. A cancelled job fails whatever its result.
+func (s *Service) finishJob(job *Job, result network.Message, err error) {
+	job.Lock()
+	defer job.Unlock()
+	switch {
+	case job.cancelled:
+		job.Status = JobFailed
+		job.Error = errJobCancelled.Error()
+	case err != nil:
+		log.Error("Job ", job.ID, " failed : ", err)
+		job.Status = JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = JobDone
+		job.Result = result
+	}
+	job.finished = time.Now()
+	close(job.done)
+}
+
+//reply returns the status of the job and its result if it is done.
+func (job *Job) reply() *JobReply {
+	job.Lock()
+	defer job.Unlock()
+	reply := &JobReply{JobID: job.ID, Status: job.Status, Error: job.Error}
+	switch result := job.Result.(type) {
+	case *ServiceState:
+		reply.UUID = result.Id
+	case *PlaintextReply:
+		reply.UUID = result.UUID
+		reply.Plaintext = result
+	}
+	return reply
+}
+
+//validate returns an error if the query of the kind of the job is missing.
+func (query *SubmitJobQuery) validate() error {
+	var missing bool
+	switch query.Kind {
+	case JobSetup:
+		missing = query.Setup == nil
+	case JobRefresh:
+		missing = query.Refresh == nil
+	case JobPlaintext:
+		missing = query.Plaintext == nil
+	case JobWrite:
+		missing = query.Write == nil
+	default:
+		return errors.New("unknown job kind")
+	}
+	if missing {
+		return errors.New("job has no query for its kind")
+	}
+	return nil
+}
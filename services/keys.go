@@ -0,0 +1,179 @@
+//keys contains the retrieval of the collective keys by the client. The root sends the serialized key in chunks since the rotation keys are large,
+//with the fingerprint of the whole key. The client can cross-check the fingerprint against the copies of the key held by the other servers.
+//If the public key is verifiable, the client can also get the shares of all the nodes and recompute the key.
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"github.com/ldsec/lattigo/dbfv"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/protocols"
+	"time"
+)
+
+//keyChunkSize size in bytes of the chunks of the serialized keys.
+const keyChunkSize = 1 << 20
+
+//HandleCollectiveKeyQuery handler for a client to get a chunk of a collective key from the root.
+func (s *Service) HandleCollectiveKeyQuery(query *CollectiveKeyQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got query for chunk ", query.Chunk, " of key ", query.Key)
+	tree := s.Roster.GenerateBinaryTree()
+	query.QueryID = uuid.NewV1()
+	replies := make(chan CollectiveKeyReply, 1)
+	s.repliesLock.Lock()
+	s.KeyReplies[query.QueryID] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.KeyReplies, query.QueryID)
+		s.repliesLock.Unlock()
+	}()
+
+	err := s.SendRaw(tree.Root.ServerIdentity, query)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
+		}
+		return &reply, nil
+	case <-time.After(10 * time.Second):
+		return nil, errors.New("timeout while waiting for the key")
+	}
+}
+
+//HandleKeyFingerprintQuery handler for a client to get the fingerprint of the copy of the collective key held by this server.
+//The fingerprint is empty if the server does not hold the key.
+func (s *Service) HandleKeyFingerprintQuery(query *KeyFingerprintQuery) (network.Message, error) {
+	reply := &KeyFingerprintReply{}
+	serialized, err := s.serializedCollectiveKey(query.Key)
+	if err == nil {
+		reply.Fingerprint = serialized.fingerprint
+	}
+	return reply, nil
+}
+
+//HandlePublicKeyTranscriptQuery handler for a client to get the transcript of the generation of the collective public key held by this server.
+func (s *Service) HandlePublicKeyTranscriptQuery(query *PublicKeyTranscriptQuery) (network.Message, error) {
+	if len(s.PublicKeyShares) == 0 || s.MasterPublicKey == nil {
+		return nil, errors.New("the collective public key was not generated in the verifiable mode")
+	}
+	reply := &PublicKeyTranscriptReply{Seed: s.Seed, Shares: s.PublicKeyShares}
+	var err error
+	reply.Parameters, err = s.Params.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	reply.PublicKey, err = s.MasterPublicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+//VerifyPublicKeyTranscript recomputes the collective public key from the transcript and checks it against the key of the transcript.
+//The CRP of the key generation is the first one generated from the agreed seed.
+func VerifyPublicKeyTranscript(transcript *PublicKeyTranscriptReply) (*bfv.PublicKey, error) {
+	params := new(bfv.Parameters)
+	err := unmarshalUntrusted(params, transcript.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	crp := dbfv.NewCRPGenerator(params, transcript.Seed).ClockNew()
+	pk, err := protocols.RecomputePublicKey(params, crp, transcript.Shares)
+	if err != nil {
+		return nil, err
+	}
+	data, err := pk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(data, transcript.PublicKey) {
+		return nil, errors.New("the collective public key does not match the shares")
+	}
+	return pk, nil
+}
+
+//serializedKey collective key serialized once for all the chunks, with its fingerprint. It is kept until the key is replaced or the collective key is rotated.
+type serializedKey struct {
+	epoch       uint64
+	source      interface{}
+	data        []byte
+	fingerprint string
+}
+
+//serializedCollectiveKey returns the serialized collective key held by this server. The key is only serialized again once it changed,
+//the rotation keys are large and are downloaded in many chunks.
+func (s *Service) serializedCollectiveKey(key KeyType) (*serializedKey, error) {
+	var source interface{ MarshalBinary() ([]byte, error) }
+	switch key {
+	case KeyPublic:
+		if s.MasterPublicKey != nil {
+			source = s.MasterPublicKey
+		}
+	case KeyEvaluation:
+		if s.EvaluationKey != nil {
+			source = s.EvaluationKey
+		}
+	case KeyRotation:
+		if s.RotationKey != nil {
+			source = s.RotationKey
+		}
+	default:
+		return nil, errors.New("unknown key type")
+	}
+	if source == nil {
+		return nil, errors.New("key has not been generated")
+	}
+	s.keyCacheLock.Lock()
+	defer s.keyCacheLock.Unlock()
+	//the evaluation and rotation keys can be generated again within an epoch, so the cached key is also checked against the current one.
+	if cached, ok := s.keyCache[key]; ok && cached.epoch == s.KeyEpoch && cached.source == source {
+		return cached, nil
+	}
+	data, err := source.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	serialized := &serializedKey{epoch: s.KeyEpoch, source: source, data: data, fingerprint: fingerprint(data)}
+	s.keyCache[key] = serialized
+	return serialized, nil
+}
+
+//keyChunk returns the reply with the chunk of the collective key asked in the query.
+func (s *Service) keyChunk(query *CollectiveKeyQuery) CollectiveKeyReply {
+	reply := CollectiveKeyReply{QueryID: query.QueryID, Key: query.Key, Chunk: query.Chunk}
+	serialized, err := s.serializedCollectiveKey(query.Key)
+	if err != nil {
+		reply.Error = err.Error()
+		return reply
+	}
+	data := serialized.data
+	reply.Chunks = uint64((len(data) + keyChunkSize - 1) / keyChunkSize)
+	if query.Chunk >= reply.Chunks {
+		reply.Error = "chunk is out of range"
+		return reply
+	}
+	start := query.Chunk * keyChunkSize
+	end := start + keyChunkSize
+	if end > uint64(len(data)) {
+		end = uint64(len(data))
+	}
+	reply.Data = data[start:end]
+	reply.Fingerprint = serialized.fingerprint
+	return reply
+}
+
+//fingerprint returns the hexadecimal sha256 of the data.
+func fingerprint(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,190 @@
+//lifecycle contains the management of the lifetime of the ciphertexts stored at the root : explicit deletion, time to live, reference counting and the capacity of the store.
+//A result holds a reference on each of its inputs, so the intermediates of an evaluation are removed once their ids are deleted and all the results computed from them are removed.
+package services
+
+import (
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/onet/v3/log"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"strconv"
+	"time"
+)
+
+//ciphertextSize returns the size in bytes of the coefficients of the ciphertext.
+func ciphertextSize(ct *bfv.Ciphertext) uint64 {
+	size := uint64(0)
+	for _, poly := range ct.Value() {
+		for _, coeffs := range poly.Coeffs {
+			size += 8 * uint64(len(coeffs))
+		}
+	}
+	return size
+}
+
+//storeSize returns the size in bytes of all the ciphertexts stored, with the results held for the analysts. The store lock should be held.
+func (s *Service) storeSize() uint64 {
+	size := uint64(0)
+	for _, metadata := range s.Metadata {
+		size += metadata.Size
+	}
+	for _, analyst := range s.Analysts {
+		for _, result := range analyst.Results {
+			size += ciphertextSize(result.Ciphertext)
+		}
+	}
+	return size
+}
+
+//checkCapacity returns an error if storing size more bytes exceeds the capacity of the store.
+func (s *Service) checkCapacity(size uint64) error {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	return s.checkCapacityLocked(size)
+}
+
+//checkCapacityLocked is checkCapacity with the store lock held.
+func (s *Service) checkCapacityLocked(size uint64) error {
+	if s.StoreCapacity == 0 {
+		return nil
+	}
+	if s.storeSize()+size > s.StoreCapacity {
+		return errors.New("store capacity of " + strconv.FormatUint(s.StoreCapacity, 10) + " bytes exceeded")
+	}
+	return nil
+}
+
+//storageOperation applies the operation of the query on the ciphertext or dataset.
+func (s *Service) storageOperation(query *StorageQuery) error {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	metadata, ok := s.Metadata[query.UUID]
+	if !ok {
+		return errors.New("ciphertext " + query.UUID.String() + " does not exist")
+	}
+	switch query.Operation {
+	case StorageDelete:
+		s.releaseLocked(query.UUID)
+	case StorageRetain:
+		metadata.References++
+	case StorageExpire:
+		if query.TTL == 0 {
+			metadata.Expiry = time.Time{}
+		} else {
+			metadata.Expiry = time.Now().Add(time.Duration(query.TTL) * time.Second)
+		}
+	default:
+		return errors.New("unknown storage operation")
+	}
+	return nil
+}
+
+//garbageCollectionInterval interval between two collections of the expired ciphertexts when no message is processed.
+const garbageCollectionInterval = 10 * time.Second
+
+//scheduleGarbageCollection periodically sends a garbage collection query to the service itself. It stops when the query can not be sent anymore.
+func (s *Service) scheduleGarbageCollection() {
+	for {
+		<-time.After(garbageCollectionInterval)
+		err := s.SendRaw(s.ServerIdentity(), &GarbageCollectionQuery{})
+		if err != nil {
+			log.Lvl2("Stopping the garbage collection : ", err)
+			return
+		}
+	}
+}
+
+//retainInputs adds a reference to the inputs of the provenance of a new result. The chunks of a dataset do not hold a reference on the dataset.
+//The store lock should be held.
+func (s *Service) retainInputs(provenance Provenance) {
+	if provenance.Operation == ChunkOperation {
+		return
+	}
+	for _, input := range provenance.Inputs {
+		if metadata, ok := s.Metadata[input]; ok {
+			metadata.References++
+		}
+	}
+}
+
+//releaseInputs removes the references that a removed result held on its inputs. The store lock should be held.
+func (s *Service) releaseInputs(provenance Provenance) {
+	if provenance.Operation == ChunkOperation {
+		return
+	}
+	for _, input := range provenance.Inputs {
+		s.releaseLocked(input)
+	}
+}
+
+//release removes a reference to the ciphertext or dataset id and removes it if none is left.
+func (s *Service) release(id uuid.UUID) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	s.releaseLocked(id)
+}
+
+//releaseLocked is release with the store lock held.
+func (s *Service) releaseLocked(id uuid.UUID) {
+	metadata, ok := s.Metadata[id]
+	if !ok {
+		return
+	}
+	metadata.References--
+	if metadata.References <= 0 {
+		s.remove(id)
+	}
+}
+
+//remove deletes the ciphertext or dataset id. The chunks of a dataset are released. The store lock should be held.
+func (s *Service) remove(id uuid.UUID) {
+	if dataset, ok := s.Datasets[id]; ok {
+		for _, chunk := range dataset.Chunks {
+			s.releaseLocked(chunk)
+		}
+		delete(s.Datasets, id)
+	}
+	metadata, ok := s.Metadata[id]
+	delete(s.DataBase, id)
+	delete(s.Metadata, id)
+	s.unregisterAll(id)
+	log.Lvl1("Removed ciphertext ", id)
+	if ok {
+		s.releaseInputs(metadata.Provenance)
+	}
+}
+
+//collectGarbage removes the ciphertexts, datasets and results of the analysts that expired.
+func (s *Service) collectGarbage() {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	now := time.Now()
+	for id, metadata := range s.Metadata {
+		if !metadata.Expiry.IsZero() && now.After(metadata.Expiry) {
+			s.remove(id)
+		}
+	}
+	for _, analyst := range s.Analysts {
+		for id, result := range analyst.Results {
+			if now.After(result.Expiry) {
+				delete(analyst.Results, id)
+			}
+		}
+	}
+}
+
+//replaceCiphertexts replaces the stored ciphertexts by their refreshed, relinearized or switched versions, all at once.
+//The ciphertexts removed in the meantime are not stored again.
+func (s *Service) replaceCiphertexts(cts map[uuid.UUID]*bfv.Ciphertext) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	for id, ct := range cts {
+		if _, ok := s.DataBase[id]; !ok {
+			continue
+		}
+		s.DataBase[id] = ct
+		if metadata, ok := s.Metadata[id]; ok {
+			metadata.Size = ciphertextSize(ct)
+		}
+	}
+}
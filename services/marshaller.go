@@ -6,24 +6,50 @@ import (
 	"errors"
 	"github.com/ldsec/lattigo/bfv"
 	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/utils"
+	"math"
+	"strconv"
+	"time"
 )
 
 func (rp *ReplyPlaintext) MarshalBinary() ([]byte, error) {
-	sq := StoreQuery{
-		Ciphertext: rp.Ciphertext,
-		UUID:       rp.UUID,
+	ctD := make([]byte, 0)
+	if rp.Ciphertext != nil {
+		ctD, _ = rp.Ciphertext.MarshalBinary()
+	}
+	idD, err := rp.UUID.MarshalBinary()
+	if err != nil {
+		return []byte{}, err
 	}
-	return sq.MarshalBinary()
+	data := make([]byte, 8, 8+len(ctD)+len(idD)+8+len(rp.Error))
+	binary.BigEndian.PutUint64(data[:8], uint64(len(ctD)))
+	data = append(data, ctD...)
+	data = append(data, idD...)
+	data = append(data, marshalString(rp.Error)...)
+	return data, nil
 }
 func (rp *ReplyPlaintext) UnmarshalBinary(data []byte) error {
-	var sq StoreQuery
-	err := sq.UnmarshalBinary(data)
+	lenCt, pointer, err := unmarshalLength(data, 0, 1)
 	if err != nil {
 		return err
 	}
-	rp.UUID = sq.UUID
-	rp.Ciphertext = sq.Ciphertext
-	return nil
+	if lenCt > 0 {
+		rp.Ciphertext = new(bfv.Ciphertext)
+		err = unmarshalUntrusted(rp.Ciphertext, data[pointer:pointer+lenCt])
+		if err != nil {
+			return err
+		}
+	}
+	pointer += lenCt
+	if len(data) < pointer+uuid.Size {
+		return errors.New("insufficient data size")
+	}
+	err = rp.UUID.UnmarshalBinary(data[pointer : pointer+uuid.Size])
+	if err != nil {
+		return err
+	}
+	rp.Error, _, err = unmarshalString(data, pointer+uuid.Size)
+	return err
 }
 
 func (sq *StoreQuery) MarshalBinary() ([]byte, error) {
@@ -39,10 +65,16 @@ func (sq *StoreQuery) MarshalBinary() ([]byte, error) {
 		return []byte{}, err
 	}
 
+	ddD, err := sq.Descriptor.MarshalBinary()
+	if err != nil {
+		return []byte{}, err
+	}
+
 	lenCt := len(ctD)
 	lenidD := len(idD) // should be 16
+	lenDd := len(ddD)
 
-	data := make([]byte, lenCt+lenidD+8*2) //last 16 bytes are for length of pk and ct
+	data := make([]byte, lenCt+lenidD+lenDd+8)
 	pointer := 0
 
 	binary.BigEndian.PutUint64(data[pointer:pointer+8], uint64(lenCt))
@@ -51,6 +83,8 @@ func (sq *StoreQuery) MarshalBinary() ([]byte, error) {
 	copy(data[pointer:pointer+lenCt], ctD)
 	pointer += lenCt
 	copy(data[pointer:pointer+lenidD], idD)
+	pointer += lenidD
+	copy(data[pointer:pointer+lenDd], ddD)
 
 	return data, nil
 }
@@ -73,8 +107,9 @@ func (sq *StoreQuery) UnmarshalBinary(data []byte) error {
 	if err != nil {
 		return err
 	}
+	pointer += uuid.Size
 
-	return nil
+	return sq.Descriptor.UnmarshalBinary(data[pointer:])
 }
 
 func (qp *QueryPlaintext) MarshalBinary() ([]byte, error) {
@@ -111,6 +146,10 @@ func (qp *QueryPlaintext) MarshalBinary() ([]byte, error) {
 	copy(data[pointer:pointer+lenCt], ctD)
 	pointer += lenCt
 	copy(data[pointer:pointer+lenidD], idD)
+	data = append(data, marshalString(qp.Name)...)
+	if qp.Noise != nil {
+		data = append(data, marshalNoise(qp.Noise)...)
+	}
 
 	return data, nil
 }
@@ -145,111 +184,223 @@ func (qp *QueryPlaintext) UnmarshalBinary(data []byte) error {
 	if err != nil {
 		return err
 	}
+	pointer += uuid.Size
+	if pointer < len(data) {
+		qp.Name, pointer, err = unmarshalString(data, pointer)
+		if err != nil {
+			return err
+		}
+	}
+	if pointer < len(data) {
+		qp.Noise, err = unmarshalNoise(data[pointer:])
+	}
 
-	return nil
+	return err
 
 }
 
+//noiseSize size of the marshalled noise parameters.
+const noiseSize = 5 * 8
+
+//marshalNoise marshals the mechanism, epsilon, delta, sensitivity and slots of the noise.
+func marshalNoise(np *utils.NoiseParameters) []byte {
+	data := make([]byte, noiseSize)
+	binary.BigEndian.PutUint64(data[0:8], uint64(np.Mechanism))
+	binary.BigEndian.PutUint64(data[8:16], math.Float64bits(np.Epsilon))
+	binary.BigEndian.PutUint64(data[16:24], math.Float64bits(np.Delta))
+	binary.BigEndian.PutUint64(data[24:32], math.Float64bits(np.Sensitivity))
+	binary.BigEndian.PutUint64(data[32:40], np.Slots)
+	return data
+}
+
+func unmarshalNoise(data []byte) (*utils.NoiseParameters, error) {
+	if len(data) != noiseSize {
+		return nil, errors.New("invalid size of the noise parameters")
+	}
+	return &utils.NoiseParameters{
+		Mechanism:   utils.NoiseMechanism(binary.BigEndian.Uint64(data[0:8])),
+		Epsilon:     math.Float64frombits(binary.BigEndian.Uint64(data[8:16])),
+		Delta:       math.Float64frombits(binary.BigEndian.Uint64(data[16:24])),
+		Sensitivity: math.Float64frombits(binary.BigEndian.Uint64(data[24:32])),
+		Slots:       binary.BigEndian.Uint64(data[32:40]),
+	}, nil
+}
+
 func (rp *PlaintextReply) MarshalBinary() ([]byte, error) {
-	data := make([]byte, len(rp.Data)+uuid.Size)
-	copy(data[0:len(rp.Data)], rp.Data)
+	valuesD := make([]byte, 0)
+	if rp.Values != nil {
+		valuesD, _ = rp.Values.MarshalBinary()
+	}
+	lenData := len(rp.Data)
+	data := make([]byte, 8+lenData+uuid.Size+len(valuesD))
+	pointer := 0
+	binary.BigEndian.PutUint64(data[pointer:pointer+8], uint64(lenData))
+	pointer += 8
+	copy(data[pointer:pointer+lenData], rp.Data)
+	pointer += lenData
 	id, err := rp.UUID.MarshalBinary()
 
 	if err != nil {
 		return []byte{}, err
 	}
-	copy(data[len(rp.Data):len(rp.Data)+uuid.Size], id)
+	copy(data[pointer:pointer+uuid.Size], id)
+	pointer += uuid.Size
+	copy(data[pointer:], valuesD)
 
 	return data, nil
 }
 
 func (rp *PlaintextReply) UnmarshalBinary(data []byte) error {
-	if len(data) < uuid.Size {
+	if len(data) < 8+uuid.Size {
 		return errors.New("insufficient data size")
 	}
-	lenData := len(data) - uuid.Size
+	lenData, pointer, err := unmarshalLength(data[:len(data)-uuid.Size], 0, 1)
+	if err != nil {
+		return err
+	}
 	rp.Data = make([]byte, lenData)
-	copy(rp.Data, data[:lenData])
-	id := make([]byte, uuid.Size)
-	copy(id, data[len(data)-uuid.Size:])
-	err := rp.UUID.UnmarshalBinary(data[lenData:])
-	return err
+	copy(rp.Data, data[pointer:pointer+lenData])
+	pointer += lenData
+	err = rp.UUID.UnmarshalBinary(data[pointer : pointer+uuid.Size])
+	if err != nil {
+		return err
+	}
+	pointer += uuid.Size
+	if pointer < len(data) {
+		rp.Values = new(utils.TypedValues)
+		return rp.Values.UnmarshalBinary(data[pointer:])
+	}
+	return nil
 }
 
 func (sq *SumQuery) MarshalBinary() ([]byte, error) {
 	data := make([]byte, 32)
 	copy(data[:uuid.Size], sq.UUID.Bytes())
 	copy(data[uuid.Size:], sq.Other.Bytes())
+	if sq.Name != "" || sq.OtherName != "" {
+		data = append(data, marshalString(sq.Name)...)
+		data = append(data, marshalString(sq.OtherName)...)
+	}
 	return data, nil
 }
 
 func (sq *SumQuery) UnmarshalBinary(data []byte) error {
-	if len(data) != 32 {
-		return errors.New("unexpected data size")
+	if len(data) < 32 {
+		return errors.New("insufficient data size")
 	}
 	err := sq.UUID.UnmarshalBinary(data[:uuid.Size])
 	if err != nil {
 		return err
 	}
-	err = sq.Other.UnmarshalBinary(data[uuid.Size:])
-	return err
+	err = sq.Other.UnmarshalBinary(data[uuid.Size:32])
+	if err != nil || len(data) == 32 {
+		return err
+	}
+	var ptr int
+	sq.Name, ptr, err = unmarshalString(data, 32)
+	if err != nil {
+		return err
+	}
+	sq.OtherName, ptr, err = unmarshalString(data, ptr)
+	if err != nil {
+		return err
+	}
+	if ptr != len(data) {
+		return errors.New("unexpected data size")
+	}
+	return nil
 }
 
 func (sr *SumReply) MarshalBinary() ([]byte, error) {
-	data, err := sr.SumQuery.MarshalBinary()
+	query, err := sr.SumQuery.MarshalBinary()
 	if err != nil {
 		return []byte{}, err
 	}
-	data = append(data, sr.UUID.Bytes()...)
+	data := append(sr.UUID.Bytes(), marshalString(sr.Error)...)
+	data = append(data, query...)
 	return data, nil
 
 }
 
 func (sr *SumReply) UnmarshalBinary(data []byte) error {
-	err := sr.SumQuery.UnmarshalBinary(data[:2*uuid.Size])
+	if len(data) < uuid.Size {
+		return errors.New("insufficient data size")
+	}
+	err := sr.UUID.UnmarshalBinary(data[:uuid.Size])
 	if err != nil {
 		return err
 	}
-	err = sr.UUID.UnmarshalBinary(data[2*uuid.Size:])
-	return err
+	var ptr int
+	sr.Error, ptr, err = unmarshalString(data, uuid.Size)
+	if err != nil {
+		return err
+	}
+	return sr.SumQuery.UnmarshalBinary(data[ptr:])
 }
 
 func (mq *MultiplyQuery) MarshalBinary() ([]byte, error) {
 	data := make([]byte, 32)
 	copy(data[:uuid.Size], mq.UUID.Bytes())
 	copy(data[uuid.Size:], mq.Other.Bytes())
+	if mq.Name != "" || mq.OtherName != "" {
+		data = append(data, marshalString(mq.Name)...)
+		data = append(data, marshalString(mq.OtherName)...)
+	}
 	return data, nil
 }
 
 func (mq *MultiplyQuery) UnmarshalBinary(data []byte) error {
-	if len(data) != 32 {
-		return errors.New("unexpected data size")
+	if len(data) < 32 {
+		return errors.New("insufficient data size")
 	}
 	err := mq.UUID.UnmarshalBinary(data[:uuid.Size])
 	if err != nil {
 		return err
 	}
-	err = mq.Other.UnmarshalBinary(data[uuid.Size:])
-	return err
+	err = mq.Other.UnmarshalBinary(data[uuid.Size:32])
+	if err != nil || len(data) == 32 {
+		return err
+	}
+	var ptr int
+	mq.Name, ptr, err = unmarshalString(data, 32)
+	if err != nil {
+		return err
+	}
+	mq.OtherName, ptr, err = unmarshalString(data, ptr)
+	if err != nil {
+		return err
+	}
+	if ptr != len(data) {
+		return errors.New("unexpected data size")
+	}
+	return nil
 }
 
 func (mr *MultiplyReply) MarshalBinary() ([]byte, error) {
-	data, err := mr.MultiplyQuery.MarshalBinary()
+	query, err := mr.MultiplyQuery.MarshalBinary()
 	if err != nil {
 		return []byte{}, err
 	}
-	data = append(data, mr.UUID.Bytes()...)
+	data := append(mr.UUID.Bytes(), marshalString(mr.Error)...)
+	data = append(data, query...)
 	return data, nil
 
 }
 
 func (mr *MultiplyReply) UnmarshalBinary(data []byte) error {
-	err := mr.MultiplyQuery.UnmarshalBinary(data[:2*uuid.Size])
+	if len(data) < uuid.Size {
+		return errors.New("insufficient data size")
+	}
+	err := mr.UUID.UnmarshalBinary(data[:uuid.Size])
 	if err != nil {
 		return err
 	}
-	err = mr.UUID.UnmarshalBinary(data[2*uuid.Size:])
-	return err
+	var ptr int
+	mr.Error, ptr, err = unmarshalString(data, uuid.Size)
+	if err != nil {
+		return err
+	}
+	return mr.MultiplyQuery.UnmarshalBinary(data[ptr:])
 }
 
 func (rq *RefreshQuery) MarshalBinary() ([]byte, error) {
@@ -301,12 +452,13 @@ func (rr *RotationReply) MarshalBinary() ([]byte, error) {
 
 	copy(data[0:uuid.Size], oldD)
 	copy(data[uuid.Size:], newD)
+	data = append(data, marshalString(rr.Error)...)
 	return data, nil
 }
 
 func (rr *RotationReply) UnmarshalBinary(data []byte) error {
-	if len(data) != uuid.Size*2 {
-		return errors.New("unexpected data len have : " + string(len(data)) + " should be 32")
+	if len(data) < uuid.Size*2 {
+		return errors.New("unexpected data len have : " + strconv.Itoa(len(data)) + " should be at least 32")
 	}
 	rr.Old = *new(uuid.UUID)
 	err := rr.Old.UnmarshalBinary(data[:uuid.Size])
@@ -315,8 +467,19 @@ func (rr *RotationReply) UnmarshalBinary(data []byte) error {
 	}
 
 	rr.New = *new(uuid.UUID)
-	err = rr.New.UnmarshalBinary(data[uuid.Size:])
-	return err
+	err = rr.New.UnmarshalBinary(data[uuid.Size : 2*uuid.Size])
+	if err != nil {
+		return err
+	}
+	var ptr int
+	rr.Error, ptr, err = unmarshalString(data, 2*uuid.Size)
+	if err != nil {
+		return err
+	}
+	if ptr != len(data) {
+		return errors.New("unexpected data size")
+	}
+	return nil
 }
 
 func (kr *KeyReply) MarshalBinary() ([]byte, error) {
@@ -401,6 +564,7 @@ func (kr *KeyReply) UnmarshalBinary(data []byte) error {
 		pointer += ekLen
 	}
 	if rkLen > 0 {
+		kr.RotationKeys = new(bfv.RotationKeys)
 		err := kr.RotationKeys.UnmarshalBinary(data[pointer : pointer+rkLen])
 		if err != nil {
 			return err
@@ -424,15 +588,466 @@ func (rq *RotationQuery) MarshalBinary() ([]byte, error) {
 	binary.BigEndian.PutUint64(data[ptr:ptr+8], rq.K)
 	ptr += 8
 	data[ptr] = byte(rq.RotIdx)
+	if rq.Name != "" {
+		data = append(data, marshalString(rq.Name)...)
+	}
 	return data, nil
 
 }
 
 func (rq *RotationQuery) UnmarshalBinary(data []byte) error {
+	if len(data) < uuid.Size+1+8 {
+		return errors.New("insufficient data size")
+	}
 	err := rq.UUID.UnmarshalBinary(data[:uuid.Size])
+	if err != nil {
+		return err
+	}
 	ptr := uuid.Size
 	rq.K = binary.BigEndian.Uint64(data[ptr : ptr+8])
 	ptr += 8
 	rq.RotIdx = int(data[ptr])
+	ptr++
+	if ptr < len(data) {
+		rq.Name, _, err = unmarshalString(data, ptr)
+	}
+	return err
+}
+
+func (mq *MatrixVectorQuery) MarshalBinary() ([]byte, error) {
+	lenMatrix := len(mq.Matrix)
+	lenDiagonals := len(mq.Diagonals)
+	data := make([]byte, 2*uuid.Size+8*4+8*lenMatrix+uuid.Size*lenDiagonals)
+	ptr := 0
+	copy(data[ptr:ptr+uuid.Size], mq.QueryID.Bytes())
+	ptr += uuid.Size
+	copy(data[ptr:ptr+uuid.Size], mq.UUID.Bytes())
+	ptr += uuid.Size
+	binary.BigEndian.PutUint64(data[ptr:ptr+8], mq.Rows)
+	ptr += 8
+	binary.BigEndian.PutUint64(data[ptr:ptr+8], mq.Cols)
+	ptr += 8
+	binary.BigEndian.PutUint64(data[ptr:ptr+8], uint64(lenMatrix))
+	ptr += 8
+	binary.BigEndian.PutUint64(data[ptr:ptr+8], uint64(lenDiagonals))
+	ptr += 8
+	for _, v := range mq.Matrix {
+		binary.BigEndian.PutUint64(data[ptr:ptr+8], v)
+		ptr += 8
+	}
+	for _, id := range mq.Diagonals {
+		copy(data[ptr:ptr+uuid.Size], id.Bytes())
+		ptr += uuid.Size
+	}
+	data = append(data, marshalString(mq.Name)...)
+	return data, nil
+}
+
+func (mq *MatrixVectorQuery) UnmarshalBinary(data []byte) error {
+	if len(data) < 2*uuid.Size+8*4 {
+		return errors.New("insufficient data size")
+	}
+	ptr := 0
+	err := mq.QueryID.UnmarshalBinary(data[ptr : ptr+uuid.Size])
+	if err != nil {
+		return err
+	}
+	ptr += uuid.Size
+	err = mq.UUID.UnmarshalBinary(data[ptr : ptr+uuid.Size])
+	if err != nil {
+		return err
+	}
+	ptr += uuid.Size
+	mq.Rows = binary.BigEndian.Uint64(data[ptr : ptr+8])
+	ptr += 8
+	mq.Cols = binary.BigEndian.Uint64(data[ptr : ptr+8])
+	ptr += 8
+	lenMatrix, ptr, err := unmarshalLength(data, ptr, 8)
+	if err != nil {
+		return err
+	}
+	lenDiagonals, ptr, err := unmarshalLength(data, ptr, uuid.Size)
+	if err != nil {
+		return err
+	}
+	if len(data) < ptr+8*lenMatrix+uuid.Size*lenDiagonals {
+		return errors.New("insufficient data size")
+	}
+	mq.Matrix = make([]uint64, lenMatrix)
+	for i := range mq.Matrix {
+		mq.Matrix[i] = binary.BigEndian.Uint64(data[ptr : ptr+8])
+		ptr += 8
+	}
+	mq.Diagonals = make([]uuid.UUID, lenDiagonals)
+	for i := range mq.Diagonals {
+		err = mq.Diagonals[i].UnmarshalBinary(data[ptr : ptr+uuid.Size])
+		if err != nil {
+			return err
+		}
+		ptr += uuid.Size
+	}
+	mq.Name, ptr, err = unmarshalString(data, ptr)
+	if err != nil {
+		return err
+	}
+	if ptr != len(data) {
+		return errors.New("unexpected data size")
+	}
+	return nil
+}
+
+func (sq *StoreDatasetQuery) MarshalBinary() ([]byte, error) {
+	ddD, err := sq.Descriptor.MarshalBinary()
+	if err != nil {
+		return []byte{}, err
+	}
+	data := append(sq.QueryID.Bytes(), ddD...)
+	lenCts := make([]byte, 8)
+	binary.BigEndian.PutUint64(lenCts, uint64(len(sq.Ciphertexts)))
+	data = append(data, lenCts...)
+	for _, ct := range sq.Ciphertexts {
+		ctD, err := ct.MarshalBinary()
+		if err != nil {
+			return []byte{}, err
+		}
+		lenCt := make([]byte, 8)
+		binary.BigEndian.PutUint64(lenCt, uint64(len(ctD)))
+		data = append(data, lenCt...)
+		data = append(data, ctD...)
+	}
+	return data, nil
+}
+
+func (sq *StoreDatasetQuery) UnmarshalBinary(data []byte) error {
+	lenDd := utils.DescriptorSize
+	if len(data) < uuid.Size+lenDd+8 {
+		return errors.New("insufficient data size")
+	}
+	ptr := 0
+	err := sq.QueryID.UnmarshalBinary(data[ptr : ptr+uuid.Size])
+	if err != nil {
+		return err
+	}
+	ptr += uuid.Size
+	err = sq.Descriptor.UnmarshalBinary(data[ptr : ptr+lenDd])
+	if err != nil {
+		return err
+	}
+	ptr += lenDd
+	//every ciphertext is preceded by its length.
+	lenCts, ptr, err := unmarshalLength(data, ptr, 8)
+	if err != nil {
+		return err
+	}
+	sq.Ciphertexts = make([]*bfv.Ciphertext, lenCts)
+	for i := range sq.Ciphertexts {
+		var lenCt int
+		lenCt, ptr, err = unmarshalLength(data, ptr, 1)
+		if err != nil {
+			return err
+		}
+		sq.Ciphertexts[i] = new(bfv.Ciphertext)
+		err = sq.Ciphertexts[i].UnmarshalBinary(data[ptr : ptr+lenCt])
+		if err != nil {
+			return err
+		}
+		ptr += lenCt
+	}
+	return nil
+}
+
+func (dr *DatasetReply) MarshalBinary() ([]byte, error) {
+	ddD, err := dr.Descriptor.MarshalBinary()
+	if err != nil {
+		return []byte{}, err
+	}
+	data := append(dr.QueryID.Bytes(), ddD...)
+	data = append(data, marshalUUIDs(dr.Chunks)...)
+	data = append(data, []byte(dr.Error)...)
+	return data, nil
+}
+
+func (dr *DatasetReply) UnmarshalBinary(data []byte) error {
+	lenDd := utils.DescriptorSize
+	if len(data) < uuid.Size+lenDd {
+		return errors.New("insufficient data size")
+	}
+	ptr := 0
+	err := dr.QueryID.UnmarshalBinary(data[ptr : ptr+uuid.Size])
+	if err != nil {
+		return err
+	}
+	ptr += uuid.Size
+	err = dr.Descriptor.UnmarshalBinary(data[ptr : ptr+lenDd])
+	if err != nil {
+		return err
+	}
+	ptr += lenDd
+	dr.Chunks, ptr, err = unmarshalUUIDs(data, ptr)
+	if err != nil {
+		return err
+	}
+	dr.Error = string(data[ptr:])
+	return nil
+}
+
+//marshalUUIDs returns the number of ids followed by the ids.
+func marshalUUIDs(ids []uuid.UUID) []byte {
+	data := make([]byte, 8+uuid.Size*len(ids))
+	binary.BigEndian.PutUint64(data[:8], uint64(len(ids)))
+	for i, id := range ids {
+		copy(data[8+i*uuid.Size:8+(i+1)*uuid.Size], id.Bytes())
+	}
+	return data
+}
+
+//unmarshalUUIDs reads the ids marshalled at ptr and returns them with the position after them.
+func unmarshalUUIDs(data []byte, ptr int) ([]uuid.UUID, int, error) {
+	lenIds, ptr, err := unmarshalLength(data, ptr, uuid.Size)
+	if err != nil {
+		return nil, ptr, err
+	}
+	ids := make([]uuid.UUID, lenIds)
+	for i := range ids {
+		err := ids[i].UnmarshalBinary(data[ptr : ptr+uuid.Size])
+		if err != nil {
+			return nil, ptr, err
+		}
+		ptr += uuid.Size
+	}
+	return ids, ptr, nil
+}
+
+func (iq *ImportCiphertextQuery) MarshalBinary() ([]byte, error) {
+	ddD, err := iq.Descriptor.MarshalBinary()
+	if err != nil {
+		return []byte{}, err
+	}
+	data := append(iq.QueryID.Bytes(), ddD...)
+	data = append(data, iq.Ciphertext...)
+	return data, nil
+}
+
+func (iq *ImportCiphertextQuery) UnmarshalBinary(data []byte) error {
+	lenDd := utils.DescriptorSize
+	if len(data) < uuid.Size+lenDd {
+		return errors.New("insufficient data size")
+	}
+	err := iq.QueryID.UnmarshalBinary(data[:uuid.Size])
+	if err != nil {
+		return err
+	}
+	err = iq.Descriptor.UnmarshalBinary(data[uuid.Size : uuid.Size+lenDd])
+	if err != nil {
+		return err
+	}
+	iq.Ciphertext = make([]byte, len(data)-uuid.Size-lenDd)
+	copy(iq.Ciphertext, data[uuid.Size+lenDd:])
+	return nil
+}
+
+func (er *ExportCiphertextReply) MarshalBinary() ([]byte, error) {
+	ddD, err := er.Descriptor.MarshalBinary()
+	if err != nil {
+		return []byte{}, err
+	}
+	data := append(er.QueryID.Bytes(), er.UUID.Bytes()...)
+	data = append(data, ddD...)
+	lenCt := make([]byte, 8)
+	binary.BigEndian.PutUint64(lenCt, uint64(len(er.Ciphertext)))
+	data = append(data, lenCt...)
+	data = append(data, er.Ciphertext...)
+	data = append(data, []byte(er.Error)...)
+	return data, nil
+}
+
+func (er *ExportCiphertextReply) UnmarshalBinary(data []byte) error {
+	lenDd := utils.DescriptorSize
+	if len(data) < 2*uuid.Size+lenDd+8 {
+		return errors.New("insufficient data size")
+	}
+	ptr := 0
+	err := er.QueryID.UnmarshalBinary(data[ptr : ptr+uuid.Size])
+	if err != nil {
+		return err
+	}
+	ptr += uuid.Size
+	err = er.UUID.UnmarshalBinary(data[ptr : ptr+uuid.Size])
+	if err != nil {
+		return err
+	}
+	ptr += uuid.Size
+	err = er.Descriptor.UnmarshalBinary(data[ptr : ptr+lenDd])
+	if err != nil {
+		return err
+	}
+	ptr += lenDd
+	lenCt, ptr, err := unmarshalLength(data, ptr, 1)
+	if err != nil {
+		return err
+	}
+	er.Ciphertext = make([]byte, lenCt)
+	copy(er.Ciphertext, data[ptr:ptr+lenCt])
+	ptr += lenCt
+	er.Error = string(data[ptr:])
+	return nil
+}
+
+func (ce *CatalogEntry) MarshalBinary() ([]byte, error) {
+	ddD, err := ce.Descriptor.MarshalBinary()
+	if err != nil {
+		return []byte{}, err
+	}
+	data := make([]byte, uuid.Size+8*5)
+	copy(data[:uuid.Size], ce.UUID.Bytes())
+	ptr := uuid.Size
+	binary.BigEndian.PutUint64(data[ptr:ptr+8], uint64(ce.Created.UnixNano()))
+	ptr += 8
+	binary.BigEndian.PutUint64(data[ptr:ptr+8], ce.Degree)
+	ptr += 8
+	binary.BigEndian.PutUint64(data[ptr:ptr+8], ce.Size)
+	ptr += 8
+	binary.BigEndian.PutUint64(data[ptr:ptr+8], ce.Chunks)
+	ptr += 8
+	binary.BigEndian.PutUint64(data[ptr:ptr+8], math.Float64bits(ce.EpsilonSpent))
+	data = append(data, ddD...)
+	data = append(data, marshalString(ce.Owner)...)
+	data = append(data, marshalString(ce.Operation)...)
+	data = append(data, marshalUUIDs(ce.Inputs)...)
+	lenNames := make([]byte, 8)
+	binary.BigEndian.PutUint64(lenNames, uint64(len(ce.Names)))
+	data = append(data, lenNames...)
+	for _, name := range ce.Names {
+		data = append(data, marshalString(name)...)
+	}
+	return data, nil
+}
+
+//unmarshalCatalogEntry reads the entry at ptr and returns the position after it.
+func (ce *CatalogEntry) unmarshalCatalogEntry(data []byte, ptr int) (int, error) {
+	lenDd := utils.DescriptorSize
+	if len(data) < ptr+uuid.Size+8*5+lenDd {
+		return ptr, errors.New("insufficient data size")
+	}
+	err := ce.UUID.UnmarshalBinary(data[ptr : ptr+uuid.Size])
+	if err != nil {
+		return ptr, err
+	}
+	ptr += uuid.Size
+	ce.Created = time.Unix(0, int64(binary.BigEndian.Uint64(data[ptr:ptr+8])))
+	ptr += 8
+	ce.Degree = binary.BigEndian.Uint64(data[ptr : ptr+8])
+	ptr += 8
+	ce.Size = binary.BigEndian.Uint64(data[ptr : ptr+8])
+	ptr += 8
+	ce.Chunks = binary.BigEndian.Uint64(data[ptr : ptr+8])
+	ptr += 8
+	ce.EpsilonSpent = math.Float64frombits(binary.BigEndian.Uint64(data[ptr : ptr+8]))
+	ptr += 8
+	err = ce.Descriptor.UnmarshalBinary(data[ptr : ptr+lenDd])
+	if err != nil {
+		return ptr, err
+	}
+	ptr += lenDd
+	ce.Owner, ptr, err = unmarshalString(data, ptr)
+	if err != nil {
+		return ptr, err
+	}
+	ce.Operation, ptr, err = unmarshalString(data, ptr)
+	if err != nil {
+		return ptr, err
+	}
+	ce.Inputs, ptr, err = unmarshalUUIDs(data, ptr)
+	if err != nil {
+		return ptr, err
+	}
+	//every name is preceded by its length.
+	lenNames, ptr, err := unmarshalLength(data, ptr, 8)
+	if err != nil {
+		return ptr, err
+	}
+	ce.Names = make([]string, lenNames)
+	for i := range ce.Names {
+		ce.Names[i], ptr, err = unmarshalString(data, ptr)
+		if err != nil {
+			return ptr, err
+		}
+	}
+	return ptr, nil
+}
+
+func (ce *CatalogEntry) UnmarshalBinary(data []byte) error {
+	_, err := ce.unmarshalCatalogEntry(data, 0)
 	return err
 }
+
+func (cr *CatalogReply) MarshalBinary() ([]byte, error) {
+	data := make([]byte, uuid.Size+8*2)
+	copy(data[:uuid.Size], cr.QueryID.Bytes())
+	binary.BigEndian.PutUint64(data[uuid.Size:uuid.Size+8], cr.Total)
+	binary.BigEndian.PutUint64(data[uuid.Size+8:uuid.Size+16], uint64(len(cr.Entries)))
+	for _, entry := range cr.Entries {
+		entryD, err := entry.MarshalBinary()
+		if err != nil {
+			return []byte{}, err
+		}
+		data = append(data, entryD...)
+	}
+	data = append(data, []byte(cr.Error)...)
+	return data, nil
+}
+
+func (cr *CatalogReply) UnmarshalBinary(data []byte) error {
+	if len(data) < uuid.Size+8*2 {
+		return errors.New("insufficient data size")
+	}
+	err := cr.QueryID.UnmarshalBinary(data[:uuid.Size])
+	if err != nil {
+		return err
+	}
+	cr.Total = binary.BigEndian.Uint64(data[uuid.Size : uuid.Size+8])
+	lenEntries, ptr, err := unmarshalLength(data, uuid.Size+8, 1)
+	if err != nil {
+		return err
+	}
+	cr.Entries = make([]CatalogEntry, lenEntries)
+	for i := range cr.Entries {
+		ptr, err = cr.Entries[i].unmarshalCatalogEntry(data, ptr)
+		if err != nil {
+			return err
+		}
+	}
+	cr.Error = string(data[ptr:])
+	return nil
+}
+
+//marshalString returns the length of the string followed by its bytes.
+func marshalString(s string) []byte {
+	data := make([]byte, 8+len(s))
+	binary.BigEndian.PutUint64(data[:8], uint64(len(s)))
+	copy(data[8:], s)
+	return data
+}
+
+//unmarshalString reads the string marshalled at ptr and returns it with the position after it.
+func unmarshalString(data []byte, ptr int) (string, int, error) {
+	lenS, ptr, err := unmarshalLength(data, ptr, 1)
+	if err != nil {
+		return "", ptr, err
+	}
+	return string(data[ptr : ptr+lenS]), ptr + lenS, nil
+}
+
+//unmarshalLength reads the number of elements marshalled at ptr and returns it with the position after it.
+//The elements have at least size bytes each, so the number is bounded by the remaining data before anything is allocated.
+func unmarshalLength(data []byte, ptr int, size int) (int, int, error) {
+	if len(data) < ptr+8 {
+		return 0, ptr, errors.New("insufficient data size")
+	}
+	length := binary.BigEndian.Uint64(data[ptr : ptr+8])
+	ptr += 8
+	if length > uint64(len(data)-ptr)/uint64(size) {
+		return 0, ptr, errors.New("insufficient data size")
+	}
+	return int(length), ptr, nil
+}
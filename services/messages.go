@@ -34,6 +34,75 @@ type MsgTypes struct {
 	msgRefreshQuery  network.MessageTypeID
 	msgRotationReply network.MessageTypeID
 	msgRotationQuery network.MessageTypeID
+
+	//Messages for operations with a plaintext operand and the generic reply of evaluations
+	msgSubQuery                network.MessageTypeID
+	msgNegQuery                network.MessageTypeID
+	msgPlaintextOperationQuery network.MessageTypeID
+	msgScalarOperationQuery    network.MessageTypeID
+	msgEvaluationReply         network.MessageTypeID
+
+	//Messages for the operations over the slots
+	msgInnerSumQuery     network.MessageTypeID
+	msgInnerProductQuery network.MessageTypeID
+	msgReplicateQuery    network.MessageTypeID
+
+	//Messages for the matrix operations
+	msgRotationKeyRequest network.MessageTypeID
+	msgMatrixVectorQuery  network.MessageTypeID
+
+	//Message for the polynomial evaluation
+	msgPolynomialQuery network.MessageTypeID
+
+	//Messages for the datasets spread over multiple ciphertexts
+	msgStoreDatasetQuery network.MessageTypeID
+	msgDatasetQuery      network.MessageTypeID
+	msgDatasetReply      network.MessageTypeID
+
+	//Messages to import and export serialized ciphertexts
+	msgImportCiphertextQuery network.MessageTypeID
+	msgExportCiphertextQuery network.MessageTypeID
+	msgExportCiphertextReply network.MessageTypeID
+
+	//Message for the lifetime of the ciphertexts
+	msgStorageQuery network.MessageTypeID
+
+	//Messages for the catalog of the stored ciphertexts
+	msgCatalogQuery network.MessageTypeID
+	msgCatalogReply network.MessageTypeID
+
+	//Message for the namespace of the root
+	msgNameQuery network.MessageTypeID
+
+	//Messages for the status of the setup of the nodes
+	msgStatusQuery     network.MessageTypeID
+	msgNodeStatusReply network.MessageTypeID
+
+	//Messages to send the collective keys to the clients
+	msgCollectiveKeyQuery network.MessageTypeID
+	msgCollectiveKeyReply network.MessageTypeID
+
+	//Messages for the rotation of the collective key
+	msgRekeyQuery   network.MessageTypeID
+	msgRekeyRequest network.MessageTypeID
+	msgRekeyAck     network.MessageTypeID
+	//Messages for the changes of the members
+	msgMembershipQuery network.MessageTypeID
+	//Messages for the approvals of the members
+	msgApprovalQuery network.MessageTypeID
+	//Messages for the transfer to another collective
+	msgTransferQuery network.MessageTypeID
+	//Messages for the analysts
+	msgAnalystRegistrationQuery network.MessageTypeID
+	msgAnalystResultQuery       network.MessageTypeID
+	msgAnalystDownloadQuery     network.MessageTypeID
+	//Messages for the statistics
+	msgStatisticsQuery network.MessageTypeID
+	//Messages for the federated datasets
+	msgContributionQuery network.MessageTypeID
+	msgAggregationQuery  network.MessageTypeID
+	//Messages for the lifecycle of the ciphertexts
+	msgGarbageCollectionQuery network.MessageTypeID
 }
 
 var msgTypes = MsgTypes{}
@@ -70,5 +139,55 @@ func init() {
 	msgTypes.msgRotationQuery = network.RegisterMessage(&RotationQuery{})
 	msgTypes.msgRotationReply = network.RegisterMessage(&RotationReply{})
 
+	msgTypes.msgSubQuery = network.RegisterMessage(&SubQuery{})
+	msgTypes.msgNegQuery = network.RegisterMessage(&NegQuery{})
+	msgTypes.msgPlaintextOperationQuery = network.RegisterMessage(&PlaintextOperationQuery{})
+	msgTypes.msgScalarOperationQuery = network.RegisterMessage(&ScalarOperationQuery{})
+	msgTypes.msgEvaluationReply = network.RegisterMessage(&EvaluationReply{})
+
+	msgTypes.msgInnerSumQuery = network.RegisterMessage(&InnerSumQuery{})
+	msgTypes.msgInnerProductQuery = network.RegisterMessage(&InnerProductQuery{})
+	msgTypes.msgReplicateQuery = network.RegisterMessage(&ReplicateQuery{})
+
+	msgTypes.msgRotationKeyRequest = network.RegisterMessage(&RotationKeyRequest{})
+	msgTypes.msgMatrixVectorQuery = network.RegisterMessage(&MatrixVectorQuery{})
+
+	msgTypes.msgPolynomialQuery = network.RegisterMessage(&PolynomialQuery{})
+
+	msgTypes.msgStoreDatasetQuery = network.RegisterMessage(&StoreDatasetQuery{})
+	msgTypes.msgDatasetQuery = network.RegisterMessage(&DatasetQuery{})
+	msgTypes.msgDatasetReply = network.RegisterMessage(&DatasetReply{})
+
+	msgTypes.msgImportCiphertextQuery = network.RegisterMessage(&ImportCiphertextQuery{})
+	msgTypes.msgExportCiphertextQuery = network.RegisterMessage(&ExportCiphertextQuery{})
+	msgTypes.msgExportCiphertextReply = network.RegisterMessage(&ExportCiphertextReply{})
+
+	msgTypes.msgStorageQuery = network.RegisterMessage(&StorageQuery{})
+
+	msgTypes.msgCatalogQuery = network.RegisterMessage(&CatalogQuery{})
+	msgTypes.msgCatalogReply = network.RegisterMessage(&CatalogReply{})
+
+	msgTypes.msgNameQuery = network.RegisterMessage(&NameQuery{})
+
+	msgTypes.msgStatusQuery = network.RegisterMessage(&StatusQuery{})
+	msgTypes.msgNodeStatusReply = network.RegisterMessage(&NodeStatusReply{})
+
+	msgTypes.msgCollectiveKeyQuery = network.RegisterMessage(&CollectiveKeyQuery{})
+	msgTypes.msgCollectiveKeyReply = network.RegisterMessage(&CollectiveKeyReply{})
+
+	msgTypes.msgRekeyQuery = network.RegisterMessage(&RekeyQuery{})
+	msgTypes.msgRekeyRequest = network.RegisterMessage(&RekeyRequest{})
+	msgTypes.msgRekeyAck = network.RegisterMessage(&RekeyAck{})
+	msgTypes.msgMembershipQuery = network.RegisterMessage(&MembershipQuery{})
+	msgTypes.msgApprovalQuery = network.RegisterMessage(&ApprovalQuery{})
+	msgTypes.msgTransferQuery = network.RegisterMessage(&TransferQuery{})
+	msgTypes.msgAnalystRegistrationQuery = network.RegisterMessage(&AnalystRegistrationQuery{})
+	msgTypes.msgAnalystResultQuery = network.RegisterMessage(&AnalystResultQuery{})
+	msgTypes.msgAnalystDownloadQuery = network.RegisterMessage(&AnalystDownloadQuery{})
+	msgTypes.msgStatisticsQuery = network.RegisterMessage(&StatisticsQuery{})
+	msgTypes.msgContributionQuery = network.RegisterMessage(&ContributionQuery{})
+	msgTypes.msgAggregationQuery = network.RegisterMessage(&AggregationQuery{})
+	msgTypes.msgGarbageCollectionQuery = network.RegisterMessage(&GarbageCollectionQuery{})
+
 	network.RegisterMessage(&protocols.Start{})
 }
@@ -0,0 +1,169 @@
+//names contains the namespace of the root : the ciphertexts and datasets can be registered under names like hospitalA/age and referred to by them.
+//A name holds a reference to its ciphertext, so it is not removed while it is named. The refresh keeps the id of the ciphertext so the names stay valid.
+package services
+
+import (
+	"errors"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"sort"
+)
+
+//HandleNameQuery handler for a client to register, rename, alias, unregister or resolve a name.
+func (s *Service) HandleNameQuery(query *NameQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got name query for : ", query.Name)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//validateName returns an error if the name is empty or could be mistaken for an id.
+func validateName(name string) error {
+	if name == "" {
+		return errors.New("name is empty")
+	}
+	if _, err := uuid.FromString(name); err == nil {
+		return errors.New("name " + name + " is an id")
+	}
+	return nil
+}
+
+//resolve returns the id registered under the name.
+func (s *Service) resolve(name string) (uuid.UUID, error) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	return s.resolveLocked(name)
+}
+
+//resolveLocked is resolve with the store lock held.
+func (s *Service) resolveLocked(name string) (uuid.UUID, error) {
+	id, ok := s.Names[name]
+	if !ok {
+		return uuid.UUID{}, errors.New("name " + name + " is not registered")
+	}
+	return id, nil
+}
+
+//register registers the name for the ciphertext or dataset id and adds a reference to it. The store lock should be held.
+func (s *Service) register(name string, id uuid.UUID) error {
+	err := validateName(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.Names[name]; ok {
+		return errors.New("name " + name + " is already registered")
+	}
+	metadata, ok := s.Metadata[id]
+	if !ok {
+		return errors.New("ciphertext " + id.String() + " does not exist")
+	}
+	metadata.References++
+	s.Names[name] = id
+	return nil
+}
+
+//nameOperation applies the operation of the query on the namespace and returns the id concerned.
+func (s *Service) nameOperation(query *NameQuery) (uuid.UUID, error) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	if query.Operation == NameRegister {
+		return query.UUID, s.register(query.Name, query.UUID)
+	}
+	id, err := s.resolveLocked(query.Name)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	switch query.Operation {
+	case NameRename:
+		err = validateName(query.NewName)
+		if err != nil {
+			return uuid.UUID{}, err
+		}
+		if _, ok := s.Names[query.NewName]; ok {
+			return uuid.UUID{}, errors.New("name " + query.NewName + " is already registered")
+		}
+		delete(s.Names, query.Name)
+		s.Names[query.NewName] = id
+	case NameAlias:
+		err = s.register(query.NewName, id)
+	case NameUnregister:
+		delete(s.Names, query.Name)
+		s.releaseLocked(id)
+	case NameResolve:
+	default:
+		err = errors.New("unknown name operation")
+	}
+	return id, err
+}
+
+//namesOf returns the sorted names registered for the id. The store lock should be held.
+func (s *Service) namesOf(id uuid.UUID) []string {
+	names := make([]string, 0)
+	for name, named := range s.Names {
+		if uuid.Equal(named, id) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+//unregisterAll removes the names of the id when it is removed. The store lock should be held.
+func (s *Service) unregisterAll(id uuid.UUID) {
+	for name, named := range s.Names {
+		if uuid.Equal(named, id) {
+			delete(s.Names, name)
+		}
+	}
+}
+
+//resolveOperands replaces the ids of the operands by the ids registered under their names, if they are given.
+func (s *Service) resolveOperands(operands Operands, id *uuid.UUID, other *uuid.UUID) error {
+	var err error
+	if operands.Name != "" {
+		*id, err = s.resolve(operands.Name)
+		if err != nil {
+			return err
+		}
+	}
+	if operands.OtherName != "" && other != nil {
+		*other, err = s.resolve(operands.OtherName)
+	}
+	return err
+}
+
+//resolveNames resolves the names of the operands of an evaluation query before it is evaluated.
+//It returns the id of the query and false if the query has no named operands.
+func (s *Service) resolveNames(query interface{}) (uuid.UUID, bool, error) {
+	switch q := query.(type) {
+	case *SubQuery:
+		return q.QueryID, true, s.resolveOperands(q.Operands, &q.UUID, &q.Other)
+	case *NegQuery:
+		return q.QueryID, true, s.resolveOperands(q.Operands, &q.UUID, nil)
+	case *PlaintextOperationQuery:
+		return q.QueryID, true, s.resolveOperands(q.Operands, &q.UUID, nil)
+	case *ScalarOperationQuery:
+		return q.QueryID, true, s.resolveOperands(q.Operands, &q.UUID, nil)
+	case *InnerSumQuery:
+		return q.QueryID, true, s.resolveOperands(q.Operands, &q.UUID, nil)
+	case *InnerProductQuery:
+		return q.QueryID, true, s.resolveOperands(q.Operands, &q.UUID, &q.Other)
+	case *ReplicateQuery:
+		return q.QueryID, true, s.resolveOperands(q.Operands, &q.UUID, nil)
+	case *MatrixVectorQuery:
+		return q.QueryID, true, s.resolveOperands(q.Operands, &q.UUID, nil)
+	case *PolynomialQuery:
+		return q.QueryID, true, s.resolveOperands(q.Operands, &q.UUID, nil)
+	case *StatisticsQuery:
+		for _, name := range q.Names {
+			id, err := s.resolve(name)
+			if err != nil {
+				return q.QueryID, true, err
+			}
+			q.UUIDs = append(q.UUIDs, id)
+		}
+		q.Names = nil
+		return q.QueryID, true, nil
+	}
+	return uuid.Nil, false, nil
+}
@@ -0,0 +1,299 @@
+//operations contains the homomorphic building blocks evaluated by the root for the queries over the slots of the ciphertexts.
+//They are built from the rotations with the collective rotation keys, additions and multiplications.
+package services
+
+import (
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/onet/v3/log"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/utils"
+)
+
+//innerSumRotations returns the rotation keys needed to sum all the slots : the power of two column rotations and the row rotation.
+func innerSumRotations(params *bfv.Parameters) []RotationParameters {
+	rotations := make([]RotationParameters, 0)
+	for k := uint64(1); k < (1<<params.LogN)>>1; k <<= 1 {
+		rotations = append(rotations, RotationParameters{RotIdx: int(bfv.RotationLeft), K: k})
+	}
+	rotations = append(rotations, RotationParameters{RotIdx: int(bfv.RotationRow)})
+	return rotations
+}
+
+//appendRotations appends the rotations that are not yet in the list.
+func appendRotations(rotations []RotationParameters, others ...RotationParameters) []RotationParameters {
+	for _, rot := range others {
+		if !containsRotation(rotations, rot) {
+			rotations = append(rotations, rot)
+		}
+	}
+	return rotations
+}
+
+//containsRotation returns true if rot is in the list.
+func containsRotation(rotations []RotationParameters, rot RotationParameters) bool {
+	for _, r := range rotations {
+		if r == rot {
+			return true
+		}
+	}
+	return false
+}
+
+//innerSum returns a new ciphertext where every slot contains the sum of all the slots of ct.
+func (s *Service) innerSum(ct *bfv.Ciphertext) (*bfv.Ciphertext, error) {
+	if !s.rotKeyGenerated {
+		return nil, errors.New("rotation keys have not been generated")
+	}
+	if ct.Degree() != 1 {
+		return nil, errors.New("ciphertext should be relinearized before the rotations")
+	}
+	eval := bfv.NewEvaluator(s.Params)
+	res := ct
+	//sum the columns - after step k each slot contains the sum of 2k consecutive slots.
+	for k := uint64(1); k < (1<<s.Params.LogN)>>1; k <<= 1 {
+		rotated := eval.RotateColumnsNew(res, k, s.RotationKey)
+		res = eval.AddNew(res, rotated)
+	}
+	//sum the two rows.
+	rotated := eval.RotateRowsNew(res, s.RotationKey)
+	return eval.AddNew(res, rotated), nil
+}
+
+//innerProduct returns a new ciphertext where every slot contains the inner product of ct1 and ct2.
+func (s *Service) innerProduct(ct1, ct2 *bfv.Ciphertext) (*bfv.Ciphertext, error) {
+	if !s.evalKeyGenerated {
+		return nil, errors.New("evaluation key has not been generated")
+	}
+	eval := bfv.NewEvaluator(s.Params)
+	product := eval.RelinearizeNew(eval.MulNew(ct1, ct2), s.EvaluationKey)
+	return s.innerSum(product)
+}
+
+//replicate returns a new ciphertext where every slot contains the value of the slot of ct.
+func (s *Service) replicate(ct *bfv.Ciphertext, slot uint64) (*bfv.Ciphertext, error) {
+	if slot >= 1<<s.Params.LogN {
+		return nil, errors.New("slot index is larger than the number of slots")
+	}
+	//keep only the slot and sum all the slots.
+	mask := make([]uint64, slot+1)
+	mask[slot] = 1
+	pt, err := s.encodePlaintext(mask)
+	if err != nil {
+		return nil, err
+	}
+	masked := bfv.NewEvaluator(s.Params).MulNew(ct, pt)
+	return s.innerSum(masked)
+}
+
+//matrixRotations returns the rotation keys needed to multiply a vector by a d x d matrix with the diagonal method.
+func matrixRotations(params *bfv.Parameters, d uint64) []RotationParameters {
+	//rotation to the right of d steps to extend the vector.
+	rotations := []RotationParameters{{RotIdx: int(bfv.RotationLeft), K: (1<<params.LogN)>>1 - d}}
+	for k := uint64(1); k < d; k++ {
+		rotations = appendRotations(rotations, RotationParameters{RotIdx: int(bfv.RotationLeft), K: k})
+	}
+	return rotations
+}
+
+//matrixDiagonals returns the d generalized diagonals of the rows x cols matrix padded with zeros to d x d.
+//Diagonal i contains M[j][(j+i) mod d] in slot j.
+func matrixDiagonals(matrix []uint64, rows, cols, d uint64) [][]uint64 {
+	diagonals := make([][]uint64, d)
+	for i := uint64(0); i < d; i++ {
+		diagonals[i] = make([]uint64, d)
+		for j := uint64(0); j < rows; j++ {
+			col := (j + i) % d
+			if col < cols {
+				diagonals[i][j] = matrix[j*cols+col]
+			}
+		}
+	}
+	return diagonals
+}
+
+//extendVector returns a ciphertext with the first d slots of ct followed by a copy of them.
+//The rotations of less than d steps of the result are then cyclic over the first d slots.
+func (s *Service) extendVector(ct *bfv.Ciphertext, d uint64) (*bfv.Ciphertext, error) {
+	if 2*d > (1<<s.Params.LogN)>>1 {
+		return nil, errors.New("matrix is too large for the number of slots")
+	}
+	err := s.generateRotationKeys(matrixRotations(s.Params, d))
+	if err != nil {
+		return nil, err
+	}
+	if ct.Degree() != 1 {
+		return nil, errors.New("ciphertext should be relinearized before the rotations")
+	}
+
+	//keep only the first d slots.
+	mask := make([]uint64, d)
+	for i := range mask {
+		mask[i] = 1
+	}
+	pt, err := s.encodePlaintext(mask)
+	if err != nil {
+		return nil, err
+	}
+	eval := bfv.NewEvaluator(s.Params)
+	masked := eval.MulNew(ct, pt)
+	shifted := eval.RotateColumnsNew(masked, (1<<s.Params.LogN)>>1-d, s.RotationKey)
+	extended := eval.AddNew(masked, shifted)
+	//the mask and the diagonals are two multiplications, refresh in between if the parameters do not allow both.
+	if utils.DepthBudget(s.Params) < 2 {
+		log.Lvl1("Depth budget reached for the extended vector, refreshing")
+		return s.refresh(extended)
+	}
+	return extended, nil
+}
+
+//matrixVectorProduct returns the product of the plaintext rows x cols matrix ( row-major ) and the vector ct with the diagonal method.
+func (s *Service) matrixVectorProduct(ct *bfv.Ciphertext, matrix []uint64, rows, cols uint64) (*bfv.Ciphertext, error) {
+	if rows == 0 || cols == 0 || uint64(len(matrix)) != rows*cols {
+		return nil, errors.New("matrix size does not match its dimensions")
+	}
+	d := rows
+	if cols > d {
+		d = cols
+	}
+	vector, err := s.extendVector(ct, d)
+	if err != nil {
+		return nil, err
+	}
+
+	eval := bfv.NewEvaluator(s.Params)
+	res := bfv.NewCiphertext(s.Params, 1)
+	for i, diagonal := range matrixDiagonals(matrix, rows, cols, d) {
+		pt, err := s.encodePlaintext(diagonal)
+		if err != nil {
+			return nil, err
+		}
+		rotated := vector
+		if i > 0 {
+			rotated = eval.RotateColumnsNew(vector, uint64(i), s.RotationKey)
+		}
+		eval.Add(res, eval.MulNew(rotated, pt), res)
+	}
+	return res, nil
+}
+
+//encryptedMatrixVectorProduct returns the product of the matrix given by its encrypted diagonals and the vector ct with the diagonal method.
+func (s *Service) encryptedMatrixVectorProduct(ct *bfv.Ciphertext, diagonals []*bfv.Ciphertext) (*bfv.Ciphertext, error) {
+	if !s.evalKeyGenerated {
+		return nil, errors.New("evaluation key has not been generated")
+	}
+	d := uint64(len(diagonals))
+	vector, err := s.extendVector(ct, d)
+	if err != nil {
+		return nil, err
+	}
+
+	eval := bfv.NewEvaluator(s.Params)
+	res := bfv.NewCiphertext(s.Params, 2)
+	for i, diagonal := range diagonals {
+		rotated := vector
+		if i > 0 {
+			rotated = eval.RotateColumnsNew(vector, uint64(i), s.RotationKey)
+		}
+		eval.Add(res, eval.MulNew(diagonal, rotated), res)
+	}
+	return eval.RelinearizeNew(res, s.EvaluationKey), nil
+}
+
+//evaluatePolynomial returns a new ciphertext with the polynomial of coefficients coeffs ( constant term first ) evaluated on every slot of ct.
+//The powers are computed with a depth-optimal schedule : x^i = x^a * x^(i-a) with a the largest power of two smaller than i, so x^i has depth ceil(log(i)).
+//An operand is refreshed collectively before a multiplication that would exceed the depth budget of the parameters.
+func (s *Service) evaluatePolynomial(ct *bfv.Ciphertext, coeffs []uint64) (*bfv.Ciphertext, error) {
+	if len(coeffs) == 0 {
+		return nil, errors.New("polynomial has no coefficients")
+	}
+	for _, c := range coeffs {
+		if c >= s.Params.T {
+			return nil, errors.New("coefficient is not in Z_T")
+		}
+	}
+	degree := len(coeffs) - 1
+	eval := bfv.NewEvaluator(s.Params)
+	if degree > 1 || ct.Degree() > 1 {
+		if !s.evalKeyGenerated {
+			return nil, errors.New("evaluation key has not been generated")
+		}
+	}
+	if ct.Degree() > 1 {
+		ct = eval.RelinearizeNew(ct, s.EvaluationKey)
+	}
+	budget := utils.DepthBudget(s.Params)
+	if degree > 1 && budget < 1 {
+		return nil, errors.New("parameters do not allow any multiplication")
+	}
+
+	powers := make([]*bfv.Ciphertext, degree+1)
+	depths := make([]int, degree+1)
+	if degree > 0 {
+		powers[1] = ct
+	}
+	for i := 2; i <= degree; i++ {
+		a := 1
+		for 2*a < i {
+			a *= 2
+		}
+		b := i - a
+		for _, j := range []int{a, b} {
+			if depths[j]+1 > budget {
+				log.Lvl1("Depth budget reached for x^", j, " refreshing")
+				refreshed, err := s.refresh(powers[j])
+				if err != nil {
+					return nil, err
+				}
+				powers[j] = refreshed
+				depths[j] = 0
+			}
+		}
+		powers[i] = eval.RelinearizeNew(eval.MulNew(powers[a], powers[b]), s.EvaluationKey)
+		depths[i] = depths[a]
+		if depths[b] > depths[i] {
+			depths[i] = depths[b]
+		}
+		depths[i]++
+	}
+
+	res := bfv.NewCiphertext(s.Params, 1)
+	tmp := bfv.NewCiphertext(s.Params, 1)
+	for i := 1; i <= degree; i++ {
+		if coeffs[i] == 0 {
+			continue
+		}
+		eval.MulScalar(powers[i], coeffs[i], tmp)
+		eval.Add(res, tmp, res)
+	}
+	if coeffs[0] != 0 {
+		constant := make([]uint64, 1<<s.Params.LogN)
+		for i := range constant {
+			constant[i] = coeffs[0]
+		}
+		pt, err := s.encodePlaintext(constant)
+		if err != nil {
+			return nil, err
+		}
+		res = eval.AddNew(res, pt)
+	}
+	return res, nil
+}
+
+//refresh refreshes collectively the ciphertext and returns the result. The ciphertext is stored temporarily for the protocol.
+func (s *Service) refresh(ct *bfv.Ciphertext) (*bfv.Ciphertext, error) {
+	id := uuid.NewV1()
+	s.storeLock.Lock()
+	s.DataBase[id] = ct
+	s.storeLock.Unlock()
+	defer func() {
+		s.storeLock.Lock()
+		delete(s.DataBase, id)
+		s.storeLock.Unlock()
+	}()
+	err := s.refreshProto(&RefreshQuery{UUID: id})
+	if err != nil {
+		return nil, err
+	}
+	return s.getCiphertext(id)
+}
@@ -0,0 +1,132 @@
+//privacy contains the differential privacy of the decrypted results. When noise is asked, every node adds its share of the calibrated noise
+//to its share of the collective public key switching, so the result is decrypted with the noise and no single node knows the total noise.
+//The root tracks the privacy budget epsilon spent on every dataset written by the clients : a result spends its epsilon on all the datasets it
+//is computed from, and the switching is refused once the budget of one of them would be exceeded. The chunks of a dataset are charged one by one.
+//The epsilon is reserved before the switching and refunded if the switching fails.
+//Once a budget is set, the data is only decrypted with noise : the sensitivity of the noise is at least the one set at the setup and the noise covers every slot.
+//The lineage of the ciphertexts imported by the clients is not known, they could be exported and imported again to reset their budget :
+//once a budget is set, they are not switched. The transfers to another collective are charged like the decryptions.
+package services
+
+import (
+	"errors"
+	"go.dedis.ch/onet/v3/log"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/protocols"
+	"lattigo-smc/utils"
+	"strconv"
+)
+
+//sources returns the ciphertexts and datasets written by the clients from which the ciphertext id is computed, following the inputs of the provenance.
+//It returns an error if one of them was removed, its budget can not be charged anymore. The store lock should be held.
+func (s *Service) sources(id uuid.UUID) ([]uuid.UUID, error) {
+	var sources []uuid.UUID
+	visited := make(map[uuid.UUID]bool)
+	pending := []uuid.UUID{id}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		metadata, ok := s.Metadata[current]
+		if !ok {
+			return nil, errors.New("ciphertext " + current.String() + " the result is computed from was removed")
+		}
+		if len(metadata.Inputs) == 0 {
+			sources = append(sources, current)
+		}
+		pending = append(pending, metadata.Inputs...)
+	}
+	return sources, nil
+}
+
+//calibrateNoise returns the noise added to the switching of a ciphertext. Once a privacy budget is set the noise is mandatory,
+//its sensitivity is raised to the one of the setup and it covers every slot of the ciphertext. Should be called by the root.
+func (s *Service) calibrateNoise(noise *utils.NoiseParameters) (*utils.NoiseParameters, error) {
+	if s.PrivacyBudget == 0 {
+		return noise, nil
+	}
+	if noise == nil {
+		return nil, errors.New("the data can only be decrypted with noise once a privacy budget is set")
+	}
+	calibrated := *noise
+	if calibrated.Sensitivity < s.Sensitivity {
+		calibrated.Sensitivity = s.Sensitivity
+	}
+	calibrated.Slots = uint64(1) << s.Params.LogN
+	return &calibrated, nil
+}
+
+//reservePrivacyBudget returns an error if the noise is invalid or would exceed the budget of one of the sources of the ciphertext id, else it charges
+//the epsilon of the noise to all of them at once, so the switchings running concurrently on the same sources can not exceed their budget together.
+//Returns the sources charged, they are refunded if the switching fails.
+func (s *Service) reservePrivacyBudget(id uuid.UUID, noise *utils.NoiseParameters) ([]uuid.UUID, error) {
+	if err := noise.Validate(); err != nil {
+		return nil, err
+	}
+	if err := noise.CheckModulus(s.Params.T); err != nil {
+		return nil, err
+	}
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	sources, err := s.sources(id)
+	if s.PrivacyBudget != 0 {
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range sources {
+			if s.Metadata[source].Operation == "import" {
+				return nil, errors.New("ciphertext " + source.String() + " was imported, its budget is not known")
+			}
+			if s.Metadata[source].EpsilonSpent+noise.Epsilon > s.PrivacyBudget {
+				return nil, errors.New("privacy budget of " + source.String() + " exceeded : " +
+					strconv.FormatFloat(s.Metadata[source].EpsilonSpent, 'g', -1, 64) + " of " + strconv.FormatFloat(s.PrivacyBudget, 'g', -1, 64) + " spent")
+			}
+		}
+	}
+	for _, source := range sources {
+		s.Metadata[source].EpsilonSpent += noise.Epsilon
+		log.Lvl1("Spent epsilon ", noise.Epsilon, " on ", source, " total ", s.Metadata[source].EpsilonSpent)
+	}
+	return sources, nil
+}
+
+//refundPrivacyBudget gives the epsilon of the noise back to the sources charged by a switching that failed. The sources removed in the meantime are skipped.
+func (s *Service) refundPrivacyBudget(sources []uuid.UUID, noise *utils.NoiseParameters) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	for _, source := range sources {
+		metadata, ok := s.Metadata[source]
+		if !ok {
+			continue
+		}
+		metadata.EpsilonSpent -= noise.Epsilon
+		log.Lvl1("Refunded epsilon ", noise.Epsilon, " on ", source, " total ", metadata.EpsilonSpent)
+	}
+}
+
+//addNoiseShare adds the share of the noise of the node to its share of the key switching.
+func (s *Service) addNoiseShare(pcks *protocols.CollectivePublicKeySwitchingProtocol, noise *utils.NoiseParameters, parties int) error {
+	if noise.Slots > 1<<s.Params.LogN {
+		return errors.New("noise has more slots than the ciphertext")
+	}
+	if err := noise.CheckModulus(s.Params.T); err != nil {
+		return err
+	}
+	share, err := noise.Share(parties)
+	if err != nil {
+		return err
+	}
+	slots, err := utils.NewInts(share).Encode(s.Params.T)
+	if err != nil {
+		return err
+	}
+	pt, err := s.encodePlaintext(slots)
+	if err != nil {
+		return err
+	}
+	pcks.AddPlaintext(pt)
+	return nil
+}
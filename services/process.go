@@ -1,15 +1,26 @@
 package services
 
 import (
+	"errors"
 	"github.com/ldsec/lattigo/bfv"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
 	"gopkg.in/satori/go.uuid.v1"
 	"lattigo-smc/utils"
+	"time"
 )
 
 //Process a message from an other service. This is a big if-else-if loop over all type of messages that can be received.
 func (s *Service) Process(msg *network.Envelope) {
+	//the expired ciphertexts are removed before any query is processed.
+	s.collectGarbage()
+	//the names of the operands are resolved on the root, the evaluation fails if one is not registered.
+	if queryID, named, err := s.resolveNames(msg.Msg); named && err != nil {
+		s.replyEvaluation(msg.ServerIdentity, queryID, Provenance{}, utils.DataDescriptor{}, func() (*bfv.Ciphertext, error) {
+			return nil, err
+		})
+		return
+	}
 	//Processor interface used to recognize messages between server
 	if msg.MsgType.Equal(msgTypes.msgSetupRequest) {
 		s.processSetupRequest(msg)
@@ -41,6 +52,82 @@ func (s *Service) Process(msg *network.Envelope) {
 		s.processReplyPlaintext(msg)
 	} else if msg.MsgType.Equal(msgTypes.msgQueryPlaintext) {
 		s.processQueryPlaintext(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgSubQuery) {
+		s.processSubQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgNegQuery) {
+		s.processNegQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgPlaintextOperationQuery) {
+		s.processPlaintextOperationQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgScalarOperationQuery) {
+		s.processScalarOperationQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgEvaluationReply) {
+		s.processEvaluationReply(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgInnerSumQuery) {
+		s.processInnerSumQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgInnerProductQuery) {
+		s.processInnerProductQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgReplicateQuery) {
+		s.processReplicateQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgRotationKeyRequest) {
+		s.processRotationKeyRequest(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgMatrixVectorQuery) {
+		s.processMatrixVectorQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgPolynomialQuery) {
+		s.processPolynomialQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgStoreDatasetQuery) {
+		s.processStoreDatasetQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgDatasetQuery) {
+		s.processDatasetQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgDatasetReply) {
+		s.processDatasetReply(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgImportCiphertextQuery) {
+		s.processImportCiphertextQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgExportCiphertextQuery) {
+		s.processExportCiphertextQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgExportCiphertextReply) {
+		s.processExportCiphertextReply(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgStorageQuery) {
+		s.processStorageQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgCatalogQuery) {
+		s.processCatalogQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgCatalogReply) {
+		s.processCatalogReply(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgNameQuery) {
+		s.processNameQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgStatusQuery) {
+		s.processStatusQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgNodeStatusReply) {
+		s.processNodeStatusReply(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgCollectiveKeyQuery) {
+		s.processCollectiveKeyQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgCollectiveKeyReply) {
+		s.processCollectiveKeyReply(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgRekeyQuery) {
+		s.processRekeyQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgRekeyRequest) {
+		s.processRekeyRequest(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgRekeyAck) {
+		s.processRekeyAck(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgMembershipQuery) {
+		s.processMembershipQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgApprovalQuery) {
+		s.processApprovalQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgTransferQuery) {
+		s.processTransferQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgAnalystRegistrationQuery) {
+		s.processAnalystRegistrationQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgAnalystResultQuery) {
+		s.processAnalystResultQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgAnalystDownloadQuery) {
+		s.processAnalystDownloadQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgStatisticsQuery) {
+		s.processStatisticsQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgContributionQuery) {
+		s.processContributionQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgAggregationQuery) {
+		s.processAggregationQuery(msg)
+	} else if msg.MsgType.Equal(msgTypes.msgGarbageCollectionQuery) {
+		//the expired ciphertexts were already removed.
 	} else {
 		log.Error("Unknown message type :", msg.MsgType)
 	}
@@ -59,8 +146,12 @@ func (s *Service) processRefreshQuery(msg *network.Envelope) {
 func (s *Service) processReplyPlaintext(msg *network.Envelope) {
 	tmp := (msg.Msg).(*ReplyPlaintext)
 	log.Lvl1("Got a ciphertext switched with UUID : ", tmp.UUID)
-	s.SwitchedCiphertext[tmp.UUID] = make(chan bfv.Ciphertext, 1)
-	s.SwitchedCiphertext[tmp.UUID] <- *tmp.Ciphertext
+	s.repliesLock.Lock()
+	replies, ok := s.SwitchedCiphertext[tmp.UUID]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- *tmp
+	}
 }
 
 func (s *Service) processStoreReply(msg *network.Envelope) {
@@ -68,27 +159,46 @@ func (s *Service) processStoreReply(msg *network.Envelope) {
 	tmp := (msg.Msg).(*StoreReply)
 	log.Lvl1("ID Local , ", tmp.Local, "ID Remote: ", tmp.Remote, "Done :", tmp.Done)
 	//Update the local values.
-	s.LocalUUID[tmp.Local] = make(chan uuid.UUID, 1)
-	s.LocalUUID[tmp.Local] <- tmp.Remote
+	s.repliesLock.Lock()
+	replies, ok := s.LocalUUID[tmp.Local]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- tmp.Remote
+	}
 	log.Lvl1("Updated value of the ciphertext. ")
 }
 
 func (s *Service) processRotationReply(msg *network.Envelope) {
 	log.Lvl1("Got rotation replies")
 	tmp := (msg.Msg).(*RotationReply)
-	s.RotationReplies[tmp.Old] <- tmp.New
+	s.repliesLock.Lock()
+	replies, ok := s.RotationReplies[tmp.Old]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- *tmp
+	}
 }
 
 func (s *Service) processSumReply(msg *network.Envelope) {
 	log.Lvl1("Got message for sum reply")
 	tmp := (msg.Msg).(*SumReply)
-	s.SumReplies[tmp.SumQuery] <- tmp.UUID
+	s.repliesLock.Lock()
+	replies, ok := s.SumReplies[tmp.SumQuery]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- *tmp
+	}
 }
 
 func (s *Service) processMultiplyReply(msg *network.Envelope) {
 	tmp := (msg.Msg).(*MultiplyReply)
 	log.Lvl1("Got reply of multiply query : ", tmp.UUID)
-	s.MultiplyReplies[tmp.MultiplyQuery] <- tmp.UUID
+	s.repliesLock.Lock()
+	replies, ok := s.MultiplyReplies[tmp.MultiplyQuery]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- *tmp
+	}
 }
 
 func (s *Service) processKeyReply(msg *network.Envelope) {
@@ -112,30 +222,29 @@ func (s *Service) processQueryPlaintext(msg *network.Envelope) {
 	query := (msg.Msg).(*QueryPlaintext)
 	log.Lvl1("Got a query for ciphertext switching : ", query.UUID)
 	if s.ServerIdentity().Equal(tree.Root.ServerIdentity) {
-		//The root has to propagate to all members the ciphertext and the public key...
-		//Get the ciphertext.
-		cipher := s.DataBase[query.UUID]
-		query.Ciphertext = cipher
-		//Send to all
-
-		err := utils.SendISMOthers(s.ServiceProcessor, &s.Roster, query)
-		if err != nil {
-			return
+		//The root propagates the ciphertext and the public key to all the members and starts the key switch.
+		reply := ReplyPlaintext{UUID: query.UUID}
+		var sources []uuid.UUID
+		cipher, err := s.getCiphertext(query.UUID)
+		if err == nil {
+			query.Noise, err = s.calibrateNoise(query.Noise)
 		}
-		//Start the key switch
-		params := SwitchingParamters{
-			PublicKey:  *query.PublicKey,
-			Ciphertext: *query.Ciphertext,
+		if err == nil && query.Noise != nil {
+			sources, err = s.reservePrivacyBudget(query.UUID, query.Noise)
+		}
+		if err == nil {
+			reply.Ciphertext, err = s.switchToPublicKey(tree, query.UUID, cipher, query.PublicKey, query.Noise)
+			if err != nil {
+				s.refundPrivacyBudget(sources, query.Noise)
+			}
 		}
-		s.SwitchingParameters <- params
-
-		reply, err := s.switchKeys(tree, query.UUID)
 		if err != nil {
 			log.Error("Could not switch key : ", err)
+			reply.Error = err.Error()
 		}
 		log.Lvl1("Finished ciphertext switching. sending result to the querier ! ")
 		//reply to the origin of the queries
-		err = s.SendRaw(msg.ServerIdentity, reply)
+		err = s.SendRaw(msg.ServerIdentity, &reply)
 		if err != nil {
 			log.Error("Could not send reply to the server :", err)
 		}
@@ -143,6 +252,7 @@ func (s *Service) processQueryPlaintext(msg *network.Envelope) {
 		params := SwitchingParamters{
 			PublicKey:  *query.PublicKey,
 			Ciphertext: *query.Ciphertext,
+			Noise:      query.Noise,
 		}
 		s.SwitchingParameters <- params
 	}
@@ -173,74 +283,112 @@ func (s *Service) processKeyRequest(msg *network.Envelope) {
 func (s *Service) processRotationQuery(msg *network.Envelope) {
 	log.Lvl1("Got request for rotation !")
 	tmp := (msg.Msg).(*RotationQuery)
+	//the server waits for the reply of the id it asked for.
+	reply := RotationReply{Old: tmp.UUID}
+	var err error
+	reply.New, err = s.rotate(msg.ServerIdentity, tmp)
+	if err != nil {
+		log.Error("Could not rotate ciphertext : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	log.Lvl1("Sent result of rotaiton :) ")
+	if err != nil {
+		log.Error("Could not rotate ciphertext : ", err)
+	}
+	return
+}
+
+//rotate rotates the ciphertext or dataset of the query and returns the id of the result.
+func (s *Service) rotate(server *network.ServerIdentity, tmp *RotationQuery) (uuid.UUID, error) {
 	rotIdx := tmp.RotIdx
 	K := tmp.K
 	id := tmp.UUID
 	if !s.rotKeyGenerated {
-		return
-	}
-	eval := bfv.NewEvaluator(s.Params)
-	cipher, ok := s.DataBase[id]
-	if !ok {
-		log.Error("Ciphertext does not exist : ", id)
-		return
-	}
-	newId := uuid.NewV1()
-	switch bfv.Rotation(rotIdx) {
-	case bfv.RotationRow:
-		s.DataBase[newId] = eval.RotateRowsNew(cipher, s.RotationKey)
-	case bfv.RotationLeft:
-		s.DataBase[newId] = eval.RotateColumnsNew(cipher, K, s.RotationKey)
-	case bfv.RotationRight:
-		s.DataBase[newId] = eval.RotateColumnsNew(cipher, K, s.RotationKey)
+		return uuid.Nil, errors.New("rotation key has not been generated")
 	}
-	reply := RotationReply{id, newId}
-	err := s.SendRaw(msg.ServerIdentity, &reply)
-	log.Lvl1("Sent result of rotaiton :) ")
+	err := s.resolveOperands(Operands{Name: tmp.Name}, &id, nil)
 	if err != nil {
-		log.Error("Could not rotate ciphertext : ", err)
+		return uuid.Nil, err
 	}
-	return
+	eval := bfv.NewEvaluator(s.Params)
+	//the chunks of a dataset are rotated independently.
+	provenance := Provenance{Owner: server.String(), Operation: "rotation"}
+	return s.evaluateDataset(s.datasetDescriptor(id), provenance, func(cts ...*bfv.Ciphertext) (*bfv.Ciphertext, error) {
+		switch bfv.Rotation(rotIdx) {
+		case bfv.RotationRow:
+			return eval.RotateRowsNew(cts[0], s.RotationKey), nil
+		case bfv.RotationLeft:
+			return eval.RotateColumnsNew(cts[0], K, s.RotationKey), nil
+		case bfv.RotationRight:
+			return eval.RotateColumnsNew(cts[0], K, s.RotationKey), nil
+		}
+		return nil, errors.New("unknown rotation")
+	}, id)
 }
 
 func (s *Service) processRelinQuery(msg *network.Envelope) {
 	log.Lvl1("Got relin query")
 	tmp := (msg.Msg).(*RelinQuery)
-	ct, ok := s.DataBase[tmp.UUID]
-	if !ok {
-		log.Error("query for ciphertext that does not exist : ", tmp.UUID)
-		return
+	reply := EvaluationReply{QueryID: tmp.QueryID, UUID: tmp.UUID}
+	err := s.relinearize(&reply.UUID, tmp.Name)
+	if err != nil {
+		log.Error("Could not relinearize : ", err)
+		reply.Error = err.Error()
+	} else {
+		log.Lvl1("Relinearization done")
 	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+//relinearize relinearizes in place the ciphertext or dataset id, or the one registered under name if it is set. id is set to the resolved id.
+func (s *Service) relinearize(id *uuid.UUID, name string) error {
 	if !s.evalKeyGenerated {
-		log.Error("evaluation key not generated aborting")
-		return
+		return errors.New("evaluation key has not been generated")
+	}
+	err := s.resolveOperands(Operands{Name: name}, id, nil)
+	if err != nil {
+		return err
 	}
 	eval := bfv.NewEvaluator(s.Params)
-	ct1 := eval.RelinearizeNew(ct, s.EvaluationKey)
-	s.DataBase[tmp.UUID] = ct1
-	log.Lvl1("Relinearization done")
-	return
+	//all the chunks are relinearized before any is replaced so that a dataset is never left half relinearized.
+	chunks := s.chunks(*id)
+	relinearized := make(map[uuid.UUID]*bfv.Ciphertext, len(chunks))
+	for _, id := range chunks {
+		ct, err := s.getCiphertext(id)
+		if err != nil {
+			return err
+		}
+		relinearized[id] = eval.RelinearizeNew(ct, s.EvaluationKey)
+	}
+	s.replaceCiphertexts(relinearized)
+	return nil
 }
 
 func (s *Service) processSumQuery(msg *network.Envelope) {
 	log.Lvl1("Got request to sum up ciphertexts")
 	tmp := (msg.Msg).(*SumQuery)
 	log.Lvl1("Sum :", tmp.UUID, "+", tmp.Other)
-	eval := bfv.NewEvaluator(s.Params)
-	ct1, ok := s.DataBase[tmp.UUID]
-	if !ok {
-		log.Error("Ciphertext ", tmp.UUID, " does not exist.")
-		return
+	//the query is resolved in copies of the ids, the server waits for the reply to the query it sent.
+	id1, id2 := tmp.UUID, tmp.Other
+	reply := SumReply{SumQuery: *tmp}
+	err := s.resolveOperands(Operands{tmp.Name, tmp.OtherName}, &id1, &id2)
+	if err == nil {
+		eval := bfv.NewEvaluator(s.Params)
+		provenance := Provenance{Owner: msg.ServerIdentity.String(), Operation: "sum"}
+		reply.UUID, err = s.evaluateDataset(s.datasetDescriptor(id1), provenance, func(cts ...*bfv.Ciphertext) (*bfv.Ciphertext, error) {
+			return eval.AddNew(cts[0], cts[1]), nil
+		}, id1, id2)
 	}
-	ct2, ok := s.DataBase[tmp.Other]
-	if !ok {
-		log.Error("Ciphertext ", tmp.UUID, " does not exist.")
-		return
+	if err != nil {
+		//the server gets the error instead of waiting for the result.
+		log.Error("Could not sum the ciphertexts : ", err)
+		reply.Error = err.Error()
 	}
-	id := uuid.NewV1()
-	s.DataBase[id] = eval.AddNew(ct1, ct2)
-	reply := SumReply{id, *tmp}
-	err := s.SendRaw(msg.ServerIdentity, &reply)
+	err = s.SendRaw(msg.ServerIdentity, &reply)
 	if err != nil {
 		log.Error("Could not reply to the server ", err)
 	}
@@ -252,12 +400,27 @@ func (s *Service) processStoreQuery(msg *network.Envelope) {
 	log.Lvl1(s.ServerIdentity(), "got a request to store a cipher")
 	tmp := (msg.Msg).(*StoreQuery)
 	id := uuid.NewV1()
-	s.DataBase[id] = tmp.Ciphertext
+	done := true
+	err := s.validateDescriptor(tmp.Descriptor, 1)
+	if err == nil {
+		err = s.checkCapacity(ciphertextSize(tmp.Ciphertext))
+	}
+	if err == nil {
+		err = s.checkRekeying()
+	}
+	if err != nil {
+		//the write is rejected, the server gets an empty id.
+		log.Error("Could not store the cipher : ", err)
+		id = uuid.Nil
+		done = false
+	} else {
+		s.storeCiphertext(id, tmp.Ciphertext, tmp.Descriptor, Provenance{Owner: msg.ServerIdentity.String(), Operation: "write"})
+	}
 	//send an acknowledgement of storing..
 	sender := msg.ServerIdentity
 	log.Lvl1("Id of cipher : ", tmp.UUID)
-	Ack := StoreReply{tmp.UUID, id, true}
-	err := s.SendRaw(sender, &Ack)
+	Ack := StoreReply{tmp.UUID, id, done}
+	err = s.SendRaw(sender, &Ack)
 	if err != nil {
 		log.Error("Could not send acknowledgement")
 	}
@@ -277,24 +440,699 @@ func (s *Service) processMultiplyQuery(msg *network.Envelope) {
 	log.Lvl1("Got request to multiply two ciphertexts")
 	tmp := (msg.Msg).(*MultiplyQuery)
 	log.Lvl1("Multply :", tmp.UUID, "+", tmp.Other)
+	id1, id2 := tmp.UUID, tmp.Other
+	reply := MultiplyReply{MultiplyQuery: *tmp}
+	err := s.resolveOperands(Operands{tmp.Name, tmp.OtherName}, &id1, &id2)
+	if err == nil {
+		eval := bfv.NewEvaluator(s.Params)
+		descriptor := utils.MultiplyDescriptors(s.datasetDescriptor(id1), s.datasetDescriptor(id2))
+		provenance := Provenance{Owner: msg.ServerIdentity.String(), Operation: "multiply"}
+		reply.UUID, err = s.evaluateDataset(descriptor, provenance, func(cts ...*bfv.Ciphertext) (*bfv.Ciphertext, error) {
+			return eval.MulNew(cts[0], cts[1]), nil
+		}, id1, id2)
+	}
+	if err != nil {
+		//the server gets the error instead of waiting for the result.
+		log.Error("Could not multiply the ciphertexts : ", err)
+		reply.Error = err.Error()
+	}
+	log.Lvl1("Storing result in : ", reply.UUID)
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+	return
+}
+
+func (s *Service) processEvaluationReply(msg *network.Envelope) {
+	tmp := (msg.Msg).(*EvaluationReply)
+	log.Lvl1("Got reply of evaluation query : ", tmp.QueryID, " result : ", tmp.UUID)
+	s.repliesLock.Lock()
+	replies, ok := s.EvaluationReplies[tmp.QueryID]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- *tmp
+	}
+}
+
+func (s *Service) processSubQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*SubQuery)
+	log.Lvl1("Sub :", tmp.UUID, "-", tmp.Other)
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: "sub", Inputs: []uuid.UUID{tmp.UUID, tmp.Other}}, s.descriptor(tmp.UUID), func() (*bfv.Ciphertext, error) {
+		ct1, err := s.getCiphertext(tmp.UUID)
+		if err != nil {
+			return nil, err
+		}
+		ct2, err := s.getCiphertext(tmp.Other)
+		if err != nil {
+			return nil, err
+		}
+		return bfv.NewEvaluator(s.Params).SubNew(ct1, ct2), nil
+	})
+}
+
+func (s *Service) processNegQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*NegQuery)
+	log.Lvl1("Neg :", tmp.UUID)
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: "neg", Inputs: []uuid.UUID{tmp.UUID}}, s.descriptor(tmp.UUID), func() (*bfv.Ciphertext, error) {
+		ct, err := s.getCiphertext(tmp.UUID)
+		if err != nil {
+			return nil, err
+		}
+		return bfv.NewEvaluator(s.Params).NegNew(ct), nil
+	})
+}
+
+func (s *Service) processPlaintextOperationQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*PlaintextOperationQuery)
+	log.Lvl1("Plaintext operation ", tmp.Operation, " on :", tmp.UUID)
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: "plaintext", Inputs: []uuid.UUID{tmp.UUID}}, s.descriptor(tmp.UUID), func() (*bfv.Ciphertext, error) {
+		ct, err := s.getCiphertext(tmp.UUID)
+		if err != nil {
+			return nil, err
+		}
+		pt, err := s.encodePlaintext(tmp.Plaintext)
+		if err != nil {
+			return nil, err
+		}
+		return s.evaluatePlaintextOperation(ct, pt, tmp.Operation)
+	})
+}
+
+func (s *Service) processScalarOperationQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*ScalarOperationQuery)
+	log.Lvl1("Scalar operation ", tmp.Operation, " on :", tmp.UUID)
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: "scalar", Inputs: []uuid.UUID{tmp.UUID}}, s.descriptor(tmp.UUID), func() (*bfv.Ciphertext, error) {
+		ct, err := s.getCiphertext(tmp.UUID)
+		if err != nil {
+			return nil, err
+		}
+		if tmp.Scalar >= s.Params.T {
+			return nil, errors.New("scalar is not in Z_T")
+		}
+		if tmp.Operation == OperationMul {
+			//no need to go through the encoder, the scalar multiplies every slot.
+			res := bfv.NewCiphertext(s.Params, ct.Degree())
+			bfv.NewEvaluator(s.Params).MulScalar(ct, tmp.Scalar, res)
+			return res, nil
+		}
+		//the scalar is replicated in all slots.
+		values := make([]uint64, 1<<s.Params.LogN)
+		for i := range values {
+			values[i] = tmp.Scalar
+		}
+		pt, err := s.encodePlaintext(values)
+		if err != nil {
+			return nil, err
+		}
+		return s.evaluatePlaintextOperation(ct, pt, tmp.Operation)
+	})
+}
+
+//evaluatePlaintextOperation evaluates op between the ciphertext and the plaintext and returns a new ciphertext.
+func (s *Service) evaluatePlaintextOperation(ct *bfv.Ciphertext, pt *bfv.Plaintext, op PlaintextOperation) (*bfv.Ciphertext, error) {
 	eval := bfv.NewEvaluator(s.Params)
-	ct1, ok := s.DataBase[tmp.UUID]
-	if !ok {
-		log.Error("Ciphertext ", tmp.UUID, " does not exist.")
-		return
+	switch op {
+	case OperationAdd:
+		return eval.AddNew(ct, pt), nil
+	case OperationSub:
+		return eval.SubNew(ct, pt), nil
+	case OperationMul:
+		return eval.MulNew(ct, pt), nil
+	}
+	return nil, errors.New("unknown plaintext operation")
+}
+
+//encodePlaintext encodes the values in a plaintext with the encoder of the session. The values should be in Z_T.
+func (s *Service) encodePlaintext(values []uint64) (*bfv.Plaintext, error) {
+	if s.Encoder == nil {
+		return nil, errors.New("the session is not set up")
+	}
+	if uint64(len(values)) > 1<<s.Params.LogN {
+		return nil, errors.New("plaintext has more values than the number of slots")
+	}
+	for _, v := range values {
+		if v >= s.Params.T {
+			return nil, errors.New("plaintext value is not in Z_T")
+		}
+	}
+	pt := bfv.NewPlaintext(s.Params)
+	s.Encoder.EncodeUint(values, pt)
+	return pt, nil
+}
+
+//getCiphertext returns the ciphertext stored at id.
+func (s *Service) getCiphertext(id uuid.UUID) (*bfv.Ciphertext, error) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	if _, ok := s.Datasets[id]; ok {
+		return nil, errors.New(id.String() + " is a dataset of multiple ciphertexts, the operation needs a single ciphertext")
 	}
-	ct2, ok := s.DataBase[tmp.Other]
+	ct, ok := s.DataBase[id]
 	if !ok {
-		log.Error("Ciphertext ", tmp.UUID, " does not exist.")
-		return
+		return nil, errors.New("ciphertext " + id.String() + " does not exist")
+	}
+	return ct, nil
+}
+
+//storeCiphertext stores the ciphertext at id with the descriptor of its values, its provenance and one reference. The result holds a reference on its inputs.
+func (s *Service) storeCiphertext(id uuid.UUID, ct *bfv.Ciphertext, descriptor utils.DataDescriptor, provenance Provenance) {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	s.storeCiphertextLocked(id, ct, descriptor, provenance)
+}
+
+//storeCiphertextLocked is storeCiphertext with the store lock held.
+func (s *Service) storeCiphertextLocked(id uuid.UUID, ct *bfv.Ciphertext, descriptor utils.DataDescriptor, provenance Provenance) {
+	s.retainInputs(provenance)
+	s.DataBase[id] = ct
+	s.Metadata[id] = &Metadata{
+		Descriptor: descriptor,
+		References: 1,
+		Size:       ciphertextSize(ct),
+		Created:    time.Now(),
+		Provenance: provenance,
+	}
+}
+
+//descriptor returns the descriptor of the values of the ciphertext stored at id. By default all the slots are read as bytes.
+func (s *Service) descriptor(id uuid.UUID) utils.DataDescriptor {
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	if metadata, ok := s.Metadata[id]; ok {
+		return metadata.Descriptor
+	}
+	return utils.DataDescriptor{Type: utils.TypeBytes, Length: 1 << s.Params.LogN}
+}
+
+//replyEvaluation runs the evaluation at the root, stores the result with the descriptor and sends its id ( or the error ) to the server that made the query.
+//The server that made the query is recorded as the owner of the result.
+func (s *Service) replyEvaluation(server *network.ServerIdentity, queryID uuid.UUID, provenance Provenance, descriptor utils.DataDescriptor, evaluate func() (*bfv.Ciphertext, error)) {
+	reply := EvaluationReply{QueryID: queryID}
+	ct, err := evaluate()
+	if err == nil {
+		err = s.checkCapacity(ciphertextSize(ct))
+	}
+	if err == nil {
+		err = s.checkRekeying()
+	}
+	if err != nil {
+		log.Error("Could not evaluate query ", queryID, " : ", err)
+		reply.Error = err.Error()
+	} else {
+		reply.UUID = uuid.NewV1()
+		provenance.Owner = server.String()
+		s.storeCiphertext(reply.UUID, ct, descriptor, provenance)
+		log.Lvl1("Storing result in : ", reply.UUID)
+	}
+
+	err = s.SendRaw(server, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processInnerSumQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*InnerSumQuery)
+	log.Lvl1("Inner sum :", tmp.UUID)
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: "innersum", Inputs: []uuid.UUID{tmp.UUID}}, s.descriptor(tmp.UUID), func() (*bfv.Ciphertext, error) {
+		ct, err := s.getCiphertext(tmp.UUID)
+		if err != nil {
+			return nil, err
+		}
+		return s.innerSum(ct)
+	})
+}
+
+func (s *Service) processInnerProductQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*InnerProductQuery)
+	log.Lvl1("Inner product :", tmp.UUID, ".", tmp.Other)
+	descriptor := utils.MultiplyDescriptors(s.descriptor(tmp.UUID), s.descriptor(tmp.Other))
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: "innerproduct", Inputs: []uuid.UUID{tmp.UUID, tmp.Other}}, descriptor, func() (*bfv.Ciphertext, error) {
+		ct1, err := s.getCiphertext(tmp.UUID)
+		if err != nil {
+			return nil, err
+		}
+		ct2, err := s.getCiphertext(tmp.Other)
+		if err != nil {
+			return nil, err
+		}
+		return s.innerProduct(ct1, ct2)
+	})
+}
+
+func (s *Service) processStatisticsQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*StatisticsQuery)
+	log.Lvl1("Statistic ", tmp.Statistic, " of : ", tmp.UUIDs)
+	descriptor, err := s.statisticDescriptor(tmp)
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: statisticOperation(tmp.Statistic), Inputs: tmp.UUIDs}, descriptor, func() (*bfv.Ciphertext, error) {
+		if err != nil {
+			return nil, err
+		}
+		return s.statistic(tmp)
+	})
+}
+
+func (s *Service) processReplicateQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*ReplicateQuery)
+	log.Lvl1("Replicate slot ", tmp.Slot, " of :", tmp.UUID)
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: "replicate", Inputs: []uuid.UUID{tmp.UUID}}, s.descriptor(tmp.UUID), func() (*bfv.Ciphertext, error) {
+		ct, err := s.getCiphertext(tmp.UUID)
+		if err != nil {
+			return nil, err
+		}
+		return s.replicate(ct, tmp.Slot)
+	})
+}
+
+func (s *Service) processRotationKeyRequest(msg *network.Envelope) {
+	tmp := (msg.Msg).(*RotationKeyRequest)
+	log.Lvl1(s.ServerIdentity(), "got request for ", len(tmp.Rotations), " rotation keys")
+	s.queueRotations(tmp.Rotations)
+}
+
+func (s *Service) processMatrixVectorQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*MatrixVectorQuery)
+	log.Lvl1("Matrix vector product on :", tmp.UUID)
+	//the result has one value per row of the matrix.
+	descriptor := s.descriptor(tmp.UUID)
+	descriptor.Length = tmp.Rows
+	if len(tmp.Diagonals) > 0 {
+		descriptor.Length = uint64(len(tmp.Diagonals))
+	}
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: "matrixvector", Inputs: append([]uuid.UUID{tmp.UUID}, tmp.Diagonals...)}, descriptor, func() (*bfv.Ciphertext, error) {
+		ct, err := s.getCiphertext(tmp.UUID)
+		if err != nil {
+			return nil, err
+		}
+		if len(tmp.Diagonals) > 0 {
+			diagonals := make([]*bfv.Ciphertext, len(tmp.Diagonals))
+			for i, id := range tmp.Diagonals {
+				diagonals[i], err = s.getCiphertext(id)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return s.encryptedMatrixVectorProduct(ct, diagonals)
+		}
+		return s.matrixVectorProduct(ct, tmp.Matrix, tmp.Rows, tmp.Cols)
+	})
+}
+
+func (s *Service) processPolynomialQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*PolynomialQuery)
+	log.Lvl1("Polynomial of degree ", len(tmp.Coeffs)-1, " on :", tmp.UUID)
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: "polynomial", Inputs: []uuid.UUID{tmp.UUID}}, s.descriptor(tmp.UUID), func() (*bfv.Ciphertext, error) {
+		ct, err := s.getCiphertext(tmp.UUID)
+		if err != nil {
+			return nil, err
+		}
+		return s.evaluatePolynomial(ct, tmp.Coeffs)
+	})
+}
+
+func (s *Service) processStoreDatasetQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*StoreDatasetQuery)
+	log.Lvl1(s.ServerIdentity(), "got a request to store a dataset of ", len(tmp.Ciphertexts), " ciphertexts")
+	reply := EvaluationReply{QueryID: tmp.QueryID}
+	size := uint64(0)
+	for _, ct := range tmp.Ciphertexts {
+		size += ciphertextSize(ct)
+	}
+	if len(tmp.Ciphertexts) == 0 {
+		reply.Error = "dataset has no ciphertexts"
+	} else if err := s.validateDescriptor(tmp.Descriptor, len(tmp.Ciphertexts)); err != nil {
+		reply.Error = err.Error()
+	} else if err := s.checkCapacity(size); err != nil {
+		reply.Error = err.Error()
+	} else if err := s.checkRekeying(); err != nil {
+		reply.Error = err.Error()
+	} else {
+		reply.UUID = s.storeDataset(tmp.Ciphertexts, tmp.Descriptor, Provenance{Owner: msg.ServerIdentity.String(), Operation: "write"})
 	}
-	id := uuid.NewV1()
-	s.DataBase[id] = eval.MulNew(ct1, ct2)
-	reply := MultiplyReply{id, *tmp}
-	log.Lvl1("Storing result in : ", id)
 	err := s.SendRaw(msg.ServerIdentity, &reply)
 	if err != nil {
 		log.Error("Could not reply to the server ", err)
 	}
-	return
+}
+
+func (s *Service) processDatasetQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*DatasetQuery)
+	log.Lvl1("Got query for the manifest of : ", tmp.UUID, tmp.Name)
+	reply := DatasetReply{QueryID: tmp.QueryID}
+	id := tmp.UUID
+	err := s.resolveOperands(Operands{Name: tmp.Name}, &id, nil)
+	s.storeLock.Lock()
+	_, stored := s.Metadata[id]
+	s.storeLock.Unlock()
+	if err != nil {
+		reply.Error = err.Error()
+	} else if stored {
+		reply.Chunks = s.chunks(id)
+		reply.Descriptor = s.datasetDescriptor(id)
+	} else {
+		reply.Error = "ciphertext " + id.String() + " does not exist"
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processDatasetReply(msg *network.Envelope) {
+	tmp := (msg.Msg).(*DatasetReply)
+	log.Lvl1("Got the manifest of query : ", tmp.QueryID)
+	s.repliesLock.Lock()
+	replies, ok := s.DatasetReplies[tmp.QueryID]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- *tmp
+	}
+}
+
+func (s *Service) processImportCiphertextQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*ImportCiphertextQuery)
+	log.Lvl1(s.ServerIdentity(), "got a request to import a ciphertext")
+	descriptor := tmp.Descriptor
+	if descriptor.Length == 0 {
+		descriptor = utils.DataDescriptor{Type: utils.TypeUint, Length: 1 << s.Params.LogN}
+	}
+	//the values were encrypted by the client, their bound is not known.
+	descriptor.Bound = 0
+	s.replyEvaluation(msg.ServerIdentity, tmp.QueryID, Provenance{Operation: "import"}, descriptor, func() (*bfv.Ciphertext, error) {
+		ct, err := s.unmarshalCiphertext(tmp.Ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		err = s.validateDescriptor(descriptor, 1)
+		if err != nil {
+			return nil, err
+		}
+		err = s.checkCapacity(ciphertextSize(ct))
+		if err != nil {
+			return nil, err
+		}
+		return ct, nil
+	})
+}
+
+func (s *Service) processExportCiphertextQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*ExportCiphertextQuery)
+	log.Lvl1("Got a request to export : ", tmp.UUID)
+	reply := ExportCiphertextReply{QueryID: tmp.QueryID, UUID: tmp.UUID}
+	ct, err := s.getCiphertext(tmp.UUID)
+	if err == nil {
+		reply.Ciphertext, err = ct.MarshalBinary()
+	}
+	if err != nil {
+		log.Error("Could not export ciphertext ", tmp.UUID, " : ", err)
+		reply.Error = err.Error()
+	} else {
+		reply.Descriptor = s.descriptor(tmp.UUID)
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processExportCiphertextReply(msg *network.Envelope) {
+	tmp := (msg.Msg).(*ExportCiphertextReply)
+	log.Lvl1("Got exported ciphertext : ", tmp.UUID)
+	s.repliesLock.Lock()
+	replies, ok := s.ExportReplies[tmp.QueryID]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- *tmp
+	}
+}
+
+func (s *Service) processStorageQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*StorageQuery)
+	log.Lvl1("Storage operation ", tmp.Operation, " on :", tmp.UUID)
+	reply := EvaluationReply{QueryID: tmp.QueryID, UUID: tmp.UUID}
+	err := s.storageOperation(tmp)
+	if err != nil {
+		log.Error("Could not apply storage operation : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processCatalogQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*CatalogQuery)
+	log.Lvl1("Got catalog query")
+	entries, total := s.catalog(tmp)
+	reply := CatalogReply{QueryID: tmp.QueryID, Entries: entries, Total: total}
+	err := s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processCatalogReply(msg *network.Envelope) {
+	tmp := (msg.Msg).(*CatalogReply)
+	log.Lvl1("Got catalog reply with ", len(tmp.Entries), " entries")
+	s.repliesLock.Lock()
+	replies, ok := s.CatalogReplies[tmp.QueryID]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- *tmp
+	}
+}
+
+func (s *Service) processNameQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*NameQuery)
+	log.Lvl1("Name operation ", tmp.Operation, " on :", tmp.Name)
+	id, err := s.nameOperation(tmp)
+	reply := EvaluationReply{QueryID: tmp.QueryID, UUID: id}
+	if err != nil {
+		log.Error("Could not apply name operation : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processStatusQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*StatusQuery)
+	log.Lvl1("Got status query")
+	reply := NodeStatusReply{QueryID: tmp.QueryID, NodeStatus: s.nodeStatus()}
+	err := s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processNodeStatusReply(msg *network.Envelope) {
+	tmp := (msg.Msg).(*NodeStatusReply)
+	log.Lvl1("Got status of : ", tmp.Server)
+	s.repliesLock.Lock()
+	replies, ok := s.StatusReplies[tmp.QueryID]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- *tmp
+	}
+}
+
+func (s *Service) processCollectiveKeyQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*CollectiveKeyQuery)
+	log.Lvl1("Got query for chunk ", tmp.Chunk, " of key ", tmp.Key)
+	reply := s.keyChunk(tmp)
+	err := s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processCollectiveKeyReply(msg *network.Envelope) {
+	tmp := (msg.Msg).(*CollectiveKeyReply)
+	log.Lvl1("Got chunk ", tmp.Chunk, " of key ", tmp.Key)
+	s.repliesLock.Lock()
+	replies, ok := s.KeyReplies[tmp.QueryID]
+	s.repliesLock.Unlock()
+	if ok {
+		replies <- *tmp
+	}
+}
+
+func (s *Service) processRekeyQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*RekeyQuery)
+	log.Lvl1("Got rekey query")
+	reply := EvaluationReply{QueryID: tmp.QueryID}
+	err := s.rekey()
+	if err != nil {
+		log.Error("Could not rotate the collective key : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processRekeyRequest(msg *network.Envelope) {
+	tmp := (msg.Msg).(*RekeyRequest)
+	log.Lvl1(s.ServerIdentity(), "got rekey request phase : ", tmp.Phase)
+	err := s.rekeyPhase(msg.ServerIdentity, tmp)
+	if err != nil {
+		log.Error("Could not process the rekey request : ", err)
+	}
+	if tmp.Phase == RekeyPrepare {
+		ack := RekeyAck{KeyEpoch: tmp.KeyEpoch, Server: s.ServerIdentity().ID.String()}
+		if err != nil {
+			ack.Error = err.Error()
+		}
+		err = s.SendRaw(msg.ServerIdentity, &ack)
+		if err != nil {
+			log.Error("Could not acknowledge the new collective key : ", err)
+		}
+	}
+}
+
+func (s *Service) processRekeyAck(msg *network.Envelope) {
+	tmp := (msg.Msg).(*RekeyAck)
+	log.Lvl1("Got rekey acknowledgement of ", msg.ServerIdentity)
+	//the sender is taken from the connection, not from the message
+	tmp.Server = msg.ServerIdentity.ID.String()
+	s.repliesLock.Lock()
+	acks, ok := s.RekeyAcks[tmp.KeyEpoch]
+	s.repliesLock.Unlock()
+	if ok {
+		acks <- *tmp
+	}
+}
+
+func (s *Service) processMembershipQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*MembershipQuery)
+	log.Lvl1("Got membership query : ", tmp.Operation, " of ", tmp.Server)
+	reply := EvaluationReply{QueryID: tmp.QueryID}
+	err := s.changeMembers(tmp)
+	if err != nil {
+		log.Error("Could not change the members : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processApprovalQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*ApprovalQuery)
+	log.Lvl1("Got approval of : ", tmp.Subject)
+	reply := EvaluationReply{QueryID: tmp.QueryID}
+	err := s.approve(tmp)
+	if err != nil {
+		log.Error("Could not approve : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processTransferQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*TransferQuery)
+	log.Lvl1("Got a request to transfer : ", tmp.UUID)
+	reply := ExportCiphertextReply{QueryID: tmp.QueryID, UUID: tmp.UUID}
+	ct, err := s.transfer(s.Roster.GenerateBinaryTree(), tmp)
+	if err == nil {
+		reply.Ciphertext, err = ct.MarshalBinary()
+	}
+	if err != nil {
+		log.Error("Could not transfer ciphertext ", tmp.UUID, " : ", err)
+		reply.Error = err.Error()
+	} else {
+		reply.Descriptor = s.descriptor(tmp.UUID)
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processAnalystRegistrationQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*AnalystRegistrationQuery)
+	log.Lvl1("Got registration of analyst : ", tmp.Name)
+	reply := EvaluationReply{QueryID: tmp.QueryID}
+	err := s.registerAnalyst(tmp)
+	if err != nil {
+		log.Error("Could not register the analyst : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processAnalystResultQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*AnalystResultQuery)
+	log.Lvl1("Got request of ", tmp.UUID, " for analyst : ", tmp.Name)
+	id, err := s.switchToAnalyst(tmp)
+	reply := EvaluationReply{QueryID: tmp.QueryID, UUID: id}
+	if err != nil {
+		log.Error("Could not switch the ciphertext to the analyst : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processAnalystDownloadQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*AnalystDownloadQuery)
+	log.Lvl1("Got download of ", tmp.UUID, " for analyst : ", tmp.Name)
+	reply := ExportCiphertextReply{QueryID: tmp.QueryID, UUID: tmp.UUID}
+	result, err := s.analystResult(tmp)
+	if err == nil {
+		reply.Ciphertext, err = result.Ciphertext.MarshalBinary()
+		reply.Descriptor = result.Descriptor
+	}
+	if err != nil {
+		log.Error("Could not download the result : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processContributionQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*ContributionQuery)
+	log.Lvl1("Got contribution of ", msg.ServerIdentity, " to : ", tmp.Name)
+	id, err := s.contribute(msg.ServerIdentity, tmp)
+	reply := EvaluationReply{QueryID: tmp.QueryID, UUID: id}
+	if err != nil {
+		log.Error("Could not store the contribution : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
+}
+
+func (s *Service) processAggregationQuery(msg *network.Envelope) {
+	tmp := (msg.Msg).(*AggregationQuery)
+	log.Lvl1("Got aggregation of : ", tmp.Name)
+	id, err := s.aggregate(msg.ServerIdentity, tmp.Name)
+	reply := EvaluationReply{QueryID: tmp.QueryID, UUID: id}
+	if err != nil {
+		log.Error("Could not aggregate the contributions : ", err)
+		reply.Error = err.Error()
+	}
+	err = s.SendRaw(msg.ServerIdentity, &reply)
+	if err != nil {
+		log.Error("Could not reply to the server ", err)
+	}
 }
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"github.com/ldsec/lattigo/bfv"
 	"github.com/ldsec/lattigo/ring"
 	"go.dedis.ch/onet/v3"
@@ -32,6 +33,8 @@ func (s *Service) NewProtocol(tn *onet.TreeNodeInstance, conf *onet.GenericConfi
 		protocol, err = s.newProtoRotKG(tn)
 	case protocols.CollectiveRefreshName:
 		protocol, err = s.newProtoRefresh(tn)
+	case protocols.SeedAgreementProtocolName:
+		protocol, err = s.newProtoSeedAgreement(tn)
 
 	}
 	if err != nil {
@@ -49,13 +52,37 @@ func (s *Service) newProtoCKG(tn *onet.TreeNodeInstance) (onet.ProtocolInstance,
 	ckgp := protocol.(*protocols.CollectiveKeyGenerationProtocol)
 	//init
 	crp := s.crpGen.ClockNew()
-	err = ckgp.Init(s.Params, s.SecretKey, crp)
+	//during a rekeying the key is generated with the new secret key shares.
+	rekeying := s.nextSecretKey != nil
+	sk := s.SecretKey
+	if rekeying {
+		sk = s.nextSecretKey
+	}
+	err = ckgp.Init(s.Params, sk, crp)
+	ckgp.Verifiable = s.verifiablePublicKey
 	if !tn.IsRoot() {
 		go func() {
 
 			log.Lvl1(s.ServerIdentity(), "Waiting for the protocol to be finished...(NewProtocol)")
 			ckgp.Wait()
+			if ckgp.Err != nil {
+				log.Error(tn.ServerIdentity(), " : refusing the collective public key : ", ckgp.Err)
+				return
+			}
 			log.Lvl1(tn.ServerIdentity(), " : done with collective key gen ! ")
+			if rekeying {
+				//the new key is used once the root commits the rekeying.
+				if ckgp.Verifiable {
+					s.nextPublicKey = ckgp.Pk
+					s.nextPublicKeyShares = ckgp.Shares
+				}
+				return
+			}
+			if ckgp.Verifiable {
+				//the node checked the key of the root.
+				s.MasterPublicKey = ckgp.Pk
+				s.PublicKeyShares = ckgp.Shares
+			}
 
 			s.SecretKey = ckgp.Sk
 			s.DecryptorSk = bfv.NewDecryptor(s.Params, s.SecretKey)
@@ -69,7 +96,23 @@ func (s *Service) newProtoCKG(tn *onet.TreeNodeInstance) (onet.ProtocolInstance,
 }
 
 func (s *Service) newProtoCKS(tn *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
-	return nil, nil
+	log.Lvl1(s.ServerIdentity(), ": New protocol cks")
+	protocol, err := protocols.NewCollectiveKeySwitching(tn)
+	if err != nil {
+		return nil, err
+	}
+	cks := protocol.(*protocols.CollectiveKeySwitchingProtocol)
+	ciphertext := <-s.KeySwitchParams
+	if s.nextSecretKey == nil {
+		return nil, errors.New("no rekeying in progress")
+	}
+	//switch from the current secret key shares to the new ones, a joining node switches from a zero share.
+	sk := s.SecretKey
+	if sk == nil {
+		sk = bfv.NewSecretKey(s.Params)
+	}
+	err = cks.Init(s.Params, sk, s.nextSecretKey, ciphertext)
+	return protocol, err
 }
 
 func (s *Service) newProtoCPKS(tn *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
@@ -88,6 +131,12 @@ func (s *Service) newProtoCPKS(tn *onet.TreeNodeInstance) (onet.ProtocolInstance
 	if err != nil {
 		return nil, err
 	}
+	if sp.Noise != nil {
+		err = s.addNoiseShare(pcks, sp.Noise, len(tn.Roster().List))
+		if err != nil {
+			return nil, err
+		}
+	}
 	return protocol, err
 }
 
@@ -112,6 +161,10 @@ func (s *Service) newProtoRLK(tn *onet.TreeNodeInstance) (onet.ProtocolInstance,
 
 			log.Lvl1(s.ServerIdentity(), "Waiting for the protocol to be finished...(Relin Protocol)")
 			rkp.Wait()
+			if rkp.Err != nil {
+				log.Error(tn.ServerIdentity(), " : collective relinkey gen aborted : ", rkp.Err)
+				return
+			}
 			log.Lvl1(tn.ServerIdentity(), " : done with collective relinkey gen ! ")
 
 			s.evalKeyGenerated = true
@@ -134,8 +187,9 @@ func (s *Service) newProtoRotKG(tn *onet.TreeNodeInstance) (onet.ProtocolInstanc
 	for j := 0; j < len(modulus); j++ {
 		crp[j] = s.crpGen.ClockNew()
 	}
-	var rotIdx = s.RotIdx
-	var K = s.K
+	rot := s.RotationParams.pop()
+	var rotIdx = rot.RotIdx
+	var K = rot.K
 	if s.RotationKey != nil {
 		err = rotkey.Init(s.Params, *s.SecretKey, bfv.Rotation(rotIdx), K, crp, false, s.RotationKey)
 	} else {
@@ -149,6 +203,10 @@ func (s *Service) newProtoRotKG(tn *onet.TreeNodeInstance) (onet.ProtocolInstanc
 	if !tn.IsRoot() {
 		go func() {
 			rotkey.Wait()
+			if rotkey.Err != nil {
+				log.Error(tn.ServerIdentity(), " : rotation key gen aborted : ", rotkey.Err)
+				return
+			}
 			s.rotKeyGenerated = true
 		}()
 	}
@@ -170,3 +228,19 @@ func (s *Service) newProtoRefresh(tn *onet.TreeNodeInstance) (onet.ProtocolInsta
 	err = refresh.Init(*s.Params, s.SecretKey, *ciphertext, *crs)
 	return protocol, nil
 }
+
+func (s *Service) newProtoSeedAgreement(tn *onet.TreeNodeInstance) (onet.ProtocolInstance, error) {
+	log.Lvl1(s.ServerIdentity(), ": New protocol seed agreement")
+	protocol, err := protocols.NewSeedAgreement(tn)
+	if err != nil {
+		return nil, err
+	}
+	sap := protocol.(*protocols.SeedAgreementProtocol)
+	err = sap.Init(nil)
+	//the seed is set before the node acknowledges it, so the CRP are reset on all the nodes once the root finished.
+	sap.SetSeed = func(seed []byte) {
+		log.Lvl1(tn.ServerIdentity(), " : agreed on the seed of the CRP")
+		s.setSeed(seed)
+	}
+	return protocol, err
+}
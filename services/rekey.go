@@ -0,0 +1,466 @@
+//rekey contains the rotation of the collective key. Every node generates a new secret key share and the nodes generate a new collective public key.
+//The root then switches every stored ciphertext from the old key to the new one with the collective key switching, and the old shares are erased on all the nodes.
+//The relinearization and rotation keys of the old key are generated again under the new key. The ciphertexts written during the rekeying are not switched.
+//The root only replaces the ciphertexts and commits once all the nodes acknowledged the new collective public key, else the rekeying is aborted.
+//
+//The rekeying also changes the members of the roster : the new key is shared by the new members only, and the key switching runs on the old and the new members.
+//A joining node switches from a zero share, a leaving node switches to a zero share, so it must take part in the rekeying that excludes it.
+package services
+
+import (
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/protocols"
+	"lattigo-smc/utils"
+	"time"
+)
+
+//rekeyTimeout time to wait for the nodes to acknowledge the new collective public key.
+const rekeyTimeout = 10 * time.Second
+
+//HandleMembershipQuery handler for a client to add a server to the roster or remove one. Replies once the stored ciphertexts are under the key of the new members.
+//The operation must have been approved by every member that stays in the roster, see MembershipSubject.
+func (s *Service) HandleMembershipQuery(query *MembershipQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got membership query : ", query.Operation, " of ", query.Server)
+	if query.Server == nil {
+		return nil, errors.New("no server in the query")
+	}
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//changeMembers adds the server of the query to the roster or removes it and rekeys the session to the new members. Should be called by the root.
+func (s *Service) changeMembers(query *MembershipQuery) error {
+	index, _ := s.Roster.Search(query.Server.ID)
+	var list, approvers []*network.ServerIdentity
+	switch query.Operation {
+	case MemberJoin:
+		if index >= 0 {
+			return errors.New(query.Server.String() + " is already a member")
+		}
+		list = append(append(list, s.Roster.List...), query.Server)
+		approvers = s.Roster.List
+	case MemberLeave:
+		if index < 0 {
+			return errors.New(query.Server.String() + " is not a member")
+		}
+		if index == 0 {
+			return errors.New("the root can not leave the roster")
+		}
+		list = append(append(list, s.Roster.List[:index]...), s.Roster.List[index+1:]...)
+		//a member can be removed without its consent.
+		approvers = list
+	default:
+		return errors.New("unknown membership operation")
+	}
+	subject := MembershipSubject(query.Operation, query.Server, s.RosterVersion)
+	err := s.approvedBy(subject, approvers)
+	if err != nil {
+		return err
+	}
+	err = s.rekeyMembers(onet.NewRoster(list))
+	if err != nil {
+		return err
+	}
+	s.forgetApproval(subject)
+	return nil
+}
+
+//HandleRekeyQuery handler for a client to rotate the collective key. Replies once the stored ciphertexts are under the new key.
+func (s *Service) HandleRekeyQuery(query *RekeyQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got rekey query")
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//rekey rotates the collective key and switches the stored ciphertexts to the new key. Should be called by the root.
+func (s *Service) rekey() error {
+	return s.rekeyMembers(&s.Roster)
+}
+
+//rekeyMembers rotates the collective key to a key shared by the members and switches the stored ciphertexts to it. Should be called by the root.
+func (s *Service) rekeyMembers(members *onet.Roster) error {
+	s.rekeyLock.Lock()
+	defer s.rekeyLock.Unlock()
+	if !s.pubKeyGenerated || s.MasterPublicKey == nil {
+		return errors.New("the collective public key has not been generated")
+	}
+	if s.nextSecretKey != nil {
+		return errors.New("a rekeying is already in progress")
+	}
+	//the key switching does not support the ciphertexts of degree 2.
+	s.storeLock.Lock()
+	for id, ct := range s.DataBase {
+		if ct.Degree() > 1 {
+			s.storeLock.Unlock()
+			return errors.New("ciphertext " + id.String() + " should be relinearized before the rekeying")
+		}
+	}
+	s.storeLock.Unlock()
+
+	log.Lvl1(s.ServerIdentity(), "Rotating the collective key to ", len(members.List), " members")
+	//the key switching runs on the old and the new members, the new key is generated by the new members.
+	union := unionRoster(&s.Roster, members)
+	tree := members.GenerateBinaryTree()
+	params, err := s.Params.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	s.nextRoster = members
+	err = s.sendRekeyRequest(&RekeyRequest{Phase: RekeyStart, Roster: *members, Parameters: params, ParamsIdx: s.ParamsIdx, VerifiablePublicKey: s.verifiablePublicKey})
+	if err != nil {
+		return s.abortRekey(err)
+	}
+	s.startRekey()
+	//the writes are refused from now on ( see checkRekeying ), the ciphertexts stored until then are switched to the new key.
+	s.storeLock.Lock()
+	ids := make([]uuid.UUID, 0, len(s.DataBase))
+	for id := range s.DataBase {
+		ids = append(ids, id)
+	}
+	s.storeLock.Unlock()
+	<-time.After(500 * time.Millisecond) //wait for the joining nodes to have the parameters.
+
+	//the new members agree on a new seed, so the joining nodes generate the same CRP.
+	err = s.agreeOnSeed(tree)
+	if err != nil {
+		return s.abortRekey(err)
+	}
+	ckgp, err := s.runCKG(tree)
+	if err != nil {
+		return s.abortRekey(err)
+	}
+	switched := make(map[uuid.UUID]*bfv.Ciphertext, len(ids))
+	for _, id := range ids {
+		ct, err := s.getCiphertext(id)
+		if err != nil {
+			//deleted during the rekeying.
+			continue
+		}
+		out, err := s.switchToNextKey(union.GenerateBinaryTree(), ct)
+		if err != nil {
+			return s.abortRekey(err)
+		}
+		switched[id] = out
+	}
+
+	pk, err := ckgp.Pk.MarshalBinary()
+	if err != nil {
+		return s.abortRekey(err)
+	}
+	err = s.prepareRekey(&RekeyRequest{Phase: RekeyPrepare, PublicKey: pk, KeyEpoch: s.KeyEpoch + 1, RosterVersion: s.RosterVersion + 1})
+	if err != nil {
+		return s.abortRekey(err)
+	}
+	err = s.sendRekeyRequest(&RekeyRequest{Phase: RekeyCommit, PublicKey: pk, KeyEpoch: s.KeyEpoch + 1, RosterVersion: s.RosterVersion + 1})
+	if err != nil {
+		return err
+	}
+	s.replaceCiphertexts(switched)
+	evaluationKey := s.evalKeyGenerated
+	rotations := s.Rotations
+	s.nextPublicKey = ckgp.Pk
+	s.nextPublicKeyShares = ckgp.Shares
+	s.commitRekey(ckgp.Pk, s.KeyEpoch+1, s.RosterVersion+1)
+	log.Lvl1(s.ServerIdentity(), "Collective key rotated, epoch ", s.KeyEpoch, " roster version ", s.RosterVersion)
+
+	//the evaluation keys of the old key are useless, they are generated again.
+	if evaluationKey {
+		err = s.genEvalKey(tree)
+		if err != nil {
+			return err
+		}
+	}
+	return s.generateRotationKeys(rotations)
+}
+
+//rekeyPhase applies the step of the rekeying sent by the root. The steps sent by any other server are refused, see rekeyRoot.
+func (s *Service) rekeyPhase(sender *network.ServerIdentity, request *RekeyRequest) error {
+	root := s.rekeyRoot(request)
+	if root == nil || sender == nil || !root.ID.Equal(sender.ID) {
+		return errors.New("the rekey request was not sent by the root")
+	}
+	switch request.Phase {
+	case RekeyStart:
+		err := s.joinSession(request)
+		if err != nil {
+			return err
+		}
+		s.nextRoster = &request.Roster
+		s.startRekey()
+	case RekeySwitch:
+		ct, err := s.unmarshalCiphertext(request.Ciphertext)
+		if err != nil {
+			return err
+		}
+		s.KeySwitchParams <- ct
+	case RekeyPrepare:
+		if s.nextSecretKey == nil {
+			return errors.New("no rekeying in progress")
+		}
+		pk := new(bfv.PublicKey)
+		err := unmarshalUntrusted(pk, request.PublicKey)
+		if err != nil {
+			return err
+		}
+		if s.nextPublicKey != nil && !publicKeyEqual(s.nextPublicKey, pk) {
+			return errors.New("the new collective public key of the root does not match the one verified by the node")
+		}
+		s.nextPublicKey = pk
+	case RekeyCommit:
+		pk := new(bfv.PublicKey)
+		err := unmarshalUntrusted(pk, request.PublicKey)
+		if err != nil {
+			return err
+		}
+		if s.nextPublicKey == nil || !publicKeyEqual(s.nextPublicKey, pk) {
+			s.abortRekey(nil)
+			return errors.New("the new collective public key of the root was not acknowledged by the node")
+		}
+		s.commitRekey(pk, request.KeyEpoch, request.RosterVersion)
+	case RekeyAbort:
+		s.abortRekey(nil)
+	default:
+		return errors.New("unknown rekey phase")
+	}
+	return nil
+}
+
+//rekeyRoot returns the root of the rekeying : the root of the current roster, or of the new roster for a node that joins the session.
+//The root is the first server of the union of the old and new rosters, which is the first server of the current roster.
+func (s *Service) rekeyRoot(request *RekeyRequest) *network.ServerIdentity {
+	roster := &s.Roster
+	if len(roster.List) == 0 {
+		roster = s.nextRoster
+	}
+	if roster == nil && request.Phase == RekeyStart {
+		roster = &request.Roster
+	}
+	if roster == nil || len(roster.List) == 0 {
+		return nil
+	}
+	return roster.List[0]
+}
+
+//prepareRekey sends the new collective public key to the other old and new members and waits until all of them acknowledged it. Should be called by the root.
+func (s *Service) prepareRekey(request *RekeyRequest) error {
+	roster := &s.Roster
+	if s.nextRoster != nil {
+		roster = unionRoster(&s.Roster, s.nextRoster)
+	}
+	acks := make(chan RekeyAck, len(roster.List))
+	s.repliesLock.Lock()
+	s.RekeyAcks[request.KeyEpoch] = acks
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.RekeyAcks, request.KeyEpoch)
+		s.repliesLock.Unlock()
+	}()
+	err := s.sendRekeyRequest(request)
+	if err != nil {
+		return err
+	}
+
+	members := make(map[string]bool)
+	for _, si := range roster.List {
+		members[si.ID.String()] = true
+	}
+	acked := map[string]bool{s.ServerIdentity().ID.String(): true}
+	timeout := time.After(rekeyTimeout)
+	for len(acked) < len(members) {
+		select {
+		case ack := <-acks:
+			if ack.Error != "" {
+				return errors.New(ack.Server + " refused the new collective public key : " + ack.Error)
+			}
+			if members[ack.Server] {
+				acked[ack.Server] = true
+			}
+		case <-timeout:
+			return errors.New("timeout while waiting for the nodes to acknowledge the new collective public key")
+		}
+	}
+	return nil
+}
+
+//sendRekeyRequest sends the step of the rekeying to the other old and new members.
+func (s *Service) sendRekeyRequest(request *RekeyRequest) error {
+	roster := &s.Roster
+	if s.nextRoster != nil {
+		roster = unionRoster(&s.Roster, s.nextRoster)
+	}
+	return utils.SendISMOthers(s.ServiceProcessor, roster, request)
+}
+
+//joinSession sets the parameters of the session on a joining node.
+func (s *Service) joinSession(request *RekeyRequest) error {
+	if s.Params != nil {
+		return nil
+	}
+	params := new(bfv.Parameters)
+	err := unmarshalUntrusted(params, request.Parameters)
+	if err != nil {
+		return err
+	}
+	err = utils.ValidateParameters(params, DefaultMinSecurity)
+	if err != nil {
+		return err
+	}
+	s.Params = params
+	s.ParamsIdx = request.ParamsIdx
+	s.ParamsHash, err = paramsHash(params)
+	if err != nil {
+		return err
+	}
+	s.Encoder = bfv.NewEncoder(s.Params)
+	s.verifiablePublicKey = request.VerifiablePublicKey
+	log.Lvl1(s.ServerIdentity(), "joining the session")
+	return nil
+}
+
+//startRekey generates the new secret key share of the node, a zero share if the node leaves the roster.
+func (s *Service) startRekey() {
+	if s.isMember(s.nextRoster) {
+		s.nextSecretKey = bfv.NewKeyGenerator(s.Params).GenSecretKey()
+	} else {
+		s.nextSecretKey = bfv.NewSecretKey(s.Params)
+	}
+	s.nextPublicKey = nil
+	s.nextPublicKeyShares = nil
+}
+
+//commitRekey erases the old secret key share and uses the new collective public key. The evaluation keys of the old key are dropped.
+//A node that left the roster drops all its keys.
+func (s *Service) commitRekey(pk *bfv.PublicKey, epoch, rosterVersion uint64) {
+	if s.SecretKey != nil {
+		s.SecretKey.Get().Zero()
+	}
+	member := s.isMember(s.nextRoster)
+	if member {
+		s.SecretKey = s.nextSecretKey
+		s.PublicKey = bfv.NewKeyGenerator(s.Params).GenPublicKey(s.SecretKey)
+		s.DecryptorSk = bfv.NewDecryptor(s.Params, s.SecretKey)
+		if s.MasterPublicKey != nil {
+			s.MasterPublicKey = pk
+		}
+		s.PublicKeyShares = s.nextPublicKeyShares
+		s.pubKeyGenerated = true
+	} else {
+		log.Lvl1(s.ServerIdentity(), "left the roster")
+		s.SecretKey = nil
+		s.PublicKey = nil
+		s.DecryptorSk = nil
+		s.MasterPublicKey = nil
+		s.PublicKeyShares = nil
+		s.pubKeyGenerated = false
+	}
+	if s.nextRoster != nil {
+		s.Roster = *s.nextRoster
+		if !member {
+			s.Roster = onet.Roster{}
+		}
+	}
+	s.nextRoster = nil
+	s.nextSecretKey = nil
+	s.nextPublicKey = nil
+	s.nextPublicKeyShares = nil
+
+	s.EvaluationKey = nil
+	s.evalKeyGenerated = false
+	s.RotationKey = nil
+	s.rotKeyGenerated = false
+	s.Rotations = nil
+	s.KeyEpoch = epoch
+	s.RosterVersion = rosterVersion
+}
+
+//abortRekey erases the new secret key share, the nodes keep the old key and the old roster. Returns the error that made the rekeying fail.
+func (s *Service) abortRekey(err error) error {
+	if err != nil {
+		if sendErr := s.sendRekeyRequest(&RekeyRequest{Phase: RekeyAbort}); sendErr != nil {
+			log.Error("Could not abort the rekeying on all the nodes : ", sendErr)
+		}
+	}
+	s.nextRoster = nil
+	s.nextSecretKey = nil
+	s.nextPublicKey = nil
+	s.nextPublicKeyShares = nil
+	return err
+}
+
+//checkRekeying returns an error if a rekeying is in progress. The ciphertexts stored during the rekeying would not be switched to the new key,
+//so the writes, imports, transfers and evaluations are refused until it is committed or aborted.
+func (s *Service) checkRekeying() error {
+	if s.nextSecretKey != nil {
+		return errors.New("rekeying in progress")
+	}
+	return nil
+}
+
+//isMember returns true if the node is in the roster, or in the current roster if roster is nil.
+func (s *Service) isMember(roster *onet.Roster) bool {
+	if roster == nil {
+		roster = &s.Roster
+	}
+	index, _ := roster.Search(s.ServerIdentity().ID)
+	return index >= 0
+}
+
+//unionRoster returns the roster with the servers of roster followed by the servers of other that are not in roster.
+func unionRoster(roster, other *onet.Roster) *onet.Roster {
+	list := append([]*network.ServerIdentity{}, roster.List...)
+	for _, si := range other.List {
+		if index, _ := roster.Search(si.ID); index < 0 {
+			list = append(list, si)
+		}
+	}
+	return onet.NewRoster(list)
+}
+
+//switchToNextKey switches the ciphertext from the current collective key to the new one. Should be called by the root.
+func (s *Service) switchToNextKey(tree *onet.Tree, ct *bfv.Ciphertext) (*bfv.Ciphertext, error) {
+	data, err := ct.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	err = s.sendRekeyRequest(&RekeyRequest{Phase: RekeySwitch, Ciphertext: data})
+	if err != nil {
+		return nil, err
+	}
+	s.KeySwitchParams <- ct
+
+	tni := s.NewTreeNodeInstance(tree, tree.Root, protocols.CollectiveKeySwitchingProtocolName)
+	protocol, err := s.NewProtocol(tni, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = s.RegisterProtocolInstance(protocol)
+	if err != nil {
+		return nil, err
+	}
+	cks := protocol.(*protocols.CollectiveKeySwitchingProtocol)
+
+	<-time.After(1 * time.Second) //wait for the other parties to have the ciphertext.
+	err = cks.Start()
+	if err != nil {
+		return nil, err
+	}
+	go cks.Dispatch()
+	cks.Wait()
+	if cks.Err != nil {
+		return nil, cks.Err
+	}
+	return cks.CiphertextOut, nil
+}
+
+//publicKeyEqual returns true if the two public keys have the same serialization.
+func publicKeyEqual(pk1, pk2 *bfv.PublicKey) bool {
+	data1, err1 := pk1.MarshalBinary()
+	data2, err2 := pk2.MarshalBinary()
+	return err1 == nil && err2 == nil && string(data1) == string(data2)
+}
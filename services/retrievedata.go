@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"github.com/ldsec/lattigo/bfv"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
@@ -11,15 +12,66 @@ import (
 	"time"
 )
 
+//switchTimeout time to wait for the root to switch a ciphertext.
+const switchTimeout = time.Minute
+
 func (s *Service) HandlePlaintextQuery(query *QueryPlaintext) (network.Message, error) {
+	return s.retrievePlaintext(query, nil)
+}
+
+//retrievePlaintext decrypts the ciphertext or dataset of the query. The wait for the root is abandoned when cancel is closed.
+func (s *Service) retrievePlaintext(query *QueryPlaintext, cancel <-chan struct{}) (network.Message, error) {
 	//Initiate the CKS
-	log.Lvl1(s.ServerIdentity(), "got request for plaintext of id : ", query.UUID)
+	log.Lvl1(s.ServerIdentity(), "got request for plaintext of id : ", query.UUID, query.Name)
+	dataset, err := s.getDataset(query.UUID, query.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	//the chunks are switched one after the other and their slots are concatenated.
+	data64 := make([]uint64, 0, len(dataset.Chunks)<<s.Params.LogN)
+	for _, id := range dataset.Chunks {
+		cipher, err := s.switchCiphertext(id, query.Noise, cancel)
+		if err != nil {
+			return nil, err
+		}
+		plain := s.DecryptorSk.DecryptNew(cipher)
+		//todo ask : when decoding the cipher text the values are not what is expected.
+		data64 = append(data64, s.Encoder.DecodeUint(plain)...)
+	}
+	bytes, err := utils.Uint64ToBytes(data64, true)
+	if err != nil {
+		log.Error("Could not retrieve byte array : ", err)
+	}
+	values, err := utils.DecodeTypedValues(data64, dataset.Descriptor, s.Params.T)
+	if err != nil {
+		log.Error("Could not decode the values : ", err)
+		return nil, err
+	}
+	response := &PlaintextReply{UUID: query.UUID, Data: bytes, Values: values}
+
+	return response, nil
+}
+
+//switchCiphertext asks the root to switch the ciphertext id under the public key of the server and waits for the result.
+//The result is decrypted with differential privacy noise if noise is not nil. The wait is abandoned when cancel is closed.
+func (s *Service) switchCiphertext(id uuid.UUID, noise *utils.NoiseParameters, cancel <-chan struct{}) (*bfv.Ciphertext, error) {
 	tree := s.GenerateBinaryTree()
 
 	//From the client Send it to all the other peers so they can initate the PCKS
+	query := &QueryPlaintext{UUID: id, Noise: noise}
 	query.PublicKey = bfv.NewPublicKey(s.Params)
 	query.PublicKey.Set(s.PublicKey.Get())
 
+	replies := make(chan ReplyPlaintext, 1)
+	s.repliesLock.Lock()
+	s.SwitchedCiphertext[id] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.SwitchedCiphertext, id)
+		s.repliesLock.Unlock()
+	}()
 	err := s.SendRaw(tree.Root.ServerIdentity, query)
 
 	if err != nil {
@@ -28,28 +80,19 @@ func (s *Service) HandlePlaintextQuery(query *QueryPlaintext) (network.Message,
 	}
 
 	//Wait for CKS to complete
-	log.Lvl1("Waiting for ciphertext UUID :", query.UUID)
-	for {
-		select {
-		case cipher := <-s.SwitchedCiphertext[query.UUID]:
-			log.Lvl1("Got my ciphertext : ", query.UUID)
-			plain := s.DecryptorSk.DecryptNew(&cipher)
-			//todo ask : when decoding the cipher text the values are not what is expected.
-			data64 := s.Encoder.DecodeUint(plain)
-			bytes, err := utils.Uint64ToBytes(data64, true)
-			if err != nil {
-				log.Error("Could not retrieve byte array : ", err)
-			}
-			response := &PlaintextReply{UUID: query.UUID, Data: bytes}
-
-			return response, nil
-		case <-time.After(time.Second):
-			log.Lvl1("Still waiting on ciphertext :", query.UUID)
-			break
+	log.Lvl1("Waiting for ciphertext UUID :", id)
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
 		}
-
+		log.Lvl1("Got my ciphertext : ", id)
+		return reply.Ciphertext, nil
+	case <-cancel:
+		return nil, errJobCancelled
+	case <-time.After(switchTimeout):
+		return nil, errors.New("timeout while waiting for ciphertext " + id.String())
 	}
-
 }
 
 func (s *Service) switchKeys(tree *onet.Tree, id uuid.UUID) (*ReplyPlaintext, error) {
@@ -74,6 +117,9 @@ func (s *Service) switchKeys(tree *onet.Tree, id uuid.UUID) (*ReplyPlaintext, er
 	go pks.Dispatch()
 	log.Lvl1(pks.ServerIdentity(), "waiting for protocol to be finished ")
 	pks.Wait()
+	if pks.Err != nil {
+		return nil, pks.Err
+	}
 
 	//Send the ciphertext to the original asker.
 	reply := ReplyPlaintext{
@@ -82,3 +128,55 @@ func (s *Service) switchKeys(tree *onet.Tree, id uuid.UUID) (*ReplyPlaintext, er
 	}
 	return &reply, err
 }
+
+//switchToPublicKey switches the ciphertext id to the public key with the collective public key switching, every node adds its share of the noise
+//if noise is not nil. Should be called by the root.
+func (s *Service) switchToPublicKey(tree *onet.Tree, id uuid.UUID, ct *bfv.Ciphertext, pk *bfv.PublicKey, noise *utils.NoiseParameters) (*bfv.Ciphertext, error) {
+	//the other nodes get the ciphertext and the key as for the switching to the key of a server.
+	query := &QueryPlaintext{UUID: id, PublicKey: pk, Ciphertext: ct, Noise: noise}
+	err := utils.SendISMOthers(s.ServiceProcessor, &s.Roster, query)
+	if err != nil {
+		return nil, err
+	}
+	s.SwitchingParameters <- SwitchingParamters{PublicKey: *pk, Ciphertext: *ct, Noise: noise}
+	reply, err := s.switchKeys(tree, id)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Ciphertext, nil
+}
+
+//HandleExportCiphertextQuery handler for a client to retrieve the serialized ciphertext stored at the root.
+func (s *Service) HandleExportCiphertextQuery(query *ExportCiphertextQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got request to export ciphertext : ", query.UUID)
+	query.QueryID = uuid.NewV1()
+	return s.sendExportQuery(query.QueryID, query)
+}
+
+//sendExportQuery sends the query to the root and waits for the serialized ciphertext.
+func (s *Service) sendExportQuery(queryID uuid.UUID, query interface{}) (*ExportCiphertextReply, error) {
+	tree := s.Roster.GenerateBinaryTree()
+	replies := make(chan ExportCiphertextReply, 1)
+	s.repliesLock.Lock()
+	s.ExportReplies[queryID] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.ExportReplies, queryID)
+		s.repliesLock.Unlock()
+	}()
+
+	err := s.SendRaw(tree.Root.ServerIdentity, query)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case reply := <-replies:
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
+		}
+		return &reply, nil
+	case <-time.After(evaluationTimeout):
+		return nil, errors.New("timeout while waiting for the ciphertext of query " + queryID.String())
+	}
+}
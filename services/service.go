@@ -6,8 +6,11 @@ import (
 	"github.com/ldsec/lattigo/ring"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
 	uuid "gopkg.in/satori/go.uuid.v1"
 	"lattigo-smc/protocols"
+	"lattigo-smc/utils"
+	"sync"
 )
 
 //Service is the service of lattigoSMC - allows to compute the different HE operations
@@ -21,6 +24,15 @@ type Service struct {
 	*bfv.PublicKey
 	*bfv.EvaluationKey
 	Params *bfv.Parameters
+	//ParamsIdx index of the parameters in bfv.DefaultParams.
+	ParamsIdx uint64
+	//ParamsHash fingerprint of the parameters, confirmed by all the nodes at setup.
+	ParamsHash string
+	//Seed seed of the CRP agreed by all the nodes at setup.
+	Seed []byte
+	//PublicKeyShares shares of the collective public key of all the nodes, indexed by the roster. Only set if the key is verifiable.
+	PublicKeyShares     [][]byte
+	verifiablePublicKey bool
 
 	DecryptorSk bfv.Decryptor
 	Encoder     bfv.Encoder
@@ -30,25 +42,85 @@ type Service struct {
 	evalKeyGenerated    bool
 	rotKeyGenerated     bool
 	DataBase            map[uuid.UUID]*bfv.Ciphertext
+	Metadata            map[uuid.UUID]*Metadata
+	Datasets            map[uuid.UUID]*Dataset
+	Names               map[string]uuid.UUID
 	LocalUUID           map[uuid.UUID]chan uuid.UUID
 	Ckgp                *protocols.CollectiveKeyGenerationProtocol
 	crpGen              ring.CRPGenerator
-	SwitchedCiphertext  map[uuid.UUID]chan bfv.Ciphertext
+	SwitchedCiphertext  map[uuid.UUID]chan ReplyPlaintext
 	SwitchingParameters chan SwitchingParamters
 	RotationKey         *bfv.RotationKeys
 
-	SumReplies      map[SumQuery]chan uuid.UUID
-	MultiplyReplies map[MultiplyQuery]chan uuid.UUID
-	RotationReplies map[uuid.UUID]chan uuid.UUID
+	SumReplies      map[SumQuery]chan SumReply
+	MultiplyReplies map[MultiplyQuery]chan MultiplyReply
+	RotationReplies map[uuid.UUID]chan RotationReply
+	//EvaluationReplies channels for the replies of the root, indexed by the id of the query.
+	EvaluationReplies map[uuid.UUID]chan EvaluationReply
+	DatasetReplies    map[uuid.UUID]chan DatasetReply
+	ExportReplies     map[uuid.UUID]chan ExportCiphertextReply
+	CatalogReplies    map[uuid.UUID]chan CatalogReply
+	StatusReplies     map[uuid.UUID]chan NodeStatusReply
+	KeyReplies        map[uuid.UUID]chan CollectiveKeyReply
+	//RekeyAcks channels for the acknowledgements of the new collective public key, indexed by its epoch.
+	RekeyAcks map[uint64]chan RekeyAck
+	//repliesLock protects the channels of the replies above, LocalUUID and SwitchedCiphertext. The handlers register them while the replies
+	//of other queries are processed concurrently.
+	repliesLock sync.Mutex
 
 	RefreshParams chan *bfv.Ciphertext
-	RotIdx        int
-	K             uint64
+	//KeySwitchParams ciphertexts to be switched to the new key during a rekeying, in the order of the protocols.
+	KeySwitchParams chan *bfv.Ciphertext
+	//KeyEpoch number of rekeyings of the collective key.
+	KeyEpoch uint64
+	//RosterVersion number of changes of the members of the roster since the setup.
+	RosterVersion uint64
+	nextRoster    *onet.Roster
+	//rekeyLock serializes the rekeyings at the root.
+	rekeyLock sync.Mutex
+	//Approvals the members that approved a subject with their signature, indexed by the subject.
+	Approvals map[string]map[network.ServerIdentityID]bool
+	//approvalsLock protects Approvals, the members approve concurrently.
+	approvalsLock sync.Mutex
+	//nextSecretKey new secret key share generated for the rekeying, nil if no rekeying is in progress.
+	nextSecretKey *bfv.SecretKey
+	//nextPublicKey and nextPublicKeyShares the new collective public key checked by the node if it is verifiable.
+	nextPublicKey       *bfv.PublicKey
+	nextPublicKeyShares [][]byte
+	//RotationParams rotation keys to be generated, in the order of the protocols.
+	RotationParams *rotationQueue
+	//Rotations the rotation keys requested at setup.
+	Rotations []RotationParameters
+	//StoreCapacity maximum size in bytes of the ciphertexts stored at the root, 0 for no limit.
+	StoreCapacity uint64
+	//PrivacyBudget maximum epsilon spent on a dataset by the results decrypted with noise, 0 for no limit.
+	PrivacyBudget float64
+	//Sensitivity minimum sensitivity of the noise added to the results decrypted with a privacy budget.
+	Sensitivity float64
+
+	//Analysts the analysts registered at the root, indexed by their name.
+	Analysts map[string]*Analyst
+	//Federations the federated datasets contributed by the members, indexed by their name.
+	Federations map[string]*Federation
+
+	//storeLock protects DataBase, Metadata, Datasets, Names, the Analysts with their results and the Federations with their contributions. The messages are processed concurrently, and the handlers refresh
+	//and switch the stored ciphertexts in their own goroutines.
+	storeLock sync.Mutex
+
+	//keyCache the collective keys serialized for the clients, indexed by their type.
+	keyCache     map[KeyType]*serializedKey
+	keyCacheLock sync.Mutex
+
+	//Jobs the jobs submitted to this server, indexed by their id.
+	Jobs     map[uuid.UUID]*Job
+	jobsLock sync.Mutex
+	jobQueue chan *Job
 }
 
 type SwitchingParamters struct {
 	bfv.PublicKey
 	bfv.Ciphertext
+	Noise *utils.NoiseParameters
 }
 
 func NewLattigoSMCService(c *onet.Context) (onet.Service, error) {
@@ -57,15 +129,36 @@ func NewLattigoSMCService(c *onet.Context) (onet.Service, error) {
 	newLattigo := &Service{
 		ServiceProcessor: onet.NewServiceProcessor(c),
 		DataBase:         make(map[uuid.UUID]*bfv.Ciphertext),
+		Metadata:         make(map[uuid.UUID]*Metadata),
+		Datasets:         make(map[uuid.UUID]*Dataset),
+		Names:            make(map[string]uuid.UUID),
 		LocalUUID:        make(map[uuid.UUID]chan uuid.UUID),
 
-		SwitchedCiphertext:  make(map[uuid.UUID]chan bfv.Ciphertext),
+		SwitchedCiphertext:  make(map[uuid.UUID]chan ReplyPlaintext),
 		SwitchingParameters: make(chan SwitchingParamters, 10),
 
-		SumReplies:      make(map[SumQuery]chan uuid.UUID),
-		MultiplyReplies: make(map[MultiplyQuery]chan uuid.UUID),
+		SumReplies:      make(map[SumQuery]chan SumReply),
+		MultiplyReplies: make(map[MultiplyQuery]chan MultiplyReply),
 		RefreshParams:   make(chan *bfv.Ciphertext, 3),
-		RotationReplies: make(map[uuid.UUID]chan uuid.UUID),
+		KeySwitchParams: make(chan *bfv.Ciphertext, 3),
+		RotationParams:  newRotationQueue(),
+		RotationReplies: make(map[uuid.UUID]chan RotationReply),
+
+		EvaluationReplies: make(map[uuid.UUID]chan EvaluationReply),
+		DatasetReplies:    make(map[uuid.UUID]chan DatasetReply),
+		ExportReplies:     make(map[uuid.UUID]chan ExportCiphertextReply),
+		CatalogReplies:    make(map[uuid.UUID]chan CatalogReply),
+		StatusReplies:     make(map[uuid.UUID]chan NodeStatusReply),
+		KeyReplies:        make(map[uuid.UUID]chan CollectiveKeyReply),
+		RekeyAcks:         make(map[uint64]chan RekeyAck),
+		Approvals:         make(map[string]map[network.ServerIdentityID]bool),
+
+		Analysts:    make(map[string]*Analyst),
+		Federations: make(map[string]*Federation),
+		keyCache:    make(map[KeyType]*serializedKey),
+
+		Jobs:     make(map[uuid.UUID]*Job),
+		jobQueue: make(chan *Job, jobQueueSize),
 	}
 	//registering the handlers
 	e := registerHandlers(newLattigo)
@@ -73,6 +166,8 @@ func NewLattigoSMCService(c *onet.Context) (onet.Service, error) {
 		return nil, e
 	}
 	registerProcessors(c, newLattigo)
+	go newLattigo.runJobs()
+	go newLattigo.scheduleGarbageCollection()
 
 	return newLattigo, nil
 }
@@ -105,6 +200,96 @@ func registerHandlers(newLattigo *Service) error {
 	if err := newLattigo.RegisterHandler(newLattigo.HandleRotationQuery); err != nil {
 		return errors.New("Wrong handler 11 : " + err.Error())
 	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleSubQuery); err != nil {
+		return errors.New("Wrong handler 12 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleNegQuery); err != nil {
+		return errors.New("Wrong handler 13 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandlePlaintextOperationQuery); err != nil {
+		return errors.New("Wrong handler 14 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleScalarOperationQuery); err != nil {
+		return errors.New("Wrong handler 15 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleInnerSumQuery); err != nil {
+		return errors.New("Wrong handler 16 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleInnerProductQuery); err != nil {
+		return errors.New("Wrong handler 17 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleReplicateQuery); err != nil {
+		return errors.New("Wrong handler 18 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleMatrixVectorQuery); err != nil {
+		return errors.New("Wrong handler 19 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandlePolynomialQuery); err != nil {
+		return errors.New("Wrong handler 20 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleImportCiphertextQuery); err != nil {
+		return errors.New("Wrong handler 21 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleExportCiphertextQuery); err != nil {
+		return errors.New("Wrong handler 22 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleStorageQuery); err != nil {
+		return errors.New("Wrong handler 23 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleCatalogQuery); err != nil {
+		return errors.New("Wrong handler 24 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleNameQuery); err != nil {
+		return errors.New("Wrong handler 25 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleSubmitJobQuery); err != nil {
+		return errors.New("Wrong handler 26 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleJobQuery); err != nil {
+		return errors.New("Wrong handler 27 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleStatusQuery); err != nil {
+		return errors.New("Wrong handler 28 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleCollectiveKeyQuery); err != nil {
+		return errors.New("Wrong handler 29 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleKeyFingerprintQuery); err != nil {
+		return errors.New("Wrong handler 30 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandlePublicKeyTranscriptQuery); err != nil {
+		return errors.New("Wrong handler 31 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleRekeyQuery); err != nil {
+		return errors.New("Wrong handler 32 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleMembershipQuery); err != nil {
+		return errors.New("Wrong handler 33 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleTransferQuery); err != nil {
+		return errors.New("Wrong handler 34 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleAnalystRegistrationQuery); err != nil {
+		return errors.New("Wrong handler 35 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleAnalystResultQuery); err != nil {
+		return errors.New("Wrong handler 36 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleAnalystDownloadQuery); err != nil {
+		return errors.New("Wrong handler 37 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleStatisticsQuery); err != nil {
+		return errors.New("Wrong handler 38 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleContributionQuery); err != nil {
+		return errors.New("Wrong handler 39 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleAggregationQuery); err != nil {
+		return errors.New("Wrong handler 40 : " + err.Error())
+	}
+	if err := newLattigo.RegisterHandler(newLattigo.HandleApprovalQuery); err != nil {
+		return errors.New("Wrong handler 41 : " + err.Error())
+	}
 	return nil
 }
 
@@ -124,4 +309,42 @@ func registerProcessors(c *onet.Context, newLattigo *Service) {
 	c.RegisterProcessor(newLattigo, msgTypes.msgRefreshQuery)
 	c.RegisterProcessor(newLattigo, msgTypes.msgRotationQuery)
 	c.RegisterProcessor(newLattigo, msgTypes.msgRotationReply)
+	c.RegisterProcessor(newLattigo, msgTypes.msgSubQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgNegQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgPlaintextOperationQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgScalarOperationQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgEvaluationReply)
+	c.RegisterProcessor(newLattigo, msgTypes.msgInnerSumQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgInnerProductQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgReplicateQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgRotationKeyRequest)
+	c.RegisterProcessor(newLattigo, msgTypes.msgMatrixVectorQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgPolynomialQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgStoreDatasetQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgDatasetQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgDatasetReply)
+	c.RegisterProcessor(newLattigo, msgTypes.msgImportCiphertextQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgExportCiphertextQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgExportCiphertextReply)
+	c.RegisterProcessor(newLattigo, msgTypes.msgStorageQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgCatalogQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgCatalogReply)
+	c.RegisterProcessor(newLattigo, msgTypes.msgNameQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgStatusQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgNodeStatusReply)
+	c.RegisterProcessor(newLattigo, msgTypes.msgCollectiveKeyQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgCollectiveKeyReply)
+	c.RegisterProcessor(newLattigo, msgTypes.msgRekeyQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgRekeyRequest)
+	c.RegisterProcessor(newLattigo, msgTypes.msgRekeyAck)
+	c.RegisterProcessor(newLattigo, msgTypes.msgMembershipQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgApprovalQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgTransferQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgAnalystRegistrationQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgAnalystResultQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgAnalystDownloadQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgStatisticsQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgContributionQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgAggregationQuery)
+	c.RegisterProcessor(newLattigo, msgTypes.msgGarbageCollectionQuery)
 }
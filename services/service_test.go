@@ -2,11 +2,15 @@ package services
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"github.com/golangplus/testing/assert"
 	"github.com/ldsec/lattigo/bfv"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
+	uuid "gopkg.in/satori/go.uuid.v1"
 	"lattigo-smc/utils"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -394,3 +398,1714 @@ func TestRotation(t *testing.T) {
 
 	return
 }
+
+func TestPlaintextOperations(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	id, err := client1.SendWriteQuery(el, data)
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+
+	weights := []uint64{2, 2, 2, 2, 3, 3, 3, 3}
+	//(data * weights + 10) - data and then negated.
+	res, err := client1.SendPlaintextMultiplyQuery(*id, weights)
+	if err != nil {
+		t.Fatal("Could not multiply by plaintext :", err)
+	}
+	res, err = client1.SendScalarAddQuery(res, 10)
+	if err != nil {
+		t.Fatal("Could not add scalar :", err)
+	}
+	res, err = client1.SendSubQuery(res, *id)
+	if err != nil {
+		t.Fatal("Could not subtract :", err)
+	}
+	res, err = client1.SendNegQuery(res)
+	if err != nil {
+		t.Fatal("Could not negate :", err)
+	}
+
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	got, err := client2.GetPlaintext(&res)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+
+	T := bfv.DefaultParams[0].T
+	expected := make([]byte, len(data))
+	for i := range data {
+		v := (uint64(data[i])*weights[i] + 10 + T - uint64(data[i])) % T
+		expected[i] = byte((T - v) % T)
+	}
+	assert.Equal(t, "Plaintext operations", got[:len(data)], expected)
+}
+
+func TestInnerSumAndReplicate(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	//the rotation keys for the inner sum are generated with the requested one.
+	err := client.SendSetupQuery(el, true, false, true, 1, bfv.RotationLeft, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, true, 0)
+	<-time.After(500 * time.Millisecond)
+
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	id, err := client1.SendWriteQuery(el, data)
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+
+	sum, err := client1.SendInnerSumQuery(*id)
+	if err != nil {
+		t.Fatal("Could not compute inner sum :", err)
+	}
+	replicated, err := client1.SendReplicateQuery(*id, 3)
+	if err != nil {
+		t.Fatal("Could not replicate slot :", err)
+	}
+
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	gotSum, err := client2.GetPlaintext(&sum)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	gotReplicated, err := client2.GetPlaintext(&replicated)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+
+	for i := range gotSum {
+		assert.Equal(t, "Inner sum", gotSum[i], byte(36))
+		assert.Equal(t, "Replicate", gotReplicated[i], data[3])
+	}
+}
+
+func TestMatrixVector(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	vector := []byte{1, 2, 3}
+	id, err := client1.SendWriteQuery(el, vector)
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+
+	//the rotation keys are generated at the root from the dimension of the matrix.
+	matrix := [][]uint64{{1, 0, 2}, {0, 3, 1}, {4, 1, 0}}
+	res, err := client1.SendMatrixVectorQuery(*id, matrix)
+	if err != nil {
+		t.Fatal("Could not multiply by the matrix :", err)
+	}
+
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	got, err := client2.GetPlaintext(&res)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+
+	for i, row := range matrix {
+		expected := uint64(0)
+		for j, m := range row {
+			expected += m * uint64(vector[j])
+		}
+		assert.Equal(t, "Matrix vector product", got[i], byte(expected))
+	}
+}
+
+func TestPolynomial(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, true, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	id, err := client1.SendWriteQuery(el, data)
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+
+	//p(x) = 3 + 2x + x^2
+	coeffs := []uint64{3, 2, 1}
+	res, err := client1.SendPolynomialQuery(*id, coeffs)
+	if err != nil {
+		t.Fatal("Could not evaluate polynomial :", err)
+	}
+
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	got, err := client2.GetPlaintext(&res)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+
+	for i, x := range data {
+		expected := 3 + 2*uint64(x) + uint64(x)*uint64(x)
+		assert.Equal(t, "Polynomial", got[i], byte(expected))
+	}
+}
+
+func TestPolynomialWithRefresh(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	//x^8 needs a depth of 3, more than the budget of the parameters : the evaluation has to refresh the powers.
+	params := bfv.DefaultParams[0]
+	if utils.DepthBudget(params) >= 3 {
+		t.Fatal("Depth budget of the parameters is too large to test the refresh")
+	}
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, true, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	id, err := client1.SendWriteQuery(el, data)
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+
+	//p(x) = 1 + x + x^8
+	coeffs := []uint64{1, 1, 0, 0, 0, 0, 0, 0, 1}
+	res, err := client1.SendPolynomialQuery(*id, coeffs)
+	if err != nil {
+		t.Fatal("Could not evaluate polynomial :", err)
+	}
+
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	got, err := client2.GetPlaintext(&res)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+
+	for i, x := range data {
+		power := uint64(1)
+		for j := 0; j < 8; j++ {
+			power = power * uint64(x) % params.T
+		}
+		expected := (1 + uint64(x) + power) % params.T
+		assert.Equal(t, "Polynomial with refresh", got[i], byte(expected))
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	ints := []int64{-1000, -1, 0, 1, 1000}
+	id1, err := client1.SendTypedWriteQuery(el, utils.NewInts(ints))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	text := "lattigo smc"
+	id2, err := client1.SendTypedWriteQuery(el, utils.NewString(text))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+
+	//the type is kept by the evaluation.
+	res, err := client1.SendNegQuery(*id1)
+	if err != nil {
+		t.Fatal("Could not negate :", err)
+	}
+
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	got, err := client2.GetTypedPlaintext(&res)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	assert.Equal(t, "Type", got.Descriptor.Type, utils.TypeInt)
+	assert.Equal(t, "Length", len(got.Ints), len(ints))
+	for i, v := range ints {
+		assert.Equal(t, "Negation", got.Ints[i], -v)
+	}
+
+	gotText, err := client2.GetTypedPlaintext(id2)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	assert.Equal(t, "String", gotText.Text(), text)
+}
+
+func TestLargeDataset(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	//the data needs three ciphertexts.
+	values := make([]uint64, 2*(1<<bfv.DefaultParams[0].LogN)+10)
+	for i := range values {
+		values[i] = uint64(i % 1000)
+	}
+	id, err := client1.SendTypedWriteQuery(el, utils.NewUints(values))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+
+	sum, err := client1.SendSumQuery(*id, *id)
+	if err != nil {
+		t.Fatal("Could not sum :", err)
+	}
+
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	got, err := client2.GetTypedPlaintext(&sum)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	assert.Equal(t, "Length", len(got.Uints), len(values))
+	for i, v := range values {
+		assert.Equal(t, "Sum", got.Uints[i], 2*v)
+	}
+}
+
+func TestImportExportCiphertext(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	ints := []int64{-5, 0, 5}
+	id, err := client1.SendTypedWriteQuery(el, utils.NewInts(ints))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+
+	data, descriptor, err := client1.GetCiphertext(*id)
+	if err != nil {
+		t.Fatal("Could not export ciphertext :", err)
+	}
+	assert.Equal(t, "Descriptor", descriptor.Type, utils.TypeInt)
+
+	//the exported ciphertext is imported back as a new ciphertext.
+	imported, err := client1.SendImportCiphertextQuery(data, descriptor)
+	if err != nil {
+		t.Fatal("Could not import ciphertext :", err)
+	}
+
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	got, err := client2.GetTypedPlaintext(&imported)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	for i, v := range ints {
+		assert.Equal(t, "Imported", got.Ints[i], v)
+	}
+
+	//a ciphertext with other parameters is rejected.
+	other := bfv.NewCiphertext(bfv.DefaultParams[1], 1)
+	otherData, _ := other.MarshalBinary()
+	_, err = client1.SendImportCiphertextQuery(otherData, utils.DataDescriptor{})
+	if err == nil {
+		t.Fatal("Ciphertext with other parameters should be rejected")
+	}
+}
+
+func TestDeleteAndExpire(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	id1, err := client1.SendWriteQuery(el, []byte("lattigo"))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	id2, err := client1.SendWriteQuery(el, []byte("smc"))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+
+	//a retained ciphertext needs two deletions.
+	err = client1.SendRetainQuery(*id1)
+	if err != nil {
+		t.Fatal("Could not retain :", err)
+	}
+	err = client1.SendDeleteQuery(*id1)
+	if err != nil {
+		t.Fatal("Could not delete :", err)
+	}
+	_, err = client1.GetPlaintext(id1)
+	if err != nil {
+		t.Fatal("Ciphertext with a reference left should still exist :", err)
+	}
+	err = client1.SendDeleteQuery(*id1)
+	if err != nil {
+		t.Fatal("Could not delete :", err)
+	}
+	_, err = client1.GetPlaintext(id1)
+	if err == nil {
+		t.Fatal("Deleted ciphertext should not exist")
+	}
+
+	err = client1.SendExpireQuery(*id2, time.Second)
+	if err != nil {
+		t.Fatal("Could not set time to live :", err)
+	}
+	<-time.After(2 * time.Second)
+	_, err = client1.GetPlaintext(id2)
+	if err == nil {
+		t.Fatal("Expired ciphertext should not exist")
+	}
+}
+
+func TestStoreCapacity(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	//room for a single fresh ciphertext.
+	params := bfv.DefaultParams[0]
+	capacity := uint64(2*len(params.Moduli.Qi)*8) << params.LogN
+	request := SetupRequest{Roster: *el, Seed: seed, GeneratePublicKey: true, StoreCapacity: capacity}
+	err := client.SendSetupRequest(&request)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	id, err := client1.SendWriteQuery(el, []byte("lattigo"))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	_, err = client1.SendWriteQuery(el, []byte("smc"))
+	if err == nil {
+		t.Fatal("Write over the capacity should be rejected")
+	}
+
+	//deleting frees the space.
+	err = client1.SendDeleteQuery(*id)
+	if err != nil {
+		t.Fatal("Could not delete :", err)
+	}
+	id2, err := client1.SendWriteQuery(el, []byte("smc"))
+	if err != nil {
+		t.Fatal("Could not write data after deletion :", err)
+	}
+
+	//the results of the evaluations count against the capacity too.
+	_, err = client1.SendScalarMultiplyQuery(*id2, 2)
+	if err == nil {
+		t.Fatal("Evaluation over the capacity should be rejected")
+	}
+	_, err = client1.SendSumQuery(*id2, *id2)
+	if err == nil {
+		t.Fatal("Sum over the capacity should be rejected")
+	}
+	_, err = client1.SendMultiplyQuery(*id2, *id2)
+	if err == nil {
+		t.Fatal("Multiplication over the capacity should be rejected")
+	}
+}
+
+func TestReleaseIntermediates(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	id, err := client1.SendWriteQuery(el, []byte("lattigo"))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+	intermediate, err := client1.SendScalarAddQuery(*id, 1)
+	if err != nil {
+		t.Fatal("Could not add scalar :", err)
+	}
+	result, err := client1.SendScalarMultiplyQuery(intermediate, 2)
+	if err != nil {
+		t.Fatal("Could not multiply by scalar :", err)
+	}
+
+	//the intermediate is kept as long as the result computed from it exists.
+	err = client1.SendDeleteQuery(intermediate)
+	if err != nil {
+		t.Fatal("Could not delete :", err)
+	}
+	_, err = client1.GetPlaintext(&intermediate)
+	if err != nil {
+		t.Fatal("Intermediate of an existing result should still exist :", err)
+	}
+	err = client1.SendDeleteQuery(result)
+	if err != nil {
+		t.Fatal("Could not delete :", err)
+	}
+	_, err = client1.GetPlaintext(&intermediate)
+	if err == nil {
+		t.Fatal("Intermediate should be removed with the last result computed from it")
+	}
+	_, err = client1.GetPlaintext(id)
+	if err != nil {
+		t.Fatal("Ciphertext that was not deleted should still exist :", err)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	id1, err := client1.SendWriteQuery(el, []byte("lattigo"))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	id2, err := client1.SendWriteQuery(el, []byte("smc"))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+	sum, err := client1.SendSumQuery(*id1, *id2)
+	if err != nil {
+		t.Fatal("Could not sum :", err)
+	}
+
+	entries, total, err := client1.SendCatalogQuery(&CatalogQuery{})
+	if err != nil {
+		t.Fatal("Could not get the catalog :", err)
+	}
+	assert.Equal(t, "Total", total, uint64(3))
+	assert.Equal(t, "Entries", len(entries), 3)
+	//the entries are sorted by creation time.
+	assert.Equal(t, "First", entries[0].UUID, *id1)
+	assert.Equal(t, "Operation", entries[0].Operation, "write")
+
+	entries, total, err = client1.SendCatalogQuery(&CatalogQuery{Operation: "sum"})
+	if err != nil {
+		t.Fatal("Could not get the catalog :", err)
+	}
+	assert.Equal(t, "Total", total, uint64(1))
+	assert.Equal(t, "Sum", entries[0].UUID, sum)
+	assert.Equal(t, "Inputs", len(entries[0].Inputs), 2)
+	assert.Equal(t, "Degree", entries[0].Degree, uint64(1))
+
+	entries, total, err = client1.SendCatalogQuery(&CatalogQuery{Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatal("Could not get the catalog :", err)
+	}
+	assert.Equal(t, "Total", total, uint64(3))
+	assert.Equal(t, "Page", len(entries), 1)
+	assert.Equal(t, "Second", entries[0].UUID, *id2)
+}
+
+func TestNames(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	data := []byte("lattigo")
+	id, err := client1.SendWriteQuery(el, data)
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+
+	err = client1.SendRegisterNameQuery("hospitalA/age", *id)
+	if err != nil {
+		t.Fatal("Could not register name :", err)
+	}
+	err = client1.SendRegisterNameQuery("hospitalA/age", *id)
+	if err == nil {
+		t.Fatal("Registered twice should fail")
+	}
+	err = client1.SendAliasQuery("hospitalA/age", "age")
+	if err != nil {
+		t.Fatal("Could not alias name :", err)
+	}
+
+	//the names can be used on any server.
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	resolved, err := client2.Reference("age")
+	if err != nil {
+		t.Fatal("Could not resolve name :", err)
+	}
+	assert.Equal(t, "Alias", resolved, *id)
+
+	//the name stays valid after a refresh.
+	_, err = client2.SendRefreshQuery(&resolved)
+	if err != nil {
+		t.Fatal("Could not refresh :", err)
+	}
+	err = client1.SendRenameQuery("hospitalA/age", "hospitalB/age")
+	if err != nil {
+		t.Fatal("Could not rename :", err)
+	}
+	_, err = client1.Resolve("hospitalA/age")
+	if err == nil {
+		t.Fatal("Old name should fail")
+	}
+	resolved, err = client1.Reference("hospitalB/age")
+	if err != nil {
+		t.Fatal("Could not resolve name :", err)
+	}
+	res, err := client1.GetPlaintext(&resolved)
+	if err != nil {
+		t.Fatal("Could not decrypt :", err)
+	}
+	assert.Equal(t, "Plaintext", res[:len(data)], data)
+
+	//the evaluation and decryption queries accept the names, the root resolves them.
+	sum, err := client2.SendEvaluationQuery(&SumQuery{Name: "hospitalB/age", OtherName: "age"})
+	if err != nil {
+		t.Fatal("Could not sum by name :", err)
+	}
+	res, err = client1.GetPlaintext(&sum)
+	if err != nil {
+		t.Fatal("Could not decrypt :", err)
+	}
+	for i, b := range data {
+		assert.Equal(t, "Sum", res[i], 2*b)
+	}
+	neg, err := client2.SendEvaluationQuery(&NegQuery{Operands: Operands{Name: "hospitalB/age"}})
+	if err != nil {
+		t.Fatal("Could not negate by name :", err)
+	}
+	_, err = client2.SendEvaluationQuery(&NegQuery{Operands: Operands{Name: "hospitalA/age"}})
+	if err == nil {
+		t.Fatal("Evaluation on an unregistered name should fail")
+	}
+	//the root replies with the resolution error instead of leaving the server waiting.
+	_, err = client2.SendEvaluationQuery(&SumQuery{Name: "hospitalA/age", OtherName: "age"})
+	if err == nil || !strings.Contains(err.Error(), "is not registered") {
+		t.Fatal("Sum on an unregistered name should fail with the resolution error :", err)
+	}
+	_, err = client2.SendEvaluationQuery(&MultiplyQuery{Name: "age", OtherName: "hospitalA/age"})
+	if err == nil || !strings.Contains(err.Error(), "is not registered") {
+		t.Fatal("Multiplication on an unregistered name should fail with the resolution error :", err)
+	}
+	_, err = client1.GetNamedPlaintext("age", nil)
+	if err != nil {
+		t.Fatal("Could not decrypt by name :", err)
+	}
+	err = client1.SendDeleteQuery(sum)
+	if err != nil {
+		t.Fatal("Could not delete :", err)
+	}
+	//the results hold a reference to their inputs.
+	err = client1.SendDeleteQuery(neg)
+	if err != nil {
+		t.Fatal("Could not delete :", err)
+	}
+
+	//the names hold a reference to the ciphertext.
+	err = client1.SendDeleteQuery(*id)
+	if err != nil {
+		t.Fatal("Could not delete :", err)
+	}
+	_, err = client1.GetPlaintext(&resolved)
+	if err != nil {
+		t.Fatal("Named ciphertext was removed :", err)
+	}
+
+	err = client1.SendUnregisterNameQuery("hospitalB/age")
+	if err != nil {
+		t.Fatal("Could not unregister :", err)
+	}
+	err = client1.SendUnregisterNameQuery("age")
+	if err != nil {
+		t.Fatal("Could not unregister :", err)
+	}
+	_, err = client1.GetPlaintext(&resolved)
+	if err == nil {
+		t.Fatal("Removed ciphertext should fail")
+	}
+}
+
+func TestJobs(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	jobID, err := client.SubmitSetupJob(&SetupRequest{Roster: *el, Seed: seed, GeneratePublicKey: true})
+	if err != nil {
+		t.Fatal("Could not submit setup :", err)
+	}
+	//the setup job replies right away.
+	status, err := client.GetJobStatus(jobID)
+	if err != nil {
+		t.Fatal("Could not get job status :", err)
+	}
+	assert.Equal(t, "Not finished", status.Status == JobDone || status.Status == JobFailed, false)
+	_, err = client.WaitJob(jobID, 20*time.Second)
+	if err != nil {
+		t.Fatal("Setup failed :", err)
+	}
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	values := utils.NewUints([]uint64{1, 2, 3})
+	jobID, err = client1.SubmitWriteJob(el, values)
+	if err != nil {
+		t.Fatal("Could not submit write :", err)
+	}
+	status, err = client1.WaitJob(jobID, 10*time.Second)
+	if err != nil {
+		t.Fatal("Write failed :", err)
+	}
+	assert.Equal(t, "Write done", status.Status, JobDone)
+	id := status.UUID
+
+	plaintextJob, err := client1.SubmitPlaintextJob(id)
+	if err != nil {
+		t.Fatal("Could not submit decryption :", err)
+	}
+	//the refresh is queued behind the decryption and cancelled before it runs.
+	jobID, err = client1.SubmitRefreshJob(id)
+	if err != nil {
+		t.Fatal("Could not submit refresh :", err)
+	}
+	err = client1.CancelJob(jobID)
+	if err != nil {
+		t.Fatal("Could not cancel :", err)
+	}
+	status, err = client1.WaitJob(jobID, 10*time.Second)
+	if err == nil {
+		t.Fatal("Cancelled job should fail")
+	}
+	assert.Equal(t, "Cancelled", status.Status, JobFailed)
+
+	status, err = client1.WaitJob(plaintextJob, 10*time.Second)
+	if err != nil {
+		t.Fatal("Decryption failed :", err)
+	}
+	assert.Equal(t, "Values", status.Plaintext.Values.Uints, values.Uints)
+
+	jobID = plaintextJob
+	err = client1.CancelJob(jobID)
+	if err == nil {
+		t.Fatal("Cancelling a finished job should fail")
+	}
+}
+
+func TestPruneJobs(t *testing.T) {
+	s := &Service{Jobs: make(map[uuid.UUID]*Job)}
+	expired := &Job{ID: uuid.NewV1(), Status: JobDone, finished: time.Now().Add(-2 * jobRetention)}
+	recent := &Job{ID: uuid.NewV1(), Status: JobFailed, finished: time.Now()}
+	running := &Job{ID: uuid.NewV1(), Status: JobRunning}
+	for _, job := range []*Job{expired, recent, running} {
+		s.Jobs[job.ID] = job
+	}
+	s.pruneJobs()
+	_, ok := s.Jobs[expired.ID]
+	assert.Equal(t, "Expired", ok, false)
+	_, ok = s.Jobs[recent.ID]
+	assert.Equal(t, "Recent", ok, true)
+	_, ok = s.Jobs[running.ID]
+	assert.Equal(t, "Running", ok, true)
+}
+
+func TestStatus(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	status, err := client1.GetStatus()
+	if err != nil {
+		t.Fatal("Could not get the status :", err)
+	}
+	assert.Equal(t, "Nodes", len(status.Nodes), size)
+	assert.Equal(t, "Agree", status.Agree, true)
+	for _, node := range status.Nodes {
+		assert.Equal(t, "Setup", node.Setup, true)
+		assert.Equal(t, "Public key", node.PublicKey, true)
+		assert.Equal(t, "Evaluation key", node.EvaluationKey, false)
+		assert.Equal(t, "Seed", node.Seed, status.Nodes[0].Seed)
+	}
+	//the nodes agreed on a seed that is not the one of the client.
+	assert.Equal(t, "Agreed seed", status.Nodes[0].Seed != "" && status.Nodes[0].Seed != hex.EncodeToString(seed), true)
+	//the root and the server that requested the key hold the same collective public key.
+	assert.Equal(t, "Root fingerprint", status.Nodes[0].Fingerprint != "", true)
+	assert.Equal(t, "Fingerprint", status.Nodes[1].Fingerprint, status.Nodes[0].Fingerprint)
+}
+
+func TestRetrieveKeys(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, true, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	pk, fingerprint, err := client2.GetPublicKey()
+	if err != nil {
+		t.Fatal("Could not retrieve the public key :", err)
+	}
+	//the root and the server that requested the key hold the same key.
+	confirmed, err := client2.VerifyKeyFingerprint(el, KeyPublic, fingerprint)
+	if err != nil {
+		t.Fatal("Fingerprint mismatch :", err)
+	}
+	assert.Equal(t, "Confirmed", confirmed, 2)
+
+	_, _, err = client2.GetEvaluationKey()
+	if err != nil {
+		t.Fatal("Could not retrieve the evaluation key :", err)
+	}
+	_, _, err = client2.GetRotationKeys()
+	if err == nil {
+		t.Fatal("Rotation keys were not generated")
+	}
+
+	//the client encrypts with the retrieved key and the roster decrypts.
+	params := bfv.DefaultParams[0]
+	values := []uint64{1, 2, 3}
+	pt := bfv.NewPlaintext(params)
+	bfv.NewEncoder(params).EncodeUint(values, pt)
+	ct := bfv.NewEncryptorFromPk(params, pk).EncryptNew(pt)
+	data, _ := ct.MarshalBinary()
+	id, err := client2.SendImportCiphertextQuery(data, utils.DataDescriptor{Type: utils.TypeUint, Length: uint64(len(values))})
+	if err != nil {
+		t.Fatal("Could not import the ciphertext :", err)
+	}
+	got, err := client2.GetTypedPlaintext(&id)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	assert.Equal(t, "Values", got.Uints, values)
+}
+
+func TestVerifiablePublicKey(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupRequest(&SetupRequest{Roster: *el, Seed: seed, GeneratePublicKey: true, VerifiablePublicKey: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(2 * time.Second)
+
+	//every server checked the key of the root and holds the transcript.
+	var expected []byte
+	for i, si := range el.List {
+		pk, transcript, err := NewLattigoSMCClient(si, strconv.Itoa(i)).GetPublicKeyTranscript()
+		if err != nil {
+			t.Fatal("Could not verify the public key of ", si, " : ", err)
+		}
+		assert.Equal(t, "Shares", len(transcript.Shares), size)
+		data, _ := pk.MarshalBinary()
+		if expected != nil {
+			assert.Equal(t, "Public key", data, expected)
+		}
+		expected = data
+	}
+
+	//a transcript with a substituted share does not verify.
+	_, transcript, err := client.GetPublicKeyTranscript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcript.Shares[1] = transcript.Shares[2]
+	_, err = VerifyPublicKeyTranscript(transcript)
+	if err == nil {
+		t.Fatal("Transcript with a substituted share was verified")
+	}
+}
+
+func TestRekey(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	servers, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(2 * time.Second)
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	//only the root drives the rekeying.
+	member := servers[1].Service(ServiceName).(*Service)
+	err = member.rekeyPhase(el.List[2], &RekeyRequest{Phase: RekeyAbort})
+	if err == nil {
+		t.Fatal("A rekey request of a server that is not the root should be refused")
+	}
+
+	before := []byte("before rekey")
+	id, err := client1.SendWriteQuery(el, before)
+	if err != nil {
+		t.Fatal("Could not write :", err)
+	}
+	status, err := client1.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldFingerprint := status.Nodes[0].Fingerprint
+
+	err = client1.SendRekeyQuery()
+	if err != nil {
+		t.Fatal("Could not rotate the key :", err)
+	}
+	<-time.After(500 * time.Millisecond)
+
+	//all the nodes use the new key, the server that held the public key got the new one.
+	status, err = client1.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Agree", status.Agree, true)
+	assert.Equal(t, "Epoch", status.Nodes[0].KeyEpoch, uint64(1))
+	assert.Equal(t, "New key", status.Nodes[0].Fingerprint != oldFingerprint, true)
+	assert.Equal(t, "Fingerprint", status.Nodes[1].Fingerprint, status.Nodes[0].Fingerprint)
+
+	//the ciphertext written before the rekeying is decrypted with the new shares.
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	data, err := client2.GetPlaintext(id)
+	if err != nil {
+		t.Fatal("Could not decrypt the switched ciphertext :", err)
+	}
+	assert.Equal(t, "Switched", string(data[0:len(before)]), string(before))
+
+	after := []byte("after rekey")
+	id, err = client1.SendWriteQuery(el, after)
+	if err != nil {
+		t.Fatal("Could not write :", err)
+	}
+	data, err = client2.GetPlaintext(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "New key", string(data[0:len(after)]), string(after))
+}
+
+func TestMembership(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 4
+	local := onet.NewLocalTest(utils.SUITE)
+	servers, el, _ := local.GenTree(size, true)
+	//the session starts with the first 3 servers, the last one joins later.
+	members := onet.NewRoster(el.List[:3])
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(members, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(2 * time.Second)
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	before := []byte("before join")
+	id, err := client1.SendWriteQuery(members, before)
+	if err != nil {
+		t.Fatal("Could not write :", err)
+	}
+
+	err = client1.SendJoinQuery(el.List[3])
+	if err == nil {
+		t.Fatal("A server should not join without the approval of the members")
+	}
+	//a client can not approve in the name of a member without the private key of its server.
+	err = client1.ApproveMembership(MemberJoin, el.List[3], servers[3].ServerIdentity.GetPrivate())
+	if err == nil {
+		t.Fatal("An approval signed with the key of another server should be rejected")
+	}
+	for i := 0; i < 3; i++ {
+		err = NewLattigoSMCClient(el.List[i], strconv.Itoa(i)).ApproveMembership(MemberJoin, el.List[3], servers[i].ServerIdentity.GetPrivate())
+		if err != nil {
+			t.Fatal("Could not approve the join :", err)
+		}
+	}
+	err = client1.SendJoinQuery(el.List[3])
+	if err != nil {
+		t.Fatal("Could not add the server :", err)
+	}
+	<-time.After(500 * time.Millisecond)
+	err = client1.SendJoinQuery(el.List[3])
+	if err == nil {
+		t.Fatal("A member should not join twice")
+	}
+
+	status, err := client1.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Agree", status.Agree, true)
+	assert.Equal(t, "Members", len(status.Nodes), 4)
+	assert.Equal(t, "Roster version", status.Nodes[3].RosterVersion, uint64(1))
+
+	//the joining server takes part in the decryption of the switched ciphertext.
+	client3 := NewLattigoSMCClient(el.List[3], "3")
+	data, err := client3.GetPlaintext(id)
+	if err != nil {
+		t.Fatal("Could not decrypt after the join :", err)
+	}
+	assert.Equal(t, "Joined", string(data[0:len(before)]), string(before))
+
+	err = client1.SendLeaveQuery(el.List[0])
+	if err == nil {
+		t.Fatal("The root should not leave the roster")
+	}
+	//the leaving server does not have to approve its removal.
+	for _, i := range []int{0, 1, 3} {
+		err = NewLattigoSMCClient(el.List[i], strconv.Itoa(i)).ApproveMembership(MemberLeave, el.List[2], servers[i].ServerIdentity.GetPrivate())
+		if err != nil {
+			t.Fatal("Could not approve the leave :", err)
+		}
+	}
+	err = client1.SendLeaveQuery(el.List[2])
+	if err != nil {
+		t.Fatal("Could not remove the server :", err)
+	}
+	<-time.After(500 * time.Millisecond)
+
+	status, err = client1.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Agree", status.Agree, true)
+	assert.Equal(t, "Members", len(status.Nodes), 3)
+	assert.Equal(t, "Roster version", status.Nodes[0].RosterVersion, uint64(2))
+	assert.Equal(t, "Epoch", status.Nodes[0].KeyEpoch, uint64(2))
+
+	data, err = client3.GetPlaintext(id)
+	if err != nil {
+		t.Fatal("Could not decrypt after the leave :", err)
+	}
+	assert.Equal(t, "Left", string(data[0:len(before)]), string(before))
+}
+
+func TestTransfer(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 6
+	local := onet.NewLocalTest(utils.SUITE)
+	servers, el, _ := local.GenTree(size, true)
+	//two collectives with their own setup and the same parameters.
+	rosterA := onet.NewRoster(el.List[:3])
+	rosterB := onet.NewRoster(el.List[3:])
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	clientA := NewLattigoSMCClient(el.List[0], "0")
+	err := clientA.SendSetupQuery(rosterA, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientB := NewLattigoSMCClient(el.List[3], "3")
+	err = clientB.SendSetupQuery(rosterB, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(2 * time.Second)
+	clientA1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = clientA1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	content := []byte("across collectives")
+	id, err := clientA1.SendWriteQuery(rosterA, content)
+	if err != nil {
+		t.Fatal("Could not write :", err)
+	}
+
+	_, err = clientA1.SendTransferQuery(*id, rosterA)
+	if err == nil {
+		t.Fatal("A ciphertext should not be transferred to its own collective")
+	}
+	_, err = clientA1.SendTransferQuery(*id, rosterB)
+	if err == nil {
+		t.Fatal("A ciphertext should not be transferred to a collective the members did not approve")
+	}
+	for i := 0; i < 3; i++ {
+		err = NewLattigoSMCClient(el.List[i], strconv.Itoa(i)).ApproveTransferTarget(rosterB.List[0], servers[i].ServerIdentity.GetPrivate())
+		if err != nil {
+			t.Fatal("Could not approve the other collective :", err)
+		}
+	}
+	transferred, err := clientA1.SendTransferQuery(*id, rosterB)
+	if err != nil {
+		t.Fatal("Could not transfer :", err)
+	}
+
+	//the other collective decrypts the ciphertext with its own key.
+	clientB1 := NewLattigoSMCClient(el.List[4], "4")
+	data, err := clientB1.GetPlaintext(&transferred)
+	if err != nil {
+		t.Fatal("Could not decrypt the transferred ciphertext :", err)
+	}
+	assert.Equal(t, "Transferred", string(data[0:len(content)]), string(content))
+}
+
+func TestAnalyst(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	servers, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(2 * time.Second)
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	content := []byte("for the analyst")
+	id, err := client1.SendWriteQuery(el, content)
+	if err != nil {
+		t.Fatal("Could not write :", err)
+	}
+
+	//the analyst generates its key pair with the parameters of the session.
+	params := bfv.DefaultParams[0]
+	keygen := bfv.NewKeyGenerator(params)
+	sk := keygen.GenSecretKey()
+	pk := keygen.GenPublicKey(sk)
+	signing, err := AnalystSigningKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client1.RegisterAnalyst("alice", pk, signing.Public)
+	if err != nil {
+		t.Fatal("Could not register the analyst :", err)
+	}
+	err = client1.RegisterAnalyst("alice", pk, signing.Public)
+	if err == nil {
+		t.Fatal("An analyst should not be registered twice")
+	}
+
+	//the analyst needs the approval of every member, signed with the key of its server.
+	err = client1.ApproveAnalyst("alice", pk, signing.Public, servers[0].ServerIdentity.GetPrivate())
+	if err == nil {
+		t.Fatal("An approval signed with the key of another server should be rejected")
+	}
+	for i, si := range el.List[:size-1] {
+		err = NewLattigoSMCClient(si, strconv.Itoa(i)).ApproveAnalyst("alice", pk, signing.Public, servers[i].ServerIdentity.GetPrivate())
+		if err != nil {
+			t.Fatal("Could not approve the analyst :", err)
+		}
+	}
+	_, err = client1.SendAnalystResultQuery("alice", *id)
+	if err == nil {
+		t.Fatal("The result should not be switched before all the members approved")
+	}
+	err = NewLattigoSMCClient(el.List[size-1], strconv.Itoa(size-1)).ApproveAnalyst("alice", pk, signing.Public, servers[size-1].ServerIdentity.GetPrivate())
+	if err != nil {
+		t.Fatal("Could not approve the analyst :", err)
+	}
+	result, err := client1.SendAnalystResultQuery("alice", *id)
+	if err != nil {
+		t.Fatal("Could not switch the result :", err)
+	}
+
+	//only the analyst can download its results.
+	_, _, err = client.DownloadAnalystResult("alice", result, servers[0].ServerIdentity.GetPrivate())
+	if err == nil {
+		t.Fatal("A download signed with another key should be rejected")
+	}
+	data, descriptor, err := client.DownloadAnalystResult("alice", result, signing.Private)
+	if err != nil {
+		t.Fatal("Could not download the result :", err)
+	}
+	values, err := DecryptAnalystResult(params, sk, data, descriptor)
+	if err != nil {
+		t.Fatal("Could not decrypt the result :", err)
+	}
+	assert.Equal(t, "Analyst", string(values.Bytes), string(content))
+	_, _, err = client.DownloadAnalystResult("alice", result, signing.Private)
+	if err == nil {
+		t.Fatal("A result should only be downloaded once")
+	}
+}
+
+func TestPrivacyBudget(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+	err := client.SendSetupRequest(&SetupRequest{Roster: *el, Seed: seed, GeneratePublicKey: true, PrivacyBudget: 1, Sensitivity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(2 * time.Second)
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	values := []int64{100, 200, 300}
+	id, err := client1.SendTypedWriteQuery(el, utils.NewInts(values))
+	if err != nil {
+		t.Fatal("Could not write :", err)
+	}
+	sum, err := client1.SendSumQuery(*id, *id)
+	if err != nil {
+		t.Fatal("Could not sum :", err)
+	}
+
+	_, err = client1.GetTypedPlaintext(&sum)
+	if err == nil {
+		t.Fatal("The data should not be decrypted without noise once a privacy budget is set")
+	}
+
+	//the noise of all the nodes is added to the sum, it spends the budget of the data it is computed from.
+	//the sensitivity and the slots of the noise are raised by the root to the ones of the setup.
+	noise := &utils.NoiseParameters{Mechanism: utils.NoiseLaplace, Epsilon: 0.6, Sensitivity: 0.001, Slots: 0}
+	noisy, err := client1.GetNoisyPlaintext(&sum, noise)
+	if err != nil {
+		t.Fatal("Could not decrypt with noise :", err)
+	}
+	for i, v := range values {
+		if d := noisy.Ints[i] - 2*v; d < -50 || d > 50 {
+			t.Fatal("Noise is too large : ", noisy.Ints[i], " for ", 2*v)
+		}
+	}
+	entries, _, err := client1.SendCatalogQuery(&CatalogQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if uuid.Equal(entry.UUID, *id) {
+			assert.Equal(t, "Epsilon spent", entry.EpsilonSpent, 0.6)
+		}
+	}
+
+	_, err = client1.GetNoisyPlaintext(&sum, noise)
+	if err == nil {
+		t.Fatal("The privacy budget should be enforced")
+	}
+	//the root rejects a noise that would wrap modulo T before the key switching starts.
+	_, err = client1.GetNoisyPlaintext(id, &utils.NoiseParameters{Mechanism: utils.NoiseLaplace, Epsilon: 1e-9, Sensitivity: 1})
+	if err == nil {
+		t.Fatal("Noise larger than the plaintext modulus should be rejected")
+	}
+	noise.Epsilon = 0.4
+	_, err = client1.GetNoisyPlaintext(id, noise)
+	if err != nil {
+		t.Fatal("Could not spend the rest of the budget :", err)
+	}
+
+	//an exported ciphertext imported again does not get a new budget.
+	data, descriptor, err := client1.GetCiphertext(*id)
+	if err != nil {
+		t.Fatal("Could not export :", err)
+	}
+	imported, err := client1.SendImportCiphertextQuery(data, descriptor)
+	if err != nil {
+		t.Fatal("Could not import :", err)
+	}
+	noise.Epsilon = 0.1
+	_, err = client1.GetNoisyPlaintext(&imported, noise)
+	if err == nil {
+		t.Fatal("Imported ciphertexts should not be decrypted once a privacy budget is set")
+	}
+}
+
+func TestCustomParameters(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	//parameters with a plaintext modulus that does not allow batching are rejected before any key generation.
+	invalid := bfv.DefaultParams[0].Copy()
+	invalid.T = 65536
+	err := client.SendSetupWithParameters(&SetupRequest{Roster: *el, Seed: seed, GeneratePublicKey: true}, invalid)
+	if err == nil {
+		t.Fatal("Invalid parameters should be rejected")
+	}
+
+	//the request can not lower the minimum security level.
+	insecure := bfv.DefaultParams[len(bfv.DefaultParams)-1].Copy()
+	insecure.LogN = 10
+	err = client.SendSetupWithParameters(&SetupRequest{Roster: *el, Seed: seed, GeneratePublicKey: true, MinSecurity: -1}, insecure)
+	if err == nil {
+		t.Fatal("Insecure parameters should be rejected")
+	}
+
+	params := bfv.DefaultParams[1].Copy()
+	err = client.SendSetupWithParameters(&SetupRequest{Roster: *el, Seed: seed, GeneratePublicKey: true}, params)
+	if err != nil {
+		t.Fatal("Could not setup with custom parameters :", err)
+	}
+	<-time.After(2 * time.Second)
+
+	status, err := client.GetStatus()
+	if err != nil {
+		t.Fatal("Could not get the status :", err)
+	}
+	assert.Equal(t, "Agree", status.Agree, true)
+	assert.Equal(t, "LogN", status.Nodes[2].LogN, params.LogN)
+
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, false, false, 0)
+	<-time.After(500 * time.Millisecond)
+
+	values := []uint64{7, 8, 9}
+	id, err := client1.SendTypedWriteQuery(el, utils.NewUints(values))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	got, err := client1.GetTypedPlaintext(id)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	assert.Equal(t, "Values", got.Uints, values)
+}
+
+func TestStatistics(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	_, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, true, true, 1, bfv.RotationLeft, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	//the columns are written by two parties.
+	client1 := NewLattigoSMCClient(el.List[1], "1")
+	_, _ = client1.SendKeyRequest(true, true, true, 0)
+	client2 := NewLattigoSMCClient(el.List[2], "2")
+	_, _ = client2.SendKeyRequest(true, true, true, 0)
+	<-time.After(500 * time.Millisecond)
+
+	id1, err := client1.SendTypedWriteQuery(el, utils.NewInts([]int64{1, 2, -3}))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	id2, err := client2.SendTypedWriteQuery(el, utils.NewInts([]int64{6, 4}))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+	columns := []uuid.UUID{*id1, *id2}
+
+	result, err := client1.SendStatisticsQuery(StatisticVariance, columns, 0)
+	if err != nil {
+		t.Fatal("Could not compute the variance :", err)
+	}
+	count, err := client2.GetTypedPlaintext(&result.Count)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	sum, err := client2.GetTypedPlaintext(&result.Sum)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	squares, err := client2.GetTypedPlaintext(&result.SumOfSquares)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	assert.Equal(t, "Count", count.Uints[0], uint64(5))
+	assert.Equal(t, "Sum", sum.Ints[0], int64(10))
+	assert.Equal(t, "Sum of squares", squares.Ints[0], int64(66))
+
+	//mean 2 and variance 66/5 - 4
+	mean, err := client1.GetMean(columns)
+	if err != nil {
+		t.Fatal("Could not compute the mean :", err)
+	}
+	assert.Equal(t, "Mean", mean, 2.0)
+	variance, err := client1.GetVariance(columns)
+	if err != nil {
+		t.Fatal("Could not compute the variance :", err)
+	}
+	assert.Equal(t, "Variance", variance, 66.0/5-4)
+
+	//histogram of 4 buckets over the bucketed columns of the two parties.
+	bucketed1, err := utils.EncodeBuckets([]uint64{0, 1, 1}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucketed2, err := utils.EncodeBuckets([]uint64{3, 1}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hist1, err := client1.SendTypedWriteQuery(el, bucketed1)
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	hist2, err := client2.SendTypedWriteQuery(el, bucketed2)
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	<-time.After(time.Second)
+	result, err = client1.SendStatisticsQuery(StatisticHistogram, []uuid.UUID{*hist1, *hist2}, 4)
+	if err != nil {
+		t.Fatal("Could not compute the histogram :", err)
+	}
+	histogram, err := client2.GetTypedPlaintext(&result.Histogram)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	for i, v := range []uint64{1, 3, 0, 1} {
+		assert.Equal(t, "Histogram", histogram.Uints[i], v)
+	}
+
+	_, err = client1.SendStatisticsQuery(StatisticHistogram, []uuid.UUID{*hist1}, 3)
+	if err == nil {
+		t.Fatal("Number of buckets that is not a power of two should be rejected")
+	}
+
+	//the sum of squares of values larger than sqrt(T/2) wraps around the plaintext modulus.
+	large, err := client1.SendTypedWriteQuery(el, utils.NewInts([]int64{300, -300}))
+	if err != nil {
+		t.Fatal("Could not write data :", err)
+	}
+	_, err = client1.SendStatisticsQuery(StatisticSumOfSquares, []uuid.UUID{*large}, 0)
+	if err == nil {
+		t.Fatal("Sum of squares that may overflow the plaintext modulus should be refused")
+	}
+	_, err = client1.SendStatisticsQuery(StatisticSum, []uuid.UUID{*large}, 0)
+	if err != nil {
+		t.Fatal("Could not compute the sum :", err)
+	}
+}
+
+func TestFederatedContributions(t *testing.T) {
+	log.SetDebugVisible(1)
+	size := 3
+	local := onet.NewLocalTest(utils.SUITE)
+	servers, el, _ := local.GenTree(size, true)
+
+	client := NewLattigoSMCClient(el.List[0], "0")
+	seed := []byte{'l', 'a', 't', 't', 'i', 'g', 'o'}
+
+	err := client.SendSetupQuery(el, true, false, false, 0, 0, 0, seed)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	<-time.After(2 * time.Second)
+
+	//every member contributes its local values through its own server, signed with the key of its server.
+	columns := [][]int64{{1, 2, 3}, {10, 20}, {-5, 100, 1000, 7}}
+	clients := make([]*API, size)
+	for i := range clients {
+		clients[i] = NewLattigoSMCClient(el.List[i], strconv.Itoa(i))
+		_, _ = clients[i].SendKeyRequest(true, false, false, 0)
+	}
+	<-time.After(500 * time.Millisecond)
+	_, err = clients[1].SendContributionQuery("age", utils.NewInts([]int64{99}), false, servers[0].ServerIdentity.GetPrivate())
+	if err == nil {
+		t.Fatal("Contribution signed with the key of another member should be rejected")
+	}
+	_, err = clients[1].SendContributionQuery("age", utils.NewInts([]int64{99}), true, servers[1].ServerIdentity.GetPrivate())
+	if err == nil {
+		t.Fatal("Replacement of a contribution that does not exist should be rejected")
+	}
+	_, err = clients[1].SendContributionQuery("age", utils.NewInts([]int64{99}), false, servers[1].ServerIdentity.GetPrivate())
+	if err != nil {
+		t.Fatal("Could not contribute :", err)
+	}
+	_, err = clients[1].SendContributionQuery("age", utils.NewInts(columns[1]), false, servers[1].ServerIdentity.GetPrivate())
+	if err == nil {
+		t.Fatal("Implicit replacement of a contribution should be rejected")
+	}
+	for i, column := range columns {
+		_, err = clients[i].SendContributionQuery("age", utils.NewInts(column), i == 1, servers[i].ServerIdentity.GetPrivate())
+		if err != nil {
+			t.Fatal("Could not contribute :", err)
+		}
+	}
+	_, err = clients[2].SendContributionQuery("age", utils.NewBools([]bool{true}), true, servers[2].ServerIdentity.GetPrivate())
+	if err == nil {
+		t.Fatal("Contribution of another type should be rejected")
+	}
+
+	//the second contribution of member 1 replaced the first one.
+	entries, total, err := clients[0].SendCatalogQuery(&CatalogQuery{Dataset: "age"})
+	if err != nil {
+		t.Fatal("Could not get the catalog :", err)
+	}
+	assert.Equal(t, "Contributions", total, uint64(size))
+	owners := make(map[string]bool)
+	for _, entry := range entries {
+		assert.Equal(t, "Operation", entry.Operation, ContributionOperation)
+		owners[entry.Owner] = true
+	}
+	for _, si := range el.List {
+		assert.Equal(t, "Contributor", owners[si.String()], true)
+	}
+
+	aggregate, err := clients[1].SendAggregationQuery("age")
+	if err != nil {
+		t.Fatal("Could not aggregate :", err)
+	}
+	got, err := clients[2].GetTypedPlaintext(&aggregate)
+	if err != nil {
+		t.Fatal("Could not retrieve plaintext :", err)
+	}
+	assert.Equal(t, "Length", len(got.Ints), 4)
+	for i, v := range []int64{6, 122, 1003, 7} {
+		assert.Equal(t, "Aggregate", got.Ints[i], v)
+	}
+
+	_, err = clients[1].SendAggregationQuery("weight")
+	if err == nil {
+		t.Fatal("Aggregation of an unknown dataset should be rejected")
+	}
+
+	//simultaneous first contributions of the same member : only one is stored.
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := clients[2].SendContributionQuery("height", utils.NewInts([]int64{180}), false, servers[2].ServerIdentity.GetPrivate())
+			errs <- err
+		}()
+	}
+	failed := 0
+	for i := 0; i < 2; i++ {
+		if <-errs != nil {
+			failed++
+		}
+	}
+	assert.Equal(t, "Rejected contributions", failed, 1)
+	_, total, err = clients[0].SendCatalogQuery(&CatalogQuery{Dataset: "height"})
+	if err != nil {
+		t.Fatal("Could not get the catalog :", err)
+	}
+	assert.Equal(t, "Contributions", total, uint64(1))
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"github.com/ldsec/lattigo/bfv"
 	"github.com/ldsec/lattigo/dbfv"
 	"go.dedis.ch/onet/v3"
@@ -8,16 +9,41 @@ import (
 	"go.dedis.ch/onet/v3/network"
 	"lattigo-smc/protocols"
 	"lattigo-smc/utils"
+	"sync"
 	"time"
 )
 
+//DefaultMinSecurity minimum security level in bits of the custom parameters. A setup request can only ask for a higher level.
+const DefaultMinSecurity = 128
+
+//paramsTimeout time to wait for the nodes to confirm the parameters.
+const paramsTimeout = 10 * time.Second
+
 //------------HANDLES-QUERIES ---------------
 func (s *Service) HandleSetupQuery(request *SetupRequest) (network.Message, error) {
 	tree := request.Roster.GenerateBinaryTree()
 
 	log.Lvl1("Begin new setup with ", tree.Size(), " parties")
+	if request.PrivacyBudget > 0 && !(request.Sensitivity > 0) {
+		return &SetupReply{-1}, errors.New("the sensitivity of the values should be set with the privacy budget")
+	}
 	s.Roster = request.Roster
-	s.Params = bfv.DefaultParams[request.ParamsIdx]
+	params, err := setupParameters(request)
+	if err != nil {
+		log.Error("Invalid parameters : ", err)
+		return &SetupReply{-1}, err
+	}
+	s.Params = params
+	s.ParamsIdx = request.ParamsIdx
+	s.ParamsHash, err = paramsHash(params)
+	if err != nil {
+		return &SetupReply{-1}, err
+	}
+	s.Encoder = bfv.NewEncoder(s.Params)
+	s.StoreCapacity = request.StoreCapacity
+	s.PrivacyBudget = request.PrivacyBudget
+	s.Sensitivity = request.Sensitivity
+	s.verifiablePublicKey = request.VerifiablePublicKey
 	keygen := bfv.NewKeyGenerator(s.Params)
 	s.SecretKey = keygen.GenSecretKey()
 	s.PublicKey = keygen.GenPublicKey(s.SecretKey)
@@ -29,7 +55,7 @@ func (s *Service) HandleSetupQuery(request *SetupRequest) (network.Message, erro
 	if !s.pubKeyGenerated && request.GeneratePublicKey {
 		//send the information to the childrens.
 		if tree.Root.ServerIdentity.Equal(s.ServerIdentity()) {
-			err := utils.SendISMOthers(s.ServiceProcessor, &s.Roster, request)
+			err := s.sendSetupRequest(request)
 			if err != nil {
 				return &SetupReply{-1}, err
 			}
@@ -50,7 +76,7 @@ func (s *Service) HandleSetupQuery(request *SetupRequest) (network.Message, erro
 		log.Lvl1("Generate evalutation key ! ")
 		if tree.Root.ServerIdentity.Equal(s.ServerIdentity()) {
 			if !requestSent {
-				err := utils.SendISMOthers(s.ServiceProcessor, &s.Roster, request)
+				err := s.sendSetupRequest(request)
 				if err != nil {
 					return &SetupReply{-1}, err
 				}
@@ -67,23 +93,25 @@ func (s *Service) HandleSetupQuery(request *SetupRequest) (network.Message, erro
 	}
 
 	if request.GenerateRotationKey && !s.rotKeyGenerated {
-		s.RotIdx = request.RotIdx
-		s.K = request.K
-		log.Lvl1("Generate evalutation key ! ")
+		//the requested rotation and the ones needed for the operations over the slots. Every node queues them in the same order.
+		rotations := appendRotations([]RotationParameters{{RotIdx: request.RotIdx, K: request.K}}, innerSumRotations(s.Params)...)
+		s.queueRotations(rotations)
+		log.Lvl1("Generate rotation keys : ", len(rotations))
 		if tree.Root.ServerIdentity.Equal(s.ServerIdentity()) {
 			if !requestSent {
 
-				err := utils.SendISMOthers(s.ServiceProcessor, &s.Roster, request)
+				err := s.sendSetupRequest(request)
 				if err != nil {
 					return &SetupReply{-1}, err
 				}
 				requestSent = true
 			}
 
-			err := s.genRotKey(tree, request.K, request.RotIdx)
-
-			if err != nil {
-				return &SetupReply{-1}, err
+			for _, rot := range rotations {
+				err := s.genRotKey(tree, rot.K, rot.RotIdx)
+				if err != nil {
+					return &SetupReply{-1}, err
+				}
 			}
 
 		}
@@ -94,6 +122,102 @@ func (s *Service) HandleSetupQuery(request *SetupRequest) (network.Message, erro
 
 }
 
+//setupParameters returns the parameters of the setup request. Custom parameters are validated against the minimum security level of the request.
+func setupParameters(request *SetupRequest) (*bfv.Parameters, error) {
+	if len(request.Parameters) == 0 {
+		if request.ParamsIdx >= uint64(len(bfv.DefaultParams)) {
+			return nil, errors.New("unknown parameters index")
+		}
+		return bfv.DefaultParams[request.ParamsIdx], nil
+	}
+	params := new(bfv.Parameters)
+	err := unmarshalUntrusted(params, request.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	minSecurity := request.MinSecurity
+	if minSecurity < DefaultMinSecurity {
+		minSecurity = DefaultMinSecurity
+	}
+	return params, utils.ValidateParameters(params, minSecurity)
+}
+
+//paramsHash returns the fingerprint of the serialized parameters.
+func paramsHash(params *bfv.Parameters) (string, error) {
+	data, err := params.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return fingerprint(data), nil
+}
+
+//sendSetupRequest sends the setup request to the other nodes, waits for them to confirm the hash of the parameters
+//and agrees with them on the seed of the CRP used by the key generations and the refresh. Should be called by the root.
+func (s *Service) sendSetupRequest(request *SetupRequest) error {
+	err := utils.SendISMOthers(s.ServiceProcessor, &s.Roster, request)
+	if err != nil {
+		return err
+	}
+	err = s.confirmParameters()
+	if err != nil {
+		return err
+	}
+	return s.agreeOnSeed(s.Roster.GenerateBinaryTree())
+}
+
+//confirmParameters waits until all the nodes report the hash of the parameters of the root, or fails if a node has other parameters.
+func (s *Service) confirmParameters() error {
+	timeout := time.After(paramsTimeout)
+	for {
+		confirmed := true
+		for _, node := range s.collectStatus() {
+			if node.ParamsHash == "" {
+				confirmed = false
+			} else if node.ParamsHash != s.ParamsHash {
+				return errors.New(node.Server + " has other parameters")
+			}
+		}
+		if confirmed {
+			log.Lvl1("All the nodes confirmed the parameters ", s.ParamsHash)
+			return nil
+		}
+		select {
+		case <-timeout:
+			return errors.New("timeout while waiting for the nodes to confirm the parameters")
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+//agreeOnSeed runs the seed agreement with all the nodes, so the CRP do not depend on the seed of the client. Should be called by the root.
+func (s *Service) agreeOnSeed(tree *onet.Tree) error {
+	log.Lvl1(s.ServerIdentity(), "Starting seed agreement")
+	tni := s.NewTreeNodeInstance(tree, tree.Root, protocols.SeedAgreementProtocolName)
+	protocol, err := s.NewProtocol(tni, nil)
+	if err != nil {
+		return err
+	}
+	sap := protocol.(*protocols.SeedAgreementProtocol)
+	err = s.RegisterProtocolInstance(protocol)
+	if err != nil {
+		return err
+	}
+	err = sap.Start()
+	if err != nil {
+		return err
+	}
+	go sap.Dispatch()
+	sap.Wait()
+	//all the nodes acknowledged the seed, their CRP generators are reset.
+	return sap.Err
+}
+
+//setSeed records the agreed seed and resets the CRP generator with it.
+func (s *Service) setSeed(seed []byte) {
+	s.Seed = seed
+	s.crpGen = *dbfv.NewCRPGenerator(s.Params, seed)
+}
+
 func (s *Service) genEvalKey(tree *onet.Tree) error {
 	log.Lvl1("Starting relinearization key protocol")
 	tni := s.NewTreeNodeInstance(tree, tree.Root, protocols.RelinearizationKeyProtocolName)
@@ -116,6 +240,9 @@ func (s *Service) genEvalKey(tree *onet.Tree) error {
 
 	rkg.Wait()
 	log.Lvl1("Finished relin protocol")
+	if rkg.Err != nil {
+		return rkg.Err
+	}
 
 	s.EvaluationKey = rkg.EvaluationKey
 	s.evalKeyGenerated = true
@@ -123,6 +250,22 @@ func (s *Service) genEvalKey(tree *onet.Tree) error {
 }
 
 func (s *Service) genPublicKey(tree *onet.Tree) error {
+	ckgp, err := s.runCKG(tree)
+	if err != nil {
+		return err
+	}
+	s.PublicKeyShares = ckgp.Shares
+	s.SecretKey = ckgp.Sk
+	s.Encoder = bfv.NewEncoder(s.Params)
+	s.DecryptorSk = bfv.NewDecryptor(s.Params, s.SecretKey)
+	s.MasterPublicKey = ckgp.Pk
+	s.pubKeyGenerated = true
+	log.Lvl1(s.ServerIdentity(), " got public key!")
+	return nil
+}
+
+//runCKG runs the collective key generation with the secret key shares of the nodes and returns the protocol of the root once it is done.
+func (s *Service) runCKG(tree *onet.Tree) (*protocols.CollectiveKeyGenerationProtocol, error) {
 	log.Lvl1(s.ServerIdentity(), "Starting collective key generation!")
 
 	tni := s.NewTreeNodeInstance(tree, tree.Root, protocols.CollectiveKeyGenerationProtocolName)
@@ -150,13 +293,10 @@ func (s *Service) genPublicKey(tree *onet.Tree) error {
 	//we should wait until the above is done.
 	log.Lvl1(ckgp.ServerIdentity(), "Waiting for the protocol to be finished :x")
 	ckgp.Wait()
-	s.SecretKey = ckgp.Sk
-	s.Encoder = bfv.NewEncoder(s.Params)
-	s.DecryptorSk = bfv.NewDecryptor(s.Params, s.SecretKey)
-	s.MasterPublicKey = ckgp.Pk
-	s.pubKeyGenerated = true
-	log.Lvl1(s.ServerIdentity(), " got public key!")
-	return nil
+	if ckgp.Err != nil {
+		return nil, ckgp.Err
+	}
+	return ckgp, nil
 }
 
 func (s *Service) genRotKey(tree *onet.Tree, k uint64, rotIdx int) error {
@@ -181,8 +321,78 @@ func (s *Service) genRotKey(tree *onet.Tree, k uint64, rotIdx int) error {
 
 	rotkeygen.Wait()
 	log.Lvl1("Finished relin protocol")
+	if rotkeygen.Err != nil {
+		return rotkeygen.Err
+	}
 
 	s.RotationKey = &rotkeygen.RotKey
 	s.rotKeyGenerated = true
 	return nil
 }
+
+//rotationQueue is an unbounded queue of the rotation keys to be generated. Queueing never blocks so that a request can contain any number of rotations.
+type rotationQueue struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	pending []RotationParameters
+}
+
+func newRotationQueue() *rotationQueue {
+	queue := &rotationQueue{pending: make([]RotationParameters, 0)}
+	queue.cond = sync.NewCond(&queue.lock)
+	return queue
+}
+
+//push appends the rotations at the end of the queue.
+func (q *rotationQueue) push(rotations ...RotationParameters) {
+	q.lock.Lock()
+	q.pending = append(q.pending, rotations...)
+	q.lock.Unlock()
+	q.cond.Broadcast()
+}
+
+//pop waits for a rotation to be queued and removes it from the queue.
+func (q *rotationQueue) pop() RotationParameters {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for len(q.pending) == 0 {
+		q.cond.Wait()
+	}
+	rot := q.pending[0]
+	q.pending = q.pending[1:]
+	return rot
+}
+
+//queueRotations queues the rotation keys to be generated by the next rotation key protocols.
+func (s *Service) queueRotations(rotations []RotationParameters) {
+	s.Rotations = append(s.Rotations, rotations...)
+	s.RotationParams.push(rotations...)
+}
+
+//generateRotationKeys generates the rotation keys that were not generated yet. Should be called by the root.
+func (s *Service) generateRotationKeys(rotations []RotationParameters) error {
+	missing := make([]RotationParameters, 0)
+	for _, rot := range rotations {
+		if !containsRotation(s.Rotations, rot) {
+			missing = append(missing, rot)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	log.Lvl1("Generating ", len(missing), " missing rotation keys")
+	tree := s.Roster.GenerateBinaryTree()
+	err := utils.SendISMOthers(s.ServiceProcessor, &s.Roster, &RotationKeyRequest{Rotations: missing})
+	if err != nil {
+		return err
+	}
+	s.queueRotations(missing)
+	for _, rot := range missing {
+		err = s.genRotKey(tree, rot.K, rot.RotIdx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+//statistics contains the descriptive statistics over encrypted columns written by several parties. The server that gets the query asks the root
+//for each encrypted result of the statistic : the count, the sum, the sum of squares or the histogram. The root adds all the chunks of the columns,
+//squares them for the sum of squares, and sums the slots with the rotations. The mean and the variance are decrypted as the sums and the count.
+package services
+
+import (
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/utils"
+	"strconv"
+)
+
+//statisticResults returns the encrypted results computed by the root for the statistic.
+func statisticResults(statistic Statistic) ([]Statistic, error) {
+	switch statistic {
+	case StatisticCount, StatisticSum, StatisticSumOfSquares, StatisticHistogram:
+		return []Statistic{statistic}, nil
+	case StatisticMean:
+		return []Statistic{StatisticSum, StatisticCount}, nil
+	case StatisticVariance:
+		return []Statistic{StatisticSumOfSquares, StatisticSum, StatisticCount}, nil
+	}
+	return nil, errors.New("unknown statistic " + strconv.Itoa(int(statistic)))
+}
+
+//statisticOperation name of the operation in the provenance of a result.
+func statisticOperation(statistic Statistic) string {
+	switch statistic {
+	case StatisticCount:
+		return "count"
+	case StatisticSum:
+		return "sum"
+	case StatisticSumOfSquares:
+		return "sumofsquares"
+	case StatisticHistogram:
+		return "histogram"
+	}
+	return ""
+}
+
+//HandleStatisticsQuery handler for queries of a statistic over encrypted columns.
+//Return the ids of the encrypted results of the statistic
+func (s *Service) HandleStatisticsQuery(query *StatisticsQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got request for statistic ", query.Statistic, " of : ", query.UUIDs)
+	if len(query.UUIDs)+len(query.Names) == 0 {
+		return nil, errors.New("statistic has no column")
+	}
+	results, err := statisticResults(query.Statistic)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &StatisticsReply{}
+	for _, statistic := range results {
+		result := *query
+		result.QueryID = uuid.NewV1()
+		result.Statistic = statistic
+		state, err := s.sendEvaluationQuery(result.QueryID, &result)
+		if err != nil {
+			return nil, err
+		}
+		id := state.(*ServiceState).Id
+		switch statistic {
+		case StatisticCount:
+			reply.Count = id
+		case StatisticSum:
+			reply.Sum = id
+		case StatisticSumOfSquares:
+			reply.SumOfSquares = id
+		case StatisticHistogram:
+			reply.Histogram = id
+		}
+	}
+	return reply, nil
+}
+
+//statisticDescriptor returns the descriptor of the result of the statistic. The columns should have the same numeric type.
+func (s *Service) statisticDescriptor(query *StatisticsQuery) (utils.DataDescriptor, error) {
+	descriptor := s.datasetDescriptor(query.UUIDs[0])
+	for _, id := range query.UUIDs {
+		d := s.datasetDescriptor(id)
+		if d.Type != descriptor.Type || d.Scale != descriptor.Scale {
+			return utils.DataDescriptor{}, errors.New("columns do not have the same type")
+		}
+	}
+	switch descriptor.Type {
+	case utils.TypeUint, utils.TypeInt, utils.TypeFixed:
+	case utils.TypeBool:
+		descriptor.Type = utils.TypeUint
+	default:
+		return utils.DataDescriptor{}, errors.New("statistics need numeric columns")
+	}
+
+	if query.Statistic != StatisticCount {
+		err := s.checkSumOverflow(query, descriptor.Type)
+		if err != nil {
+			return utils.DataDescriptor{}, err
+		}
+	}
+
+	switch query.Statistic {
+	case StatisticCount:
+		return utils.DataDescriptor{Type: utils.TypeUint, Length: 1}, nil
+	case StatisticSumOfSquares:
+		descriptor = utils.MultiplyDescriptors(descriptor, descriptor)
+	case StatisticHistogram:
+		if descriptor.Type != utils.TypeUint {
+			return utils.DataDescriptor{}, errors.New("histogram needs bucketed columns")
+		}
+		n := uint64(1<<s.Params.LogN) >> 1
+		if query.Buckets == 0 || query.Buckets&(query.Buckets-1) != 0 || query.Buckets > n {
+			return utils.DataDescriptor{}, errors.New("number of buckets should be a power of two smaller than the number of columns of the slots")
+		}
+		for _, id := range query.UUIDs {
+			if s.datasetDescriptor(id).Length%query.Buckets != 0 {
+				return utils.DataDescriptor{}, errors.New("column " + id.String() + " is not bucketed in " + strconv.FormatUint(query.Buckets, 10) + " buckets")
+			}
+		}
+		return utils.DataDescriptor{Type: utils.TypeUint, Length: query.Buckets}, nil
+	}
+	descriptor.Length = 1
+	return descriptor, nil
+}
+
+//checkSumOverflow returns an error if the sum of the statistic over the columns may wrap around the plaintext modulus. The sum is bounded by
+//the number of values times the bound of the values, squared for the sum of squares. The bound is only known for the values encoded by a member.
+func (s *Service) checkSumOverflow(query *StatisticsQuery, valueType utils.DataType) error {
+	count := uint64(0)
+	bound := uint64(0)
+	s.storeLock.Lock()
+	defer s.storeLock.Unlock()
+	for _, id := range query.UUIDs {
+		metadata, ok := s.Metadata[id]
+		if !ok || (metadata.Operation != "write" && metadata.Operation != ContributionOperation) || metadata.Descriptor.Bound == 0 {
+			return errors.New("the bound of the values of " + id.String() + " is not known")
+		}
+		count += metadata.Descriptor.Length
+		if metadata.Descriptor.Bound > bound {
+			bound = metadata.Descriptor.Bound
+		}
+	}
+	if query.Statistic == StatisticSumOfSquares {
+		bound = utils.MultiplyBound(bound, bound)
+	}
+	sum := utils.MultiplyBound(count, bound)
+	limit := s.Params.T - 1
+	if valueType != utils.TypeUint {
+		limit = (s.Params.T - 1) / 2
+	}
+	if bound == 0 || (sum == 0 && count != 0) || sum > limit {
+		return errors.New("the sum of the values may overflow the plaintext modulus")
+	}
+	return nil
+}
+
+//statistic returns the encrypted result of the statistic over all the chunks of the columns. Sums have their result in every slot.
+func (s *Service) statistic(query *StatisticsQuery) (*bfv.Ciphertext, error) {
+	if query.Statistic == StatisticCount {
+		return s.count(query.UUIDs)
+	}
+	eval := bfv.NewEvaluator(s.Params)
+	var total *bfv.Ciphertext
+	for _, id := range query.UUIDs {
+		for _, chunk := range s.chunks(id) {
+			ct, err := s.getCiphertext(chunk)
+			if err != nil {
+				return nil, err
+			}
+			if query.Statistic == StatisticSumOfSquares || ct.Degree() > 1 {
+				if !s.evalKeyGenerated {
+					return nil, errors.New("evaluation key has not been generated")
+				}
+				if query.Statistic == StatisticSumOfSquares {
+					ct = eval.MulNew(ct, ct)
+				}
+				ct = eval.RelinearizeNew(ct, s.EvaluationKey)
+			}
+			if total == nil {
+				total = ct
+			} else {
+				total = eval.AddNew(total, ct)
+			}
+		}
+	}
+
+	if query.Statistic == StatisticHistogram {
+		return s.histogram(total, query.Buckets)
+	}
+	return s.innerSum(total)
+}
+
+//histogram returns a new ciphertext where the slots of each block of buckets contain the sum of the blocks of ct.
+func (s *Service) histogram(ct *bfv.Ciphertext, buckets uint64) (*bfv.Ciphertext, error) {
+	if !s.rotKeyGenerated {
+		return nil, errors.New("rotation keys have not been generated")
+	}
+	eval := bfv.NewEvaluator(s.Params)
+	res := ct
+	//sum the blocks - the rotations are powers of two, they are part of the rotation keys of the inner sum.
+	for k := buckets; k < (1<<s.Params.LogN)>>1; k <<= 1 {
+		rotated := eval.RotateColumnsNew(res, k, s.RotationKey)
+		res = eval.AddNew(res, rotated)
+	}
+	rotated := eval.RotateRowsNew(res, s.RotationKey)
+	return eval.AddNew(res, rotated), nil
+}
+
+//count returns the number of values of the columns, encrypted under the collective public key in every slot. The count is known from the descriptors.
+func (s *Service) count(ids []uuid.UUID) (*bfv.Ciphertext, error) {
+	if s.MasterPublicKey == nil {
+		return nil, errors.New("collective public key has not been generated")
+	}
+	count := uint64(0)
+	for _, id := range ids {
+		count += s.datasetDescriptor(id).Length
+	}
+	if count >= s.Params.T {
+		return nil, errors.New("count is larger than the plaintext modulus")
+	}
+	slots := make([]uint64, 1<<s.Params.LogN)
+	for i := range slots {
+		slots[i] = count
+	}
+	pt, err := s.encodePlaintext(slots)
+	if err != nil {
+		return nil, err
+	}
+	return bfv.NewEncryptorFromPk(s.Params, s.MasterPublicKey).EncryptNew(pt), nil
+}
@@ -0,0 +1,150 @@
+//status contains the query for the state of the setup of every node of the roster : the collective keys, the parameters and the rotation keys.
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"time"
+)
+
+//statusTimeout time to wait for the status of the nodes of the roster.
+const statusTimeout = 5 * time.Second
+
+//HandleStatusQuery handler for a client to get the status of the setup of all the nodes of the roster.
+func (s *Service) HandleStatusQuery(query *StatusQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got status query")
+	reply := &StatusReply{Nodes: s.collectStatus()}
+	reply.Agree, reply.Disagreement = agreement(reply.Nodes)
+	return reply, nil
+}
+
+//collectStatus returns the status of all the nodes of the roster, in the order of the roster.
+func (s *Service) collectStatus() []NodeStatus {
+	if len(s.Roster.List) == 0 {
+		//the node has not been setup, it does not know the roster.
+		return []NodeStatus{s.nodeStatus()}
+	}
+
+	query := &StatusQuery{QueryID: uuid.NewV1()}
+	replies := make(chan NodeStatusReply, len(s.Roster.List))
+	s.repliesLock.Lock()
+	s.StatusReplies[query.QueryID] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.StatusReplies, query.QueryID)
+		s.repliesLock.Unlock()
+	}()
+	statuses := make(map[string]NodeStatus)
+	for _, si := range s.Roster.List {
+		if si.Equal(s.ServerIdentity()) {
+			statuses[si.String()] = s.nodeStatus()
+			continue
+		}
+		err := s.SendRaw(si, query)
+		if err != nil {
+			statuses[si.String()] = NodeStatus{Server: si.String(), Error: err.Error()}
+		}
+	}
+
+	timeout := time.After(statusTimeout)
+	for len(statuses) < len(s.Roster.List) {
+		select {
+		case status := <-replies:
+			statuses[status.Server] = status.NodeStatus
+		case <-timeout:
+			for _, si := range s.Roster.List {
+				if _, ok := statuses[si.String()]; !ok {
+					statuses[si.String()] = NodeStatus{Server: si.String(), Error: "no reply"}
+				}
+			}
+		}
+	}
+
+	nodes := make([]NodeStatus, len(s.Roster.List))
+	for i, si := range s.Roster.List {
+		nodes[i] = statuses[si.String()]
+	}
+	return nodes
+}
+
+//nodeStatus returns the status of the setup of this node.
+func (s *Service) nodeStatus() NodeStatus {
+	status := NodeStatus{
+		Server:        s.ServerIdentity().String(),
+		PublicKey:     s.pubKeyGenerated,
+		EvaluationKey: s.evalKeyGenerated,
+		RotationKeys:  s.rotKeyGenerated,
+		Rotations:     s.Rotations,
+		KeyEpoch:      s.KeyEpoch,
+		RosterVersion: s.RosterVersion,
+		Members:       len(s.Roster.List),
+	}
+	if s.Params != nil {
+		status.Setup = true
+		status.ParamsIdx = s.ParamsIdx
+		status.ParamsHash = s.ParamsHash
+		status.Seed = hex.EncodeToString(s.Seed)
+		status.LogN = s.Params.LogN
+		status.T = s.Params.T
+	}
+	if s.MasterPublicKey != nil {
+		fingerprint, err := keyFingerprint(s.MasterPublicKey)
+		if err != nil {
+			status.Error = err.Error()
+		}
+		status.Fingerprint = fingerprint
+	}
+	return status
+}
+
+//keyFingerprint returns the fingerprint of the public key.
+func keyFingerprint(pk *bfv.PublicKey) (string, error) {
+	data, err := pk.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return fingerprint(data), nil
+}
+
+//agreement returns true if all the nodes have the same keys, parameters and rotations, or a description of the first difference.
+//The fingerprint is only compared between the nodes that hold the collective public key.
+func agreement(nodes []NodeStatus) (bool, string) {
+	var reference *NodeStatus
+	pkFingerprint := ""
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Error != "" {
+			return false, node.Server + " : " + node.Error
+		}
+		if node.Fingerprint != "" {
+			if pkFingerprint != "" && node.Fingerprint != pkFingerprint {
+				return false, node.Server + " has a different collective public key"
+			}
+			pkFingerprint = node.Fingerprint
+		}
+		if reference == nil {
+			reference = node
+			continue
+		}
+		switch {
+		case node.Setup != reference.Setup || node.ParamsHash != reference.ParamsHash || node.LogN != reference.LogN || node.T != reference.T:
+			return false, node.Server + " has different parameters"
+		case node.Seed != reference.Seed:
+			return false, node.Server + " has a different CRP seed"
+		case node.PublicKey != reference.PublicKey || node.EvaluationKey != reference.EvaluationKey || node.RotationKeys != reference.RotationKeys:
+			return false, node.Server + " has different collective keys"
+		case node.RosterVersion != reference.RosterVersion || node.Members != reference.Members:
+			return false, node.Server + " has another version of the roster"
+		case node.KeyEpoch != reference.KeyEpoch:
+			return false, node.Server + " has another epoch of the collective key"
+		case fmt.Sprint(node.Rotations) != fmt.Sprint(reference.Rotations):
+			return false, node.Server + " has different rotation keys"
+		}
+	}
+	return true, ""
+}
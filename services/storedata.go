@@ -1,7 +1,9 @@
 package services
 
 import (
+	"encoding"
 	"errors"
+	"fmt"
 	"github.com/ldsec/lattigo/bfv"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
@@ -10,8 +12,16 @@ import (
 	"time"
 )
 
+//storeTimeout time to wait for the root to store a ciphertext.
+const storeTimeout = 30 * time.Second
+
 //HandleSendData is called by the service when the client makes a request to write some data.
 func (s *Service) HandleSendData(query *QueryData) (network.Message, error) {
+	return s.sendData(query, nil)
+}
+
+//sendData encrypts and sends the data of the query to the root. The wait for the root is abandoned when cancel is closed.
+func (s *Service) sendData(query *QueryData, cancel <-chan struct{}) (network.Message, error) {
 	log.Lvl1(s.ServerIdentity(), " received query data ")
 
 	data := query.Data
@@ -31,37 +41,81 @@ func (s *Service) HandleSendData(query *QueryData) (network.Message, error) {
 
 	}
 
-	encoder := bfv.NewEncoder(s.Params)
-	coeffs, err := utils.BytesToUint64(data, true)
+	//the raw data is written one byte per slot.
+	values := query.Values
+	if values == nil {
+		values = utils.NewBytes(data)
+	}
+	cts, err := s.encryptValues(values)
 	if err != nil {
 		return nil, err
 	}
-	pt := bfv.NewPlaintext(s.Params)
-	encoder.EncodeUint(coeffs, pt)
+	if len(cts) > 1 {
+		//the data is split in chunks of N slots stored as a dataset.
+		log.Lvl1("Data does not fit in one ciphertext, splitting it in chunks")
+		datasetQuery := &StoreDatasetQuery{QueryID: uuid.NewV1(), Ciphertexts: cts, Descriptor: values.Descriptor}
+		return s.sendEvaluationQuery(datasetQuery.QueryID, datasetQuery)
+	}
 
 	id := uuid.NewV1()
+	replies := make(chan uuid.UUID, 1)
+	s.repliesLock.Lock()
+	s.LocalUUID[id] = replies
+	s.repliesLock.Unlock()
+	defer func() {
+		s.repliesLock.Lock()
+		delete(s.LocalUUID, id)
+		s.repliesLock.Unlock()
+	}()
 	//Send it to the server
-	encryptorPk := bfv.NewEncryptorFromPk(s.Params, s.MasterPublicKey)
-	cipher := encryptorPk.EncryptNew(pt)
-	err = s.SendRaw(tree.Root.ServerIdentity, &StoreQuery{cipher, id})
+	err = s.SendRaw(tree.Root.ServerIdentity, &StoreQuery{cts[0], id, values.Descriptor})
 	if err != nil {
 		log.Error("could not send cipher to the root. ")
+		return nil, err
 	}
 
 	log.Lvl1("Waiting for id to be updated!")
-	for {
-		select {
-		case remoteID := <-s.LocalUUID[id]:
-			log.Lvl1("Value was updated")
-			return &ServiceState{remoteID, true}, nil
-
-		case <-time.After(1 * time.Second):
-			break
+	select {
+	case remoteID := <-replies:
+		if uuid.Equal(remoteID, uuid.Nil) {
+			return nil, errors.New("the root could not store the ciphertext")
 		}
+		log.Lvl1("Value was updated")
+		return &ServiceState{remoteID, true}, nil
+	case <-cancel:
+		return nil, errJobCancelled
+	case <-time.After(storeTimeout):
+		return nil, errors.New("timeout while waiting for the root to store the ciphertext")
 	}
 
 }
 
+//encryptValues encrypts the values under the collective public key, in chunks of N slots if they do not fit in one ciphertext.
+func (s *Service) encryptValues(values *utils.TypedValues) ([]*bfv.Ciphertext, error) {
+	if s.MasterPublicKey == nil {
+		return nil, errors.New("collective public key has not been generated")
+	}
+	coeffs, err := values.Encode(s.Params.T)
+	if err != nil {
+		return nil, err
+	}
+	encoder := bfv.NewEncoder(s.Params)
+	encryptorPk := bfv.NewEncryptorFromPk(s.Params, s.MasterPublicKey)
+	n := 1 << s.Params.LogN
+	cts := make([]*bfv.Ciphertext, 0)
+	//empty values still give one ciphertext.
+	for start := 0; start < len(coeffs) || len(cts) == 0; start += n {
+		end := start + n
+		if end > len(coeffs) {
+			end = len(coeffs)
+		}
+		pt := bfv.NewPlaintext(s.Params)
+		encoder.EncodeUint(coeffs[start:end], pt)
+		cts = append(cts, encryptorPk.EncryptNew(pt))
+	}
+	return cts, nil
+}
+
 //HandleKeyRequest handler for a client for the requests for the keys.
 func (s *Service) HandleKeyRequest(request *KeyRequest) (network.Message, error) {
 	tree := s.Roster.GenerateBinaryTree()
@@ -72,3 +126,83 @@ func (s *Service) HandleKeyRequest(request *KeyRequest) (network.Message, error)
 	}
 	return &SetupReply{Done: 1}, nil
 }
+
+//HandleImportCiphertextQuery handler for a client to store a ciphertext it encrypted under the collective public key.
+//The ciphertext is validated by the root against the parameters of the session. Returns the id of the stored ciphertext.
+func (s *Service) HandleImportCiphertextQuery(query *ImportCiphertextQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got request to import a ciphertext of ", len(query.Ciphertext), " bytes")
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
+
+//maxCiphertextDegree is the largest degree of an imported ciphertext : the product of two ciphertexts that is not relinearized.
+const maxCiphertextDegree = 2
+
+//validateCiphertext checks that the ciphertext has the ring degree, the moduli and a degree supported by the parameters of the session.
+func (s *Service) validateCiphertext(ct *bfv.Ciphertext) error {
+	if s.Params == nil {
+		return errors.New("the session is not set up")
+	}
+	if ct.Degree() < 1 || ct.Degree() > maxCiphertextDegree {
+		return errors.New("ciphertext degree is not supported")
+	}
+	for _, poly := range ct.Value() {
+		if len(poly.Coeffs) != len(s.Params.Moduli.Qi) {
+			return errors.New("ciphertext does not have the moduli of the session")
+		}
+		for i, coeffs := range poly.Coeffs {
+			if uint64(len(coeffs)) != 1<<s.Params.LogN {
+				return errors.New("ciphertext does not have the ring degree of the session")
+			}
+			for _, c := range coeffs {
+				if c >= s.Params.Moduli.Qi[i] {
+					return errors.New("ciphertext coefficient is larger than its modulus")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//unmarshalUntrusted deserializes data received from a client or another server. The deserialization of lattigo trusts the sizes written in the data
+//and panics on malformed data, the panic is returned as an error so that it does not stop the server.
+func unmarshalUntrusted(v encoding.BinaryUnmarshaler, data []byte) (err error) {
+	if len(data) == 0 {
+		return errors.New("insufficient data size")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed data : %v", r)
+		}
+	}()
+	return v.UnmarshalBinary(data)
+}
+
+//unmarshalCiphertext deserializes a ciphertext received from a client or another server and checks that it is a ciphertext of the session.
+func (s *Service) unmarshalCiphertext(data []byte) (*bfv.Ciphertext, error) {
+	ct := new(bfv.Ciphertext)
+	err := unmarshalUntrusted(ct, data)
+	if err != nil {
+		return nil, err
+	}
+	err = s.validateCiphertext(ct)
+	if err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+//validateDescriptor checks that the values described by the descriptor fit in the slots of the given number of ciphertexts.
+func (s *Service) validateDescriptor(descriptor utils.DataDescriptor, ciphertexts int) error {
+	if s.Params == nil {
+		return errors.New("the session is not set up")
+	}
+	return descriptor.Validate(uint64(ciphertexts)<<s.Params.LogN, s.Params.T)
+}
+
+//HandleStorageQuery handler for a client to delete, retain or set the time to live of a ciphertext or dataset.
+func (s *Service) HandleStorageQuery(query *StorageQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got storage query for : ", query.UUID)
+	query.QueryID = uuid.NewV1()
+	return s.sendEvaluationQuery(query.QueryID, query)
+}
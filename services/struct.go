@@ -2,8 +2,12 @@ package services
 
 import (
 	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
 	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/utils"
+	"time"
 )
 
 const ServiceName = "LattigoSMC"
@@ -25,11 +29,15 @@ type QueryData struct {
 	//what is in the query
 	Data []byte
 	UUID uuid.UUID
+	//Values typed values to write instead of the raw data.
+	Values *utils.TypedValues
 }
 
+//PlaintextReply contains the raw data of all the slots and the values decoded with their type.
 type PlaintextReply struct {
-	Data []byte
-	uuid.UUID
+	Data   []byte
+	UUID   uuid.UUID
+	Values *utils.TypedValues
 }
 
 type SetupRequest struct {
@@ -42,6 +50,18 @@ type SetupRequest struct {
 	GenerateRotationKey   bool
 	K                     uint64
 	RotIdx                int
+	//StoreCapacity maximum size in bytes of the ciphertexts stored at the root, 0 for no limit.
+	StoreCapacity uint64
+	//Parameters serialized bfv.Parameters used instead of the default parameters ParamsIdx if set.
+	Parameters []byte
+	//MinSecurity minimum security level in bits of the custom parameters, it is raised to DefaultMinSecurity if it is lower.
+	MinSecurity int
+	//VerifiablePublicKey publishes the share of every node so the nodes and the clients can check the collective public key.
+	VerifiablePublicKey bool
+	//PrivacyBudget maximum epsilon spent on a dataset by the results decrypted with noise, 0 for no limit.
+	PrivacyBudget float64
+	//Sensitivity of the values of the datasets, the minimum sensitivity of the noise. Required with a privacy budget.
+	Sensitivity float64
 }
 
 type KeyRequest struct {
@@ -62,6 +82,7 @@ type KeyReply struct {
 type StoreQuery struct {
 	Ciphertext *bfv.Ciphertext
 	uuid.UUID
+	Descriptor utils.DataDescriptor
 }
 
 type StoreReply struct {
@@ -70,38 +91,49 @@ type StoreReply struct {
 	Done   bool
 }
 
-//Sum UUID with Other
+//Sum UUID with Other. The operands can be given by the names registered at the root instead.
 type SumQuery struct {
-	UUID  uuid.UUID
-	Other uuid.UUID
+	UUID      uuid.UUID
+	Other     uuid.UUID
+	Name      string
+	OtherName string
 }
 
 type SumReply struct {
 	uuid.UUID
 	SumQuery
+	//Error the reason the sum failed, empty on success.
+	Error string
 }
 
-//Multiply UUID with other
+//Multiply UUID with other. The operands can be given by the names registered at the root instead.
 type MultiplyQuery struct {
 	uuid.UUID
-	Other uuid.UUID
+	Other     uuid.UUID
+	Name      string
+	OtherName string
 }
 
 type MultiplyReply struct {
 	uuid.UUID
 	MultiplyQuery
+	//Error the reason the multiplication failed, empty on success.
+	Error string
 }
 
 //RefreshQuery query for UUID to be refreshed.
 type RefreshQuery struct {
-	uuid.UUID
+	UUID       uuid.UUID
 	InnerQuery bool
-	*bfv.Ciphertext
+	Ciphertext *bfv.Ciphertext
 }
 
 //RelinQuery query for UUID to be relinearized
 type RelinQuery struct {
-	uuid.UUID
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+	//Name of the ciphertext registered at the root, used instead of UUID if set.
+	Name string
 }
 
 //SetupReply reply of the setup. if < 0 then it failed.
@@ -113,22 +145,614 @@ type SetupReply struct {
 type QueryPlaintext struct {
 	PublicKey  *bfv.PublicKey
 	Ciphertext *bfv.Ciphertext
-	uuid.UUID
+	UUID       uuid.UUID
+	//Noise differential privacy noise added to the result if not nil.
+	Noise *utils.NoiseParameters
+	//Name of the ciphertext or dataset registered at the root, used instead of UUID if set.
+	Name string
 }
 
 //ReplyPlaintext contains the ciphertext switched under the key requested.
 type ReplyPlaintext struct {
 	uuid.UUID
 	Ciphertext *bfv.Ciphertext
+	Error      string
 }
 
 type RotationQuery struct {
 	uuid.UUID
 	K      uint64
 	RotIdx int
+	//Name of the ciphertext registered at the root, used instead of UUID if set.
+	Name string
 }
 
 type RotationReply struct {
 	Old uuid.UUID
 	New uuid.UUID
+	//Error the reason the rotation failed, empty on success.
+	Error string
+}
+
+//Metadata information stored by the root alongside each ciphertext or dataset.
+type Metadata struct {
+	Descriptor utils.DataDescriptor
+	//References number of ids handed out and of manifests and results that refer to the ciphertext. It is removed when none is left.
+	References int
+	//Expiry time after which the ciphertext is removed, zero if it does not expire.
+	Expiry time.Time
+	//Size in bytes of the ciphertext.
+	Size    uint64
+	Created time.Time
+	Provenance
+	//EpsilonSpent privacy budget spent by the results decrypted with noise, for the ciphertexts and datasets written by the clients.
+	EpsilonSpent float64
+}
+
+//Provenance records the server that made the query and the operation and inputs that produced a ciphertext.
+type Provenance struct {
+	Owner     string
+	Operation string
+	Inputs    []uuid.UUID
+}
+
+//CatalogQuery query for the list of the ciphertexts and datasets stored at the root. Empty filters match all entries.
+//The entries are sorted by creation time, Offset entries are skipped and at most Limit are returned ( 0 for no limit ).
+type CatalogQuery struct {
+	QueryID   uuid.UUID
+	Owner     string
+	Operation string
+	//CreatedAfter and CreatedBefore are unix times in seconds, 0 to ignore.
+	CreatedAfter  int64
+	CreatedBefore int64
+	Offset        uint64
+	Limit         uint64
+	//Dataset lists only the contributions to the federated dataset of this name, empty to ignore.
+	Dataset string
+}
+
+//CatalogEntry describes a stored ciphertext or dataset.
+type CatalogEntry struct {
+	UUID    uuid.UUID
+	Created time.Time
+	//Degree of the ciphertext, of the first chunk for a dataset.
+	Degree uint64
+	//Size in bytes, of all the chunks for a dataset.
+	Size       uint64
+	Chunks     uint64
+	Descriptor utils.DataDescriptor
+	Provenance
+	//Names registered for the ciphertext or dataset.
+	Names []string
+	//EpsilonSpent privacy budget spent on the ciphertext or dataset.
+	EpsilonSpent float64
+}
+
+//CatalogReply contains the entries of the page and the total number of entries that match the filters.
+type CatalogReply struct {
+	QueryID uuid.UUID
+	Entries []CatalogEntry
+	Total   uint64
+	Error   string
+}
+
+//StorageOperation operation on the lifetime of a stored ciphertext or dataset.
+type StorageOperation int
+
+const (
+	//StorageDelete releases a reference, the ciphertext is removed when no reference is left.
+	StorageDelete StorageOperation = iota
+	//StorageRetain adds a reference.
+	StorageRetain
+	//StorageExpire sets the time to live, 0 removes it.
+	StorageExpire
+)
+
+//GarbageCollectionQuery query of a service to itself to remove the expired ciphertexts.
+type GarbageCollectionQuery struct {
+}
+
+//StorageQuery query for Operation on the ciphertext UUID. TTL is in seconds.
+type StorageQuery struct {
+	QueryID   uuid.UUID
+	UUID      uuid.UUID
+	Operation StorageOperation
+	TTL       uint64
+}
+
+//NameOperation operation on the namespace of the root.
+type NameOperation int
+
+const (
+	//NameRegister registers Name for the ciphertext or dataset UUID.
+	NameRegister NameOperation = iota
+	//NameRename renames Name to NewName.
+	NameRename
+	//NameAlias registers NewName for the ciphertext of Name.
+	NameAlias
+	//NameUnregister removes Name and releases its reference.
+	NameUnregister
+	//NameResolve returns the id registered under Name.
+	NameResolve
+)
+
+//NameQuery query for Operation on the namespace. The root replies with the id concerned.
+type NameQuery struct {
+	QueryID   uuid.UUID
+	Operation NameOperation
+	Name      string
+	NewName   string
+	UUID      uuid.UUID
+}
+
+//JobKind kind of query executed by a job.
+type JobKind int
+
+const (
+	//JobSetup setup of the roster with Setup.
+	JobSetup JobKind = iota
+	//JobRefresh collective refresh with Refresh.
+	JobRefresh
+	//JobPlaintext decryption with Plaintext.
+	JobPlaintext
+	//JobWrite encryption and storage of the data with Write.
+	JobWrite
+)
+
+//JobStatus status of a job.
+type JobStatus int
+
+const (
+	//JobQueued the job waits for the previous jobs to finish.
+	JobQueued JobStatus = iota
+	//JobRunning the job is executed.
+	JobRunning
+	//JobDone the job finished, its result is in the reply.
+	JobDone
+	//JobFailed the job failed or was cancelled, the error is in the reply.
+	JobFailed
+)
+
+//SubmitJobQuery query to execute the query of Kind asynchronously. Only the query of the kind is set.
+type SubmitJobQuery struct {
+	Kind      JobKind
+	Setup     *SetupRequest
+	Refresh   *RefreshQuery
+	Plaintext *QueryPlaintext
+	Write     *QueryData
+}
+
+//JobQuery query for the status of the job JobID. Wait is the time in milliseconds to wait for the job to finish, 0 to reply right away.
+//If Cancel is set the job is cancelled instead.
+type JobQuery struct {
+	JobID  uuid.UUID
+	Wait   uint64
+	Cancel bool
+}
+
+//JobReply status of a job. UUID is the id of the result of a refresh or a write, Plaintext the result of a decryption.
+type JobReply struct {
+	JobID     uuid.UUID
+	Status    JobStatus
+	Error     string
+	UUID      uuid.UUID
+	Plaintext *PlaintextReply
+}
+
+//StatusQuery query for the status of the setup of the nodes of the roster.
+type StatusQuery struct {
+	QueryID uuid.UUID
+}
+
+//NodeStatus status of the setup of a node. Error is set if the node did not reply.
+type NodeStatus struct {
+	Server string
+	//Setup is true if the node received the parameters.
+	Setup      bool
+	ParamsIdx  uint64
+	ParamsHash string
+	//Seed hexadecimal seed of the CRP agreed by the nodes, empty before the agreement.
+	Seed string
+	LogN uint64
+	T    uint64
+	//KeyEpoch number of rekeyings of the collective key done by the node.
+	KeyEpoch uint64
+	//RosterVersion number of changes of the members known by the node, Members the size of its roster.
+	RosterVersion uint64
+	Members       int
+	//PublicKey, EvaluationKey and RotationKeys are true if the node took part in the generation of the collective key.
+	PublicKey     bool
+	EvaluationKey bool
+	RotationKeys  bool
+	//Fingerprint sha256 of the collective public key, empty if the node does not hold it.
+	Fingerprint string
+	Rotations   []RotationParameters
+	Error       string
+}
+
+//NodeStatusReply reply of a node to a status query.
+type NodeStatusReply struct {
+	QueryID uuid.UUID
+	NodeStatus
+}
+
+//StatusReply status of all the nodes of the roster. Agree is true if they have the same keys, parameters and rotations, else Disagreement describes the difference.
+type StatusReply struct {
+	Nodes        []NodeStatus
+	Agree        bool
+	Disagreement string
+}
+
+//KeyType collective key.
+type KeyType int
+
+const (
+	//KeyPublic collective public key.
+	KeyPublic KeyType = iota
+	//KeyEvaluation collective relinearization key.
+	KeyEvaluation
+	//KeyRotation collective rotation keys.
+	KeyRotation
+)
+
+//CollectiveKeyQuery query for the chunk Chunk of the serialized collective key.
+type CollectiveKeyQuery struct {
+	QueryID uuid.UUID
+	Key     KeyType
+	Chunk   uint64
+}
+
+//CollectiveKeyReply chunk of the serialized collective key. Fingerprint is the sha256 of the whole key.
+type CollectiveKeyReply struct {
+	QueryID     uuid.UUID
+	Key         KeyType
+	Chunk       uint64
+	Chunks      uint64
+	Data        []byte
+	Fingerprint string
+	Error       string
+}
+
+//KeyFingerprintQuery query for the fingerprint of the collective key held by the server.
+type KeyFingerprintQuery struct {
+	Key KeyType
+}
+
+//KeyFingerprintReply fingerprint of the collective key, empty if the server does not hold it.
+type KeyFingerprintReply struct {
+	Fingerprint string
+}
+
+//PublicKeyTranscriptQuery query for the transcript of the generation of the verifiable collective public key.
+type PublicKeyTranscriptQuery struct{}
+
+//PublicKeyTranscriptReply everything needed to recompute the collective public key : the parameters, the agreed seed of the CRP,
+//the shares of all the nodes in the order of the roster and the serialized key.
+type PublicKeyTranscriptReply struct {
+	Parameters []byte
+	Seed       []byte
+	Shares     [][]byte
+	PublicKey  []byte
+}
+
+//Dataset manifest of a dataset spread over multiple ciphertexts. Chunk i holds the slots [iN, (i+1)N) of the dataset.
+type Dataset struct {
+	Chunks     []uuid.UUID
+	Descriptor utils.DataDescriptor
+}
+
+//StoreDatasetQuery query to store a dataset encrypted in multiple ciphertexts. The root replies with the id of the dataset.
+type StoreDatasetQuery struct {
+	QueryID     uuid.UUID
+	Ciphertexts []*bfv.Ciphertext
+	Descriptor  utils.DataDescriptor
+}
+
+//DatasetQuery query for the manifest of the dataset UUID, or of the dataset registered under Name if it is set.
+type DatasetQuery struct {
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+	Name    string
+}
+
+//DatasetReply contains the chunks of the dataset. A single ciphertext is a dataset of one chunk.
+type DatasetReply struct {
+	QueryID uuid.UUID
+	Dataset
+	Error string
+}
+
+//ImportCiphertextQuery query to store a serialized ciphertext encrypted under the collective key. A descriptor of length 0 means all the slots are unsigned values.
+type ImportCiphertextQuery struct {
+	QueryID    uuid.UUID
+	Ciphertext []byte
+	Descriptor utils.DataDescriptor
+}
+
+//ExportCiphertextQuery query for the serialized ciphertext UUID.
+type ExportCiphertextQuery struct {
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+}
+
+//ExportCiphertextReply contains the serialized ciphertext and the descriptor of its values.
+type ExportCiphertextReply struct {
+	QueryID    uuid.UUID
+	UUID       uuid.UUID
+	Ciphertext []byte
+	Descriptor utils.DataDescriptor
+	Error      string
+}
+
+//Operands names of the operands of an evaluation query registered at the root. If set they are used instead of the ids UUID and Other,
+//the root resolves them when it evaluates the query.
+type Operands struct {
+	Name      string
+	OtherName string
+}
+
+//EvaluationReply reply of the root to an evaluation query. UUID is the id of the result, Error is set if the evaluation failed.
+type EvaluationReply struct {
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+	Error   string
+}
+
+//SubQuery subtract Other from UUID
+type SubQuery struct {
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+	Other   uuid.UUID
+	Operands
+}
+
+//NegQuery query for UUID to be negated
+type NegQuery struct {
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+	Operands
+}
+
+//PlaintextOperation operation between a ciphertext and a plaintext operand
+type PlaintextOperation int
+
+const (
+	//OperationAdd adds the plaintext to the ciphertext
+	OperationAdd PlaintextOperation = iota
+	//OperationSub subtracts the plaintext from the ciphertext
+	OperationSub
+	//OperationMul multiplies the ciphertext by the plaintext
+	OperationMul
+)
+
+//PlaintextOperationQuery query to perform Operation between the ciphertext UUID and the plaintext vector. The vector is encoded at the root.
+type PlaintextOperationQuery struct {
+	QueryID   uuid.UUID
+	UUID      uuid.UUID
+	Operation PlaintextOperation
+	Plaintext []uint64
+	Operands
+}
+
+//ScalarOperationQuery query to perform Operation between the ciphertext UUID and a scalar.
+type ScalarOperationQuery struct {
+	QueryID   uuid.UUID
+	UUID      uuid.UUID
+	Operation PlaintextOperation
+	Scalar    uint64
+	Operands
+}
+
+//RotationParameters a rotation key of type RotIdx with K steps.
+type RotationParameters struct {
+	RotIdx int
+	K      uint64
+}
+
+//InnerSumQuery query for the sum of all the slots of UUID. The result contains the sum in every slot.
+type InnerSumQuery struct {
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+	Operands
+}
+
+//InnerProductQuery query for the inner product of UUID and Other. The result contains the inner product in every slot.
+type InnerProductQuery struct {
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+	Other   uuid.UUID
+	Operands
+}
+
+//ReplicateQuery query to replicate the value of the slot Slot of UUID in all the slots.
+type ReplicateQuery struct {
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+	Slot    uint64
+	Operands
+}
+
+//RotationKeyRequest request from the root to generate additional rotation keys.
+type RotationKeyRequest struct {
+	Rotations []RotationParameters
+}
+
+//MatrixVectorQuery query to multiply the vector UUID by a matrix with the diagonal method.
+//The matrix is either the plaintext Matrix of size Rows x Cols in row-major order, or the encrypted Diagonals.
+type MatrixVectorQuery struct {
+	QueryID   uuid.UUID
+	UUID      uuid.UUID
+	Rows      uint64
+	Cols      uint64
+	Matrix    []uint64
+	Diagonals []uuid.UUID
+	Operands
+}
+
+//PolynomialQuery query to evaluate the polynomial with coefficients Coeffs ( constant term first ) on every slot of UUID.
+type PolynomialQuery struct {
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+	Coeffs  []uint64
+	Operands
+}
+
+//RekeyQuery query for the root to rotate the collective key.
+type RekeyQuery struct {
+	QueryID uuid.UUID
+}
+
+//RekeyPhase step of the rekeying sent by the root to the other nodes.
+type RekeyPhase int
+
+const (
+	//RekeyStart the nodes generate their new secret key share.
+	RekeyStart RekeyPhase = iota
+	//RekeySwitch the nodes take part in the key switching of the ciphertext.
+	RekeySwitch
+	//RekeyCommit the nodes erase their old secret key share and use the new collective public key.
+	RekeyCommit
+	//RekeyAbort the nodes erase their new secret key share and keep the old key.
+	RekeyAbort
+	//RekeyPrepare the nodes check the new collective public key and acknowledge it, the root commits once all the nodes acknowledged it.
+	RekeyPrepare
+)
+
+//RekeyRequest step of the rekeying sent by the root to the old and new members. Ciphertext is the serialized ciphertext to switch,
+//PublicKey the serialized new collective public key.
+type RekeyRequest struct {
+	Phase      RekeyPhase
+	Ciphertext []byte
+	PublicKey  []byte
+	//Roster the members that share the new key, with the parameters of the session for the joining nodes.
+	Roster              onet.Roster
+	Parameters          []byte
+	ParamsIdx           uint64
+	VerifiablePublicKey bool
+	//KeyEpoch and RosterVersion of the session once the rekeying is committed.
+	KeyEpoch      uint64
+	RosterVersion uint64
+}
+
+//RekeyAck acknowledgement of the new collective public key of the epoch KeyEpoch by the node whose identifier is Server. Error is set if the node can not commit it.
+type RekeyAck struct {
+	KeyEpoch uint64
+	Server   string
+	Error    string
+}
+
+//MembershipOperation change of the members of the roster.
+type MembershipOperation int
+
+const (
+	//MemberJoin adds the server to the roster.
+	MemberJoin MembershipOperation = iota
+	//MemberLeave removes the server from the roster.
+	MemberLeave
+)
+
+//ApprovalQuery query for the operator of the member Server to approve the Subject, Signature is the signature of the subject with the private key of the server.
+type ApprovalQuery struct {
+	QueryID   uuid.UUID
+	Subject   string
+	Server    network.ServerIdentityID
+	Signature []byte
+}
+
+//MembershipQuery query for the root to add Server to the roster or remove it.
+type MembershipQuery struct {
+	QueryID   uuid.UUID
+	Operation MembershipOperation
+	Server    *network.ServerIdentity
+}
+
+//TransferQuery query to move the ciphertext UUID to the collective of the Target roster, under its collective public key.
+//The root fetches the collective public key from the root of the Target roster.
+type TransferQuery struct {
+	QueryID uuid.UUID
+	UUID    uuid.UUID
+	Target  onet.Roster
+	//Noise differential privacy noise added to the transferred ciphertext if not nil.
+	Noise *utils.NoiseParameters
+}
+
+//AnalystRegistrationQuery query for an analyst to register the serialized PublicKey to which its results are switched and the SigningKey of its downloads.
+type AnalystRegistrationQuery struct {
+	QueryID    uuid.UUID
+	Name       string
+	PublicKey  []byte
+	SigningKey kyber.Point
+}
+
+//AnalystResultQuery query to switch the ciphertext UUID to the key of the analyst Name. The result is held at the root for download.
+type AnalystResultQuery struct {
+	QueryID uuid.UUID
+	Name    string
+	UUID    uuid.UUID
+	//Noise differential privacy noise added to the result if not nil.
+	Noise *utils.NoiseParameters
+}
+
+//AnalystDownloadQuery query for the analyst Name to download the result UUID switched to its key, with the Signature of the analyst ( see SignDownload ).
+type AnalystDownloadQuery struct {
+	QueryID   uuid.UUID
+	Name      string
+	UUID      uuid.UUID
+	Signature []byte
+}
+
+//Statistic descriptive statistic computed over encrypted columns.
+type Statistic int
+
+const (
+	//StatisticCount number of values of the columns
+	StatisticCount Statistic = iota
+	//StatisticSum sum of the values of the columns
+	StatisticSum
+	//StatisticSumOfSquares sum of the squares of the values of the columns
+	StatisticSumOfSquares
+	//StatisticMean mean of the values, as the sum and the count
+	StatisticMean
+	//StatisticVariance variance of the values, as the sum of squares, the sum and the count
+	StatisticVariance
+	//StatisticHistogram number of values in each bucket of the columns encoded with utils.EncodeBuckets
+	StatisticHistogram
+)
+
+//StatisticsQuery query for the Statistic over the columns UUIDs, which can be written by different parties.
+//Buckets is the number of buckets of the histogram. The columns registered under Names at the root are appended to UUIDs.
+type StatisticsQuery struct {
+	QueryID   uuid.UUID
+	Statistic Statistic
+	UUIDs     []uuid.UUID
+	Buckets   uint64
+	Names     []string
+}
+
+//StatisticsReply ids of the encrypted results of a statistic. The results that are not part of the statistic are nil.
+type StatisticsReply struct {
+	Count        uuid.UUID
+	Sum          uuid.UUID
+	SumOfSquares uuid.UUID
+	Histogram    uuid.UUID
+}
+
+//ContributionQuery query for a member to contribute its local Values to the federated dataset Name. The member encrypts the values
+//under the collective public key and sends only the serialized Ciphertexts and the Descriptor of the values to the root.
+//The Signature of the operator of the member over the ContributionSubject authenticates the contribution, Replace should be set to replace
+//the previous contribution of the member.
+type ContributionQuery struct {
+	QueryID     uuid.UUID
+	Name        string
+	Values      *utils.TypedValues
+	Replace     bool
+	Signature   []byte
+	Ciphertexts [][]byte
+	Descriptor  utils.DataDescriptor
+}
+
+//AggregationQuery query for the sum of the contributions to the federated dataset Name.
+type AggregationQuery struct {
+	QueryID uuid.UUID
+	Name    string
 }
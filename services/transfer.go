@@ -0,0 +1,140 @@
+//transfer contains the transfer of a ciphertext to another collective that ran its own setup with the same parameters.
+//The root of this collective fetches the collective public key of the other collective from its root and switches the ciphertext to that key
+//with the collective public key switching, and the result is imported at the root of the other collective.
+//The ciphertext is never decrypted. The other collective must have been approved by every member, see TransferSubject.
+//Once a privacy budget is set, the transfer adds the noise and spends the budget like a decryption.
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ldsec/lattigo/bfv"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	uuid "gopkg.in/satori/go.uuid.v1"
+	"lattigo-smc/protocols"
+	"time"
+)
+
+//HandleTransferQuery handler for a client to move the ciphertext UUID to the collective of the target roster. Replies with the id of the ciphertext in the other collective.
+func (s *Service) HandleTransferQuery(query *TransferQuery) (network.Message, error) {
+	log.Lvl1(s.ServerIdentity(), "got query to transfer ", query.UUID, " to ", query.Target.List)
+	if len(query.Target.List) == 0 {
+		return nil, errors.New("no target roster in the query")
+	}
+	target := query.Target.List[0]
+	if index, _ := s.Roster.Search(target.ID); index >= 0 {
+		return nil, errors.New("the target roster is this collective")
+	}
+
+	//the root switches the ciphertext to the key of the other collective.
+	query.QueryID = uuid.NewV1()
+	switched, err := s.sendExportQuery(query.QueryID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Lvl1(s.ServerIdentity(), "importing the switched ciphertext at ", target)
+	importQuery := &ImportCiphertextQuery{QueryID: uuid.NewV1(), Ciphertext: switched.Ciphertext, Descriptor: switched.Descriptor}
+	return s.sendQuery(target, importQuery.QueryID, importQuery)
+}
+
+//fetchPublicKey gets the serialized collective public key from the root of another collective, chunk by chunk.
+func (s *Service) fetchPublicKey(root *network.ServerIdentity) ([]byte, error) {
+	var data []byte
+	for chunk, chunks := uint64(0), uint64(1); chunk < chunks; chunk++ {
+		query := &CollectiveKeyQuery{QueryID: uuid.NewV1(), Key: KeyPublic, Chunk: chunk}
+		replies := make(chan CollectiveKeyReply, 1)
+		s.repliesLock.Lock()
+		s.KeyReplies[query.QueryID] = replies
+		s.repliesLock.Unlock()
+		var reply CollectiveKeyReply
+		err := s.SendRaw(root, query)
+		if err != nil {
+			reply.Error = err.Error()
+		} else {
+			select {
+			case reply = <-replies:
+			case <-time.After(10 * time.Second):
+				reply.Error = "timeout while waiting for the public key of the other collective"
+			}
+		}
+		s.repliesLock.Lock()
+		delete(s.KeyReplies, query.QueryID)
+		s.repliesLock.Unlock()
+		if reply.Error != "" {
+			return nil, errors.New(reply.Error)
+		}
+		chunks = reply.Chunks
+		data = append(data, reply.Data...)
+	}
+	return data, nil
+}
+
+//TransferSubject returns the subject the members approve so the ciphertexts can be transferred to the collective of the root.
+func TransferSubject(root *network.ServerIdentity) string {
+	return fmt.Sprintf("transfer to the collective of %s %s", root.ID, root.Public)
+}
+
+//transfer switches the ciphertext of the query to the public key of the other collective. Should be called by the root.
+//The key is fetched by the root from the approved target itself, so a member can not have the ciphertext switched to a key of its own.
+func (s *Service) transfer(tree *onet.Tree, query *TransferQuery) (*bfv.Ciphertext, error) {
+	if len(query.Target.List) == 0 {
+		return nil, errors.New("no target roster in the query")
+	}
+	if err := s.checkRekeying(); err != nil {
+		return nil, err
+	}
+	target := query.Target.List[0]
+	err := s.approvedBy(TransferSubject(target), s.Roster.List)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := s.getCiphertext(query.UUID)
+	if err != nil {
+		return nil, err
+	}
+	if ct.Degree() > 1 {
+		return nil, errors.New("ciphertext " + query.UUID.String() + " should be relinearized before the transfer")
+	}
+	data, err := s.fetchPublicKey(target)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := s.targetPublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+	if query.Noise, err = s.calibrateNoise(query.Noise); err != nil {
+		return nil, err
+	}
+	var sources []uuid.UUID
+	if query.Noise != nil {
+		if sources, err = s.reservePrivacyBudget(query.UUID, query.Noise); err != nil {
+			return nil, err
+		}
+	}
+	switched, err := s.switchToPublicKey(tree, query.UUID, ct, pk, query.Noise)
+	if err != nil {
+		s.refundPrivacyBudget(sources, query.Noise)
+		return nil, err
+	}
+	return switched, nil
+}
+
+//targetPublicKey deserializes the public key of another collective or of an analyst and checks that it is a key of the parameters of the session.
+func (s *Service) targetPublicKey(data []byte) (*bfv.PublicKey, error) {
+	pk := new(bfv.PublicKey)
+	err := unmarshalUntrusted(pk, data)
+	if err != nil {
+		return nil, err
+	}
+	moduli := append(append([]uint64{}, s.Params.Moduli.Qi...), s.Params.Moduli.Pi...)
+	for _, poly := range pk.Get() {
+		if err = protocols.CheckPoly(poly, moduli, s.Params.LogN); err != nil {
+			return nil, errors.New("the public key does not use the parameters of the session : " + err.Error())
+		}
+	}
+	return pk, nil
+}
@@ -0,0 +1,69 @@
+//Reading of the typed values of a column of a CSV file. The first record of the file is the header with the names of the columns.
+package utils
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+)
+
+//ReadCSVColumn reads the values of the column of the CSV with the type and scale of the descriptor. The length of the descriptor is ignored.
+func ReadCSVColumn(r io.Reader, column string, descriptor DataDescriptor) (*TypedValues, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("CSV has no header")
+	}
+	index := -1
+	for i, name := range records[0] {
+		if name == column {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, errors.New("CSV has no column " + column)
+	}
+
+	tv := &TypedValues{Descriptor: DataDescriptor{Type: descriptor.Type, Scale: descriptor.Scale, Length: uint64(len(records) - 1)}}
+	for line, record := range records[1:] {
+		field := record[index]
+		switch descriptor.Type {
+		case TypeUint:
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, csvError(line, err)
+			}
+			tv.Uints = append(tv.Uints, v)
+		case TypeInt:
+			v, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, csvError(line, err)
+			}
+			tv.Ints = append(tv.Ints, v)
+		case TypeFixed:
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, csvError(line, errors.New("invalid number "+field))
+			}
+			tv.Floats = append(tv.Floats, v)
+		case TypeBool:
+			v, err := strconv.ParseBool(field)
+			if err != nil {
+				return nil, csvError(line, err)
+			}
+			tv.Bools = append(tv.Bools, v)
+		default:
+			return nil, errors.New("CSV columns should be numeric or booleans")
+		}
+	}
+	return tv, nil
+}
+
+//csvError returns the error of the record at the line, the header being line 1.
+func csvError(line int, err error) error {
+	return errors.New("line " + strconv.Itoa(line+2) + " : " + err.Error())
+}
@@ -0,0 +1,404 @@
+//Encoding of typed values in the slots of a plaintext. The slots are elements of Z_T with T the plaintext modulus.
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+//DataType type of the values encoded in the slots.
+type DataType int
+
+const (
+	//TypeBytes one byte per slot. This is the raw encoding of the data.
+	TypeBytes DataType = iota
+	//TypeUint unsigned integers smaller than T
+	TypeUint
+	//TypeInt signed integers in [-(T-1)/2, (T-1)/2]
+	TypeInt
+	//TypeFixed fixed-point numbers, the slot contains the signed integer round(value * Scale)
+	TypeFixed
+	//TypeBool booleans encoded as 0 or 1
+	TypeBool
+	//TypeString utf-8 strings, packed with as many bytes per slot as T allows
+	TypeString
+)
+
+//DataDescriptor describes how the slots are decoded.
+type DataDescriptor struct {
+	Type DataType
+	//Scale of the fixed-point numbers.
+	Scale uint64
+	//Length number of values, or number of bytes for strings and bytes.
+	Length uint64
+	//Bound maximum absolute value of the slots of numeric values ( the scaled values for fixed-point numbers ), 0 if it is not known.
+	Bound uint64
+}
+
+//DescriptorSize size of a marshalled descriptor.
+const DescriptorSize = 1 + 8*3
+
+//TypedValues values of a given type. Only the field corresponding to the type of the descriptor is set.
+type TypedValues struct {
+	Descriptor DataDescriptor
+
+	Uints  []uint64
+	Ints   []int64
+	Floats []float64
+	Bools  []bool
+	//Bytes contains the bytes for TypeBytes and TypeString
+	Bytes []byte
+}
+
+//NewBytes returns the typed values for the raw bytes.
+func NewBytes(data []byte) *TypedValues {
+	return &TypedValues{Descriptor: DataDescriptor{Type: TypeBytes, Length: uint64(len(data))}, Bytes: data}
+}
+
+//NewUints returns the typed values for unsigned integers.
+func NewUints(values []uint64) *TypedValues {
+	return &TypedValues{Descriptor: DataDescriptor{Type: TypeUint, Length: uint64(len(values))}, Uints: values}
+}
+
+//NewInts returns the typed values for signed integers.
+func NewInts(values []int64) *TypedValues {
+	return &TypedValues{Descriptor: DataDescriptor{Type: TypeInt, Length: uint64(len(values))}, Ints: values}
+}
+
+//NewFixed returns the typed values for fixed-point numbers with the given scale.
+func NewFixed(values []float64, scale uint64) *TypedValues {
+	return &TypedValues{Descriptor: DataDescriptor{Type: TypeFixed, Scale: scale, Length: uint64(len(values))}, Floats: values}
+}
+
+//NewBools returns the typed values for booleans.
+func NewBools(values []bool) *TypedValues {
+	return &TypedValues{Descriptor: DataDescriptor{Type: TypeBool, Length: uint64(len(values))}, Bools: values}
+}
+
+//NewString returns the typed values for a string.
+func NewString(s string) *TypedValues {
+	return &TypedValues{Descriptor: DataDescriptor{Type: TypeString, Length: uint64(len(s))}, Bytes: []byte(s)}
+}
+
+//Text returns the string for TypeString values.
+func (tv *TypedValues) Text() string {
+	return string(tv.Bytes)
+}
+
+//bytesPerSlot returns the number of bytes of a string packed in a slot of Z_t. It is 0 if a byte does not fit in a slot.
+func bytesPerSlot(t uint64) int {
+	return (bits.Len64(t) - 1) / 8
+}
+
+//Validate checks that the values described fit in the given number of slots of Z_t and can be decoded.
+func (dd *DataDescriptor) Validate(slots uint64, t uint64) error {
+	if dd.Length > math.MaxInt32 {
+		return errors.New("descriptor length is too large")
+	}
+	needed := dd.Length
+	switch dd.Type {
+	case TypeBytes, TypeUint, TypeInt, TypeBool:
+	case TypeFixed:
+		if dd.Scale == 0 {
+			return errors.New("fixed-point values need a scale")
+		}
+	case TypeString:
+		n := uint64(bytesPerSlot(t))
+		if n == 0 {
+			return errors.New("plaintext modulus is too small for strings")
+		}
+		needed = (dd.Length + n - 1) / n
+	default:
+		return errors.New("unknown data type")
+	}
+	if needed > slots {
+		return errors.New("descriptor has more values than the slots")
+	}
+	return nil
+}
+
+//encodeSigned maps a signed integer to Z_t.
+func encodeSigned(v int64, t uint64) (uint64, error) {
+	bound := int64((t - 1) / 2)
+	if v > bound || v < -bound {
+		return 0, errors.New("signed value is out of the range of the plaintext modulus")
+	}
+	if v < 0 {
+		return t - uint64(-v), nil
+	}
+	return uint64(v), nil
+}
+
+//decodeSigned maps an element of Z_t to the signed integer in [-(t-1)/2, (t-1)/2].
+func decodeSigned(v, t uint64) int64 {
+	if v > (t-1)/2 {
+		return -int64(t - v)
+	}
+	return int64(v)
+}
+
+//Encode returns the slots in Z_t encoding the values. The bound of the descriptor is set to the largest absolute value of the numeric values.
+func (tv *TypedValues) Encode(t uint64) ([]uint64, error) {
+	var slots []uint64
+	bound := uint64(0)
+	switch tv.Descriptor.Type {
+	case TypeBytes:
+		slots, _ = BytesToUint64(tv.Bytes, true)
+	case TypeUint:
+		slots = make([]uint64, len(tv.Uints))
+		for i, v := range tv.Uints {
+			if v >= t {
+				return nil, errors.New("unsigned value is larger than the plaintext modulus")
+			}
+			slots[i] = v
+			bound = maxUint64(bound, v)
+		}
+	case TypeInt:
+		slots = make([]uint64, len(tv.Ints))
+		for i, v := range tv.Ints {
+			s, err := encodeSigned(v, t)
+			if err != nil {
+				return nil, err
+			}
+			slots[i] = s
+			bound = maxUint64(bound, absInt64(v))
+		}
+	case TypeFixed:
+		if tv.Descriptor.Scale == 0 {
+			return nil, errors.New("fixed-point values need a scale")
+		}
+		slots = make([]uint64, len(tv.Floats))
+		for i, v := range tv.Floats {
+			scaled := int64(math.Round(v * float64(tv.Descriptor.Scale)))
+			s, err := encodeSigned(scaled, t)
+			if err != nil {
+				return nil, err
+			}
+			slots[i] = s
+			bound = maxUint64(bound, absInt64(scaled))
+		}
+	case TypeBool:
+		slots = make([]uint64, len(tv.Bools))
+		for i, v := range tv.Bools {
+			if v {
+				slots[i] = 1
+			}
+		}
+		bound = 1
+	case TypeString:
+		n := bytesPerSlot(t)
+		if n == 0 {
+			return nil, errors.New("plaintext modulus is too small for strings")
+		}
+		slots = make([]uint64, (len(tv.Bytes)+n-1)/n)
+		for i, b := range tv.Bytes {
+			slots[i/n] = slots[i/n]<<8 | uint64(b)
+		}
+		//align the last slot so every slot holds its bytes in the same position.
+		if rest := len(tv.Bytes) % n; rest != 0 {
+			slots[len(slots)-1] <<= uint(8 * (n - rest))
+		}
+	default:
+		return nil, errors.New("unknown data type")
+	}
+	tv.Descriptor.Bound = bound
+	return slots, nil
+}
+
+//maxUint64 returns the largest of a and b.
+func maxUint64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+//absInt64 returns the absolute value of v.
+func absInt64(v int64) uint64 {
+	if v < 0 {
+		return uint64(-v)
+	}
+	return uint64(v)
+}
+
+//DecodeTypedValues returns the typed values described by the descriptor from the slots in Z_t.
+func DecodeTypedValues(slots []uint64, descriptor DataDescriptor, t uint64) (*TypedValues, error) {
+	err := descriptor.Validate(uint64(len(slots)), t)
+	if err != nil {
+		return nil, err
+	}
+	tv := &TypedValues{Descriptor: descriptor}
+	length := int(descriptor.Length)
+	switch descriptor.Type {
+	case TypeBytes:
+		tv.Bytes, _ = Uint64ToBytes(slots[:length], true)
+	case TypeUint:
+		tv.Uints = make([]uint64, length)
+		copy(tv.Uints, slots)
+	case TypeInt:
+		tv.Ints = make([]int64, length)
+		for i := range tv.Ints {
+			tv.Ints[i] = decodeSigned(slots[i], t)
+		}
+	case TypeFixed:
+		tv.Floats = make([]float64, length)
+		for i := range tv.Floats {
+			tv.Floats[i] = float64(decodeSigned(slots[i], t)) / float64(descriptor.Scale)
+		}
+	case TypeBool:
+		tv.Bools = make([]bool, length)
+		for i := range tv.Bools {
+			tv.Bools[i] = slots[i] != 0
+		}
+	case TypeString:
+		n := bytesPerSlot(t)
+		tv.Bytes = make([]byte, length)
+		for i := range tv.Bytes {
+			tv.Bytes[i] = byte(slots[i/n] >> uint(8*(n-1-i%n)))
+		}
+	default:
+		return nil, errors.New("unknown data type")
+	}
+	return tv, nil
+}
+
+//MultiplyDescriptors returns the descriptor of the product of values described by d1 and d2. The bound is the product of the bounds, 0 if it overflows.
+func MultiplyDescriptors(d1, d2 DataDescriptor) DataDescriptor {
+	res := d1
+	if d1.Type == TypeFixed && d2.Type == TypeFixed {
+		res.Scale = d1.Scale * d2.Scale
+	}
+	res.Bound = MultiplyBound(d1.Bound, d2.Bound)
+	return res
+}
+
+//MultiplyBound returns the product of the bounds, 0 if one of them is not known or if it overflows.
+func MultiplyBound(b1, b2 uint64) uint64 {
+	hi, lo := bits.Mul64(b1, b2)
+	if hi != 0 {
+		return 0
+	}
+	return lo
+}
+
+//MarshalBinary creates a data array from the descriptor.
+func (dd *DataDescriptor) MarshalBinary() ([]byte, error) {
+	data := make([]byte, DescriptorSize)
+	data[0] = byte(dd.Type)
+	binary.BigEndian.PutUint64(data[1:9], dd.Scale)
+	binary.BigEndian.PutUint64(data[9:17], dd.Length)
+	binary.BigEndian.PutUint64(data[17:25], dd.Bound)
+	return data, nil
+}
+
+//UnmarshalBinary creates the descriptor from the data array.
+func (dd *DataDescriptor) UnmarshalBinary(data []byte) error {
+	if len(data) < DescriptorSize {
+		return errors.New("insufficient data size")
+	}
+	dd.Type = DataType(data[0])
+	dd.Scale = binary.BigEndian.Uint64(data[1:9])
+	dd.Length = binary.BigEndian.Uint64(data[9:17])
+	dd.Bound = binary.BigEndian.Uint64(data[17:25])
+	return nil
+}
+
+//MarshalBinary creates a data array from the typed values.
+func (tv *TypedValues) MarshalBinary() ([]byte, error) {
+	data, _ := tv.Descriptor.MarshalBinary()
+	switch tv.Descriptor.Type {
+	case TypeUint:
+		for _, v := range tv.Uints {
+			data = appendUint64(data, v)
+		}
+	case TypeInt:
+		for _, v := range tv.Ints {
+			data = appendUint64(data, uint64(v))
+		}
+	case TypeFixed:
+		for _, v := range tv.Floats {
+			data = appendUint64(data, math.Float64bits(v))
+		}
+	case TypeBool:
+		for _, v := range tv.Bools {
+			var b byte
+			if v {
+				b = 1
+			}
+			data = append(data, b)
+		}
+	default:
+		data = append(data, tv.Bytes...)
+	}
+	return data, nil
+}
+
+//UnmarshalBinary creates the typed values from the data array.
+func (tv *TypedValues) UnmarshalBinary(data []byte) error {
+	err := tv.Descriptor.UnmarshalBinary(data)
+	if err != nil {
+		return err
+	}
+	data = data[DescriptorSize:]
+	size := 8
+	if tv.Descriptor.Type == TypeBool || tv.Descriptor.Type == TypeBytes || tv.Descriptor.Type == TypeString {
+		size = 1
+	}
+	if len(data)%size != 0 || tv.Descriptor.Length != uint64(len(data)/size) {
+		return errors.New("unexpected data size")
+	}
+	length := int(tv.Descriptor.Length)
+	switch tv.Descriptor.Type {
+	case TypeUint:
+		tv.Uints = make([]uint64, length)
+		for i := range tv.Uints {
+			tv.Uints[i] = binary.BigEndian.Uint64(data[8*i : 8*i+8])
+		}
+	case TypeInt:
+		tv.Ints = make([]int64, length)
+		for i := range tv.Ints {
+			tv.Ints[i] = int64(binary.BigEndian.Uint64(data[8*i : 8*i+8]))
+		}
+	case TypeFixed:
+		tv.Floats = make([]float64, length)
+		for i := range tv.Floats {
+			tv.Floats[i] = math.Float64frombits(binary.BigEndian.Uint64(data[8*i : 8*i+8]))
+		}
+	case TypeBool:
+		tv.Bools = make([]bool, length)
+		for i := range tv.Bools {
+			tv.Bools[i] = data[i] != 0
+		}
+	default:
+		tv.Bytes = make([]byte, length)
+		copy(tv.Bytes, data)
+	}
+	return nil
+}
+
+func appendUint64(data []byte, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return append(data, buf...)
+}
+
+//ChunkDescriptors returns the descriptors of the values in each of the chunks of n slots the values described by descriptor are split in.
+func ChunkDescriptors(descriptor DataDescriptor, chunks int, n uint64, t uint64) []DataDescriptor {
+	perChunk := n
+	if descriptor.Type == TypeString {
+		perChunk *= uint64(bytesPerSlot(t))
+	}
+	descriptors := make([]DataDescriptor, chunks)
+	remaining := descriptor.Length
+	for i := range descriptors {
+		descriptors[i] = descriptor
+		descriptors[i].Length = perChunk
+		if remaining < perChunk {
+			descriptors[i].Length = remaining
+		}
+		remaining -= descriptors[i].Length
+	}
+	return descriptors
+}
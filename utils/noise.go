@@ -0,0 +1,30 @@
+//Estimation of the noise growth of the ciphertexts for the bfv parameters.
+package utils
+
+import (
+	"github.com/ldsec/lattigo/bfv"
+	"math"
+)
+
+//LogQ returns log2 of the ciphertext modulus Q. The bit sizes of the moduli are not summed as they overestimate it by up to a bit per modulus.
+func LogQ(params *bfv.Parameters) float64 {
+	logQ := 0.0
+	for _, qi := range params.Moduli.Qi {
+		logQ += math.Log2(float64(qi))
+	}
+	return logQ
+}
+
+//DepthBudget estimates the number of sequential multiplications ( with relinearization ) that a fresh ciphertext supports and can still be decrypted.
+//The estimate is a heuristic : a fresh ciphertext has a noise of about log(6 sigma N) bits and each multiplication adds about log(2 T N) bits.
+func DepthBudget(params *bfv.Parameters) int {
+	N := float64(uint64(1) << params.LogN)
+	logT := math.Log2(float64(params.T))
+	fresh := math.Log2(6 * params.Sigma * N)
+	perMultiplication := math.Log2(2 * float64(params.T) * N)
+	budget := LogQ(params) - logT - 1 - fresh
+	if budget < 0 {
+		return 0
+	}
+	return int(budget / perMultiplication)
+}
@@ -0,0 +1,206 @@
+//Validation of custom bfv parameters : correctness of the moduli and estimation of the security level. Selection of the parameters for a circuit.
+package utils
+
+import (
+	"errors"
+	"github.com/ldsec/lattigo/bfv"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+)
+
+//maxLogQP maximum bit size of the modulus QP for a ring degree 2^LogN and a security level, from the homomorphic encryption standard ( ternary secret ).
+var maxLogQP = map[int]map[uint64]int{
+	128: {10: 27, 11: 54, 12: 109, 13: 218, 14: 438, 15: 881},
+	192: {10: 19, 11: 37, 12: 75, 13: 152, 14: 305, 15: 611},
+	256: {10: 14, 11: 29, 12: 58, 13: 118, 14: 237, 15: 476},
+}
+
+//LogQP returns log2 of the modulus QP used by the keys.
+func LogQP(params *bfv.Parameters) float64 {
+	logQP := LogQ(params)
+	for _, pi := range params.Moduli.Pi {
+		logQP += math.Log2(float64(pi))
+	}
+	return logQP
+}
+
+//SecurityLevel returns the highest security level in bits ( 128, 192 or 256 ) of the parameters, or 0 if they do not reach 128 bits.
+func SecurityLevel(params *bfv.Parameters) int {
+	level := 0
+	for _, lambda := range []int{128, 192, 256} {
+		if max, ok := maxLogQP[lambda][params.LogN]; ok && LogQP(params) <= float64(max) {
+			level = lambda
+		}
+	}
+	return level
+}
+
+//ValidateParameters checks that the parameters are correct and reach the security level minSecurity in bits :
+//the moduli are distinct NTT-friendly primes, the plaintext modulus T is a prime congruent to 1 mod 2N so the slots can be batched.
+//The moduli QiMul of the multiplications are distinct from Qi and large enough to hold the tensor product of two ciphertexts.
+func ValidateParameters(params *bfv.Parameters, minSecurity int) error {
+	if params.LogN < 10 || params.LogN > 15 {
+		return errors.New("LogN should be between 10 and 15")
+	}
+	twoN := uint64(2) << params.LogN
+	if params.Sigma <= 0 {
+		return errors.New("standard deviation of the error should be positive")
+	}
+	if len(params.Moduli.Qi) == 0 || len(params.Moduli.Pi) == 0 || len(params.Moduli.QiMul) == 0 {
+		return errors.New("parameters need ciphertext, key and multiplication moduli")
+	}
+	if !isPrime(params.T) || params.T%twoN != 1 {
+		return errors.New("plaintext modulus should be a prime congruent to 1 mod 2N")
+	}
+
+	seen := make(map[uint64]bool)
+	for _, q := range append(append([]uint64{}, params.Moduli.Qi...), params.Moduli.Pi...) {
+		if seen[q] {
+			return errors.New("modulus " + strconv.FormatUint(q, 10) + " is repeated")
+		}
+		seen[q] = true
+		if !isPrime(q) || q%twoN != 1 {
+			return errors.New("modulus " + strconv.FormatUint(q, 10) + " should be a prime congruent to 1 mod 2N")
+		}
+		if q <= params.T {
+			return errors.New("modulus " + strconv.FormatUint(q, 10) + " should be larger than the plaintext modulus")
+		}
+	}
+
+	//QiMul extends the basis of Qi, it only needs to be coprime with Qi.
+	seenMul := make(map[uint64]bool)
+	logQMul := 0.0
+	for _, q := range params.Moduli.QiMul {
+		if seenMul[q] {
+			return errors.New("multiplication modulus " + strconv.FormatUint(q, 10) + " is repeated")
+		}
+		seenMul[q] = true
+		for _, qi := range params.Moduli.Qi {
+			if q == qi {
+				return errors.New("multiplication modulus " + strconv.FormatUint(q, 10) + " is also a ciphertext modulus")
+			}
+		}
+		if !isPrime(q) || q%twoN != 1 {
+			return errors.New("multiplication modulus " + strconv.FormatUint(q, 10) + " should be a prime congruent to 1 mod 2N")
+		}
+		logQMul += math.Log2(float64(q))
+	}
+	//the coefficients of the tensor product are bounded by N * Q^2 / 2, they must fit in Q * QMul.
+	if logQMul < LogQ(params)+float64(params.LogN) {
+		return errors.New("multiplication moduli are too small for the tensor product, they need " + strconv.Itoa(int(math.Ceil(LogQ(params)))+int(params.LogN)) + " bits")
+	}
+
+	if level := SecurityLevel(params); level < minSecurity {
+		return errors.New("parameters reach " + strconv.Itoa(level) + " bits of security, " + strconv.Itoa(minSecurity) + " are required")
+	}
+	return nil
+}
+
+//isPrime returns true if x is prime.
+func isPrime(x uint64) bool {
+	return new(big.Int).SetUint64(x).ProbablyPrime(20)
+}
+
+//Circuit description of the evaluation the parameters are selected for.
+type Circuit struct {
+	//Depth multiplicative depth of the circuit.
+	Depth int
+	//Additions number of ciphertexts added together.
+	Additions int
+	//PlaintextBits bit size of the values in the slots.
+	PlaintextBits int
+	//Parties number of parties holding a share of the key, the noise of the collective keys grows with it.
+	Parties int
+	//Security minimum security level in bits.
+	Security int
+}
+
+//ParametersSuggestion parameters suggested for a circuit.
+type ParametersSuggestion struct {
+	Params *bfv.Parameters
+	//Security level in bits of the parameters.
+	Security int
+	//NoiseBudget estimated bits of noise budget left after the circuit, negative if the circuit exceeds it.
+	NoiseBudget float64
+	//NeedsRefresh is true if the circuit needs Refreshes collective refreshes to be decrypted.
+	NeedsRefresh bool
+	Refreshes    int
+}
+
+//SuggestParameters returns the smallest default parameters that reach the security level and evaluate the circuit without refresh.
+//The plaintext modulus is replaced by a larger prime if the values need more bits. If no parameters evaluate the circuit,
+//the ones with the largest noise budget are returned with the number of refreshes needed. The noise is estimated as in DepthBudget.
+func SuggestParameters(circuit Circuit) (*ParametersSuggestion, error) {
+	if circuit.Depth < 0 || circuit.Additions < 0 || circuit.Parties < 1 {
+		return nil, errors.New("invalid circuit")
+	}
+	var best *ParametersSuggestion
+	for _, defaults := range bfv.DefaultParams {
+		params := defaults.Copy()
+		if bits.Len64(params.T-1) <= circuit.PlaintextBits {
+			t, err := PlaintextModulus(circuit.PlaintextBits, params.LogN)
+			if err != nil {
+				return nil, err
+			}
+			params.T = t
+		}
+		if ValidateParameters(params, circuit.Security) != nil {
+			continue
+		}
+		suggestion := &ParametersSuggestion{Params: params, Security: SecurityLevel(params)}
+		suggestion.NoiseBudget, suggestion.Refreshes = circuitNoise(params, circuit)
+		suggestion.NeedsRefresh = suggestion.Refreshes > 0
+		if !suggestion.NeedsRefresh {
+			return suggestion, nil
+		}
+		if best == nil || suggestion.NoiseBudget > best.NoiseBudget {
+			best = suggestion
+		}
+	}
+	if best == nil {
+		return nil, errors.New("no parameters reach the security level")
+	}
+	if best.Refreshes < 0 {
+		return nil, errors.New("parameters can not evaluate a single multiplication even with refresh")
+	}
+	return best, nil
+}
+
+//circuitNoise returns the noise budget left after the circuit and the number of refreshes needed, -1 if a multiplication exceeds the budget of a fresh ciphertext.
+func circuitNoise(params *bfv.Parameters, circuit Circuit) (float64, int) {
+	N := float64(uint64(1) << params.LogN)
+	logT := math.Log2(float64(params.T))
+	//the error of the collective public key is the sum of the errors of the parties.
+	fresh := math.Log2(6 * params.Sigma * N * float64(circuit.Parties))
+	perMultiplication := math.Log2(2 * float64(params.T) * N)
+	additions := math.Log2(float64(circuit.Additions + 1))
+	budget := LogQ(params) - logT - 1 - fresh - additions
+
+	left := budget - float64(circuit.Depth)*perMultiplication
+	if left >= 0 {
+		return left, 0
+	}
+	//a refresh resets the noise to the fresh noise.
+	depthPerRefresh := int(budget / perMultiplication)
+	if depthPerRefresh < 1 {
+		return left, -1
+	}
+	return left, (circuit.Depth - 1) / depthPerRefresh
+}
+
+//PlaintextModulus returns the smallest prime larger than 2^plaintextBits congruent to 1 mod 2^(logN+1), so the slots hold values of plaintextBits bits and can be batched.
+func PlaintextModulus(plaintextBits int, logN uint64) (uint64, error) {
+	if plaintextBits < 1 || plaintextBits > 60 {
+		return 0, errors.New("plaintext bit size should be between 1 and 60")
+	}
+	twoN := uint64(2) << logN
+	bound := uint64(1) << uint(plaintextBits)
+	for t := bound/twoN*twoN + 1; t < uint64(1)<<61; t += twoN {
+		if t > bound && isPrime(t) {
+			return t, nil
+		}
+	}
+	return 0, errors.New("no plaintext modulus found")
+}
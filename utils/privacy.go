@@ -0,0 +1,168 @@
+//Differential privacy noise shared between the parties. Every party samples a share of the noise so that the sum of the shares of all the parties
+//follows the calibrated distribution and no single party knows the total noise :
+//- discrete Laplace : the difference of two Polya variables of parameter 1/parties, the sum of the shares is the difference of two geometric variables.
+//- Gaussian : a normal variable of variance sigma^2 / parties rounded to an integer, the sum is close to a discrete Gaussian of variance sigma^2.
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math"
+	mrand "math/rand"
+)
+
+//NoiseMechanism distribution of the differential privacy noise.
+type NoiseMechanism int
+
+const (
+	//NoiseLaplace discrete Laplace noise, for a L1 sensitivity. Gives epsilon differential privacy.
+	NoiseLaplace NoiseMechanism = iota
+	//NoiseGaussian discrete Gaussian noise, for a L2 sensitivity. Gives ( epsilon, delta ) differential privacy.
+	NoiseGaussian
+)
+
+//NoiseParameters calibration of the noise added to the first Slots slots of a result. Epsilon is the privacy budget spent by the result.
+type NoiseParameters struct {
+	Mechanism   NoiseMechanism
+	Epsilon     float64
+	Delta       float64
+	Sensitivity float64
+	Slots       uint64
+}
+
+//Validate checks that the noise can be calibrated.
+func (np *NoiseParameters) Validate() error {
+	if !(np.Epsilon > 0) || math.IsInf(np.Epsilon, 0) {
+		return errors.New("epsilon should be positive")
+	}
+	if !(np.Sensitivity > 0) || math.IsInf(np.Sensitivity, 0) {
+		return errors.New("sensitivity should be positive")
+	}
+	switch np.Mechanism {
+	case NoiseLaplace:
+	case NoiseGaussian:
+		if !(np.Delta > 0 && np.Delta < 1) {
+			return errors.New("delta of the Gaussian mechanism should be between 0 and 1")
+		}
+		if np.Epsilon >= 1 {
+			return errors.New("epsilon of the Gaussian mechanism should be smaller than 1")
+		}
+	default:
+		return errors.New("unknown noise mechanism")
+	}
+	return nil
+}
+
+//noiseTail number of scales above which the noise is negligible : a Laplace noise exceeds it with probability e^-noiseTail.
+const noiseTail = 20
+
+//MaxNoiseScale largest scale of the noise. Sampling the noise takes a time linear in its scale on every party.
+const MaxNoiseScale = 1 << 20
+
+//CheckModulus returns an error if the noise can wrap modulo the plaintext modulus t and destroy the result, or if it is too large to be sampled.
+func (np *NoiseParameters) CheckModulus(t uint64) error {
+	scale := np.Scale()
+	if scale > MaxNoiseScale {
+		return errors.New("the scale of the noise is too large, epsilon should be larger")
+	}
+	if scale*noiseTail >= float64(t)/2 {
+		return errors.New("the noise is too large for the plaintext modulus, epsilon should be larger")
+	}
+	return nil
+}
+
+//Scale returns the scale b of the Laplace noise or the standard deviation sigma of the Gaussian noise.
+func (np *NoiseParameters) Scale() float64 {
+	if np.Mechanism == NoiseGaussian {
+		return np.Sensitivity * math.Sqrt(2*math.Log(1.25/np.Delta)) / np.Epsilon
+	}
+	return np.Sensitivity / np.Epsilon
+}
+
+//Share samples the share of the noise of one of the parties for each slot.
+func (np *NoiseParameters) Share(parties int) ([]int64, error) {
+	if err := np.Validate(); err != nil {
+		return nil, err
+	}
+	if parties < 1 {
+		return nil, errors.New("the noise needs at least one party")
+	}
+	random := mrand.New(cryptoSource{})
+	share := make([]int64, np.Slots)
+	scale := np.Scale()
+	n := float64(parties)
+	for i := range share {
+		if np.Mechanism == NoiseGaussian {
+			share[i] = int64(math.Round(random.NormFloat64() * scale / math.Sqrt(n)))
+		} else {
+			p := math.Exp(-1 / scale)
+			share[i] = polya(random, 1/n, p) - polya(random, 1/n, p)
+		}
+	}
+	return share, nil
+}
+
+//polya samples a negative binomial variable of parameter r and success probability 1 - p, as a Poisson variable of a Gamma distributed mean.
+//The sum of 1/r such variables is a geometric variable of parameter p.
+func polya(random *mrand.Rand, r, p float64) int64 {
+	return poisson(random, gamma(random, r)*p/(1-p))
+}
+
+//gamma samples a Gamma variable of the shape and of scale 1 with the method of Marsaglia and Tsang.
+func gamma(random *mrand.Rand, shape float64) float64 {
+	if shape < 1 {
+		//boost the shape : Gamma(shape) = Gamma(shape + 1) * U^(1/shape)
+		return gamma(random, shape+1) * math.Pow(random.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := random.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := random.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+//poissonChunk largest mean sampled at once, exp(-mean) does not underflow.
+const poissonChunk = 500
+
+//poisson samples a Poisson variable of the mean, as a sum of Poisson variables of smaller means sampled with the method of Knuth.
+func poisson(random *mrand.Rand, mean float64) int64 {
+	var k int64
+	for mean > 0 {
+		chunk := math.Min(mean, poissonChunk)
+		mean -= chunk
+		limit := math.Exp(-chunk)
+		product := random.Float64()
+		for product > limit {
+			k++
+			product *= random.Float64()
+		}
+	}
+	return k
+}
+
+//cryptoSource source of math/rand that reads crypto/rand, so the noise can not be predicted.
+type cryptoSource struct{}
+
+func (cryptoSource) Int63() int64 {
+	return int64(cryptoSource{}.Uint64() >> 1)
+}
+
+func (cryptoSource) Uint64() uint64 {
+	var data [8]byte
+	if _, err := rand.Read(data[:]); err != nil {
+		panic(err)
+	}
+	return binary.LittleEndian.Uint64(data[:])
+}
+
+func (cryptoSource) Seed(int64) {}
@@ -0,0 +1,71 @@
+//Encodings and decodings of the descriptive statistics computed over encrypted columns.
+//A column of a histogram is bucketed : every value takes a block of Buckets slots with a 1 in the slot of its bucket, so the histogram is the sum of the blocks.
+//The mean and the variance are decrypted as the sums and the count, and divided by the client.
+package utils
+
+import (
+	"errors"
+	"sort"
+)
+
+//Bucket returns the index of the bucket of the value : the number of bounds smaller or equal to the value. The bounds should be sorted.
+func Bucket(value float64, bounds []float64) uint64 {
+	return uint64(sort.Search(len(bounds), func(i int) bool { return bounds[i] > value }))
+}
+
+//EncodeBuckets returns the bucketed encoding of the bucket indices. The number of buckets should be a power of two.
+func EncodeBuckets(indices []uint64, buckets uint64) (*TypedValues, error) {
+	if buckets == 0 || buckets&(buckets-1) != 0 {
+		return nil, errors.New("number of buckets should be a power of two")
+	}
+	slots := make([]uint64, uint64(len(indices))*buckets)
+	for i, b := range indices {
+		if b >= buckets {
+			return nil, errors.New("bucket index is larger than the number of buckets")
+		}
+		slots[uint64(i)*buckets+b] = 1
+	}
+	return NewUints(slots), nil
+}
+
+//Float returns the first decoded value as a float. Used for the results of the statistics, which hold the value in every slot.
+func (tv *TypedValues) Float() (float64, error) {
+	switch {
+	case len(tv.Uints) > 0:
+		return float64(tv.Uints[0]), nil
+	case len(tv.Ints) > 0:
+		return float64(tv.Ints[0]), nil
+	case len(tv.Floats) > 0:
+		return tv.Floats[0], nil
+	}
+	return 0, errors.New("no numeric value")
+}
+
+//Mean returns the mean from the decrypted sum and count.
+func Mean(sum, count *TypedValues) (float64, error) {
+	s, err := sum.Float()
+	if err != nil {
+		return 0, err
+	}
+	n, err := count.Float()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, errors.New("mean of no values")
+	}
+	return s / n, nil
+}
+
+//Variance returns the population variance from the decrypted sum of squares, sum and count.
+func Variance(sumOfSquares, sum, count *TypedValues) (float64, error) {
+	mean, err := Mean(sum, count)
+	if err != nil {
+		return 0, err
+	}
+	squares, err := Mean(sumOfSquares, count)
+	if err != nil {
+		return 0, err
+	}
+	return squares - mean*mean, nil
+}
@@ -3,7 +3,10 @@ package utils
 import (
 	"crypto/rand"
 	"crypto/subtle"
+	"github.com/ldsec/lattigo/bfv"
 	"go.dedis.ch/onet/v3/log"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -32,3 +35,327 @@ func TestBytesToUint64(t *testing.T) {
 		}
 	}
 }
+
+func TestDepthBudget(t *testing.T) {
+	for i := 1; i < len(bfv.DefaultParams); i++ {
+		if DepthBudget(bfv.DefaultParams[i]) < DepthBudget(bfv.DefaultParams[i-1]) {
+			t.Fatal("Depth budget should not decrease with larger parameters")
+		}
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+	T := uint64(65537)
+	values := []*TypedValues{
+		NewBytes([]byte("lattigo")),
+		NewUints([]uint64{0, 1, 255, 65536}),
+		NewInts([]int64{-32768, -1, 0, 1, 32768}),
+		NewFixed([]float64{-1.5, 0.25, 3.75}, 100),
+		NewBools([]bool{true, false, true}),
+		NewString("lattigo smc"),
+	}
+	for _, tv := range values {
+		slots, err := tv.Encode(T)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeTypedValues(slots, tv.Descriptor, T)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := decoded.MarshalBinary()
+		expected, _ := tv.MarshalBinary()
+		if subtle.ConstantTimeCompare(data, expected) == 0 {
+			t.Fatal("Decoded values differ for type ", tv.Descriptor.Type)
+		}
+	}
+
+	bounds := map[*TypedValues]uint64{
+		NewUints([]uint64{3, 7, 5}):          7,
+		NewInts([]int64{2, -9, 4}):           9,
+		NewFixed([]float64{-1.5, 0.25}, 100): 150,
+		NewBools([]bool{false, true}):        1,
+	}
+	for tv, bound := range bounds {
+		_, err := tv.Encode(T)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tv.Descriptor.Bound != bound {
+			t.Fatal("Wrong bound for type ", tv.Descriptor.Type, " : ", tv.Descriptor.Bound)
+		}
+		var descriptor DataDescriptor
+		data, _ := tv.Descriptor.MarshalBinary()
+		if err = descriptor.UnmarshalBinary(data); err != nil || descriptor != tv.Descriptor {
+			t.Fatal("Descriptor differs after marshalling : ", descriptor)
+		}
+	}
+	if MultiplyDescriptors(DataDescriptor{Bound: 6}, DataDescriptor{Bound: 7}).Bound != 42 || MultiplyBound(1<<32, 1<<32) != 0 {
+		t.Fatal("Wrong bound of the product")
+	}
+
+	_, err := NewUints([]uint64{T}).Encode(T)
+	if err == nil {
+		t.Fatal("Value larger than the plaintext modulus should not be encoded")
+	}
+	_, err = NewInts([]int64{32769}).Encode(T)
+	if err == nil {
+		t.Fatal("Value out of the signed range should not be encoded")
+	}
+}
+
+func TestValidateDescriptor(t *testing.T) {
+	T := uint64(65537)
+	valid := []DataDescriptor{
+		{Type: TypeUint, Length: 8},
+		{Type: TypeFixed, Scale: 100, Length: 8},
+		{Type: TypeString, Length: 16},
+	}
+	for _, d := range valid {
+		if err := d.Validate(8, T); err != nil {
+			t.Fatal("Descriptor should be valid : ", err)
+		}
+	}
+	invalid := []DataDescriptor{
+		{Type: TypeUint, Length: 9},
+		{Type: TypeUint, Length: 1 << 63},
+		{Type: TypeFixed, Length: 8},
+		{Type: TypeString, Length: 17},
+		{Type: 42, Length: 1},
+	}
+	for _, d := range invalid {
+		if err := d.Validate(8, T); err == nil {
+			t.Fatal("Descriptor should be rejected : ", d)
+		}
+	}
+	small := DataDescriptor{Type: TypeString, Length: 1}
+	if err := small.Validate(8, 256); err != nil {
+		t.Fatal("A byte fits in a slot of Z_256 : ", err)
+	}
+	if err := small.Validate(8, 255); err == nil {
+		t.Fatal("Strings should be rejected when a byte does not fit in a slot")
+	}
+	_, err := DecodeTypedValues(make([]uint64, 8), DataDescriptor{Type: TypeInt, Length: 1 << 63}, T)
+	if err == nil {
+		t.Fatal("Descriptor larger than the slots should not be decoded")
+	}
+}
+
+func TestChunkDescriptors(t *testing.T) {
+	descriptors := ChunkDescriptors(DataDescriptor{Type: TypeUint, Length: 10}, 3, 4, 65537)
+	lengths := []uint64{4, 4, 2}
+	for i, d := range descriptors {
+		if d.Length != lengths[i] || d.Type != TypeUint {
+			t.Fatal("Wrong descriptor for chunk ", i)
+		}
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	for _, params := range bfv.DefaultParams {
+		if err := ValidateParameters(params, 0); err != nil {
+			t.Fatal("Default parameters should be valid :", err)
+		}
+		if SecurityLevel(params) < 128 || ValidateParameters(params, 128) != nil {
+			t.Fatal("Default parameters should reach 128 bits of security, log QP is", LogQP(params))
+		}
+	}
+
+	params := bfv.DefaultParams[0].Copy()
+	params.T = 65536
+	if ValidateParameters(params, 0) == nil {
+		t.Fatal("Plaintext modulus that is not prime should be rejected")
+	}
+
+	params = bfv.DefaultParams[0].Copy()
+	params.Moduli.Pi = append(params.Moduli.Pi, params.Moduli.Qi[0])
+	if ValidateParameters(params, 0) == nil {
+		t.Fatal("Repeated modulus should be rejected")
+	}
+
+	invalidMul := [][]uint64{
+		{},
+		{bfv.DefaultParams[0].Moduli.QiMul[0], bfv.DefaultParams[0].Moduli.QiMul[0]},
+		{bfv.DefaultParams[0].Moduli.Qi[0], bfv.DefaultParams[0].Moduli.QiMul[1]},
+		{bfv.DefaultParams[0].Moduli.QiMul[0], 1 << 61},
+		{bfv.DefaultParams[0].Moduli.QiMul[0]},
+	}
+	for _, qiMul := range invalidMul {
+		params = bfv.DefaultParams[0].Copy()
+		params.Moduli.QiMul = qiMul
+		if ValidateParameters(params, 0) == nil {
+			t.Fatal("Invalid multiplication moduli should be rejected :", qiMul)
+		}
+	}
+
+	//the same moduli with a smaller ring are not secure.
+	params = bfv.DefaultParams[len(bfv.DefaultParams)-1].Copy()
+	params.LogN = 10
+	if SecurityLevel(params) != 0 || ValidateParameters(params, 128) == nil {
+		t.Fatal("Insecure parameters should be rejected")
+	}
+}
+
+func TestSuggestParameters(t *testing.T) {
+	suggestion, err := SuggestParameters(Circuit{Depth: 1, Additions: 10, PlaintextBits: 16, Parties: 3, Security: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suggestion.NeedsRefresh || suggestion.NoiseBudget < 0 || suggestion.Security < 128 {
+		t.Fatal("Small circuit should fit in secure parameters without refresh")
+	}
+	if suggestion.Params.LogN != bfv.DefaultParams[0].LogN {
+		t.Fatal("Smallest default parameters should be suggested for a small circuit")
+	}
+
+	//the default parameters do not reach 256 bits of security.
+	if _, err = SuggestParameters(Circuit{Depth: 1, PlaintextBits: 16, Parties: 3, Security: 256}); err == nil {
+		t.Fatal("Security level that no default parameters reach should be rejected")
+	}
+
+	//more bits need a larger plaintext modulus that still allows batching.
+	suggestion, err = SuggestParameters(Circuit{Depth: 1, PlaintextBits: 20, Parties: 3, Security: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suggestion.Params.T <= 1<<20 || ValidateParameters(suggestion.Params, 128) != nil {
+		t.Fatal("Plaintext modulus should hold 20 bits and be valid")
+	}
+
+	suggestion, err = SuggestParameters(Circuit{Depth: 100, PlaintextBits: 16, Parties: 3, Security: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !suggestion.NeedsRefresh || suggestion.Refreshes < 1 {
+		t.Fatal("Deep circuit should need refresh")
+	}
+}
+
+func TestNoiseShare(t *testing.T) {
+	parties := 3
+	slots := 20000
+	laplace := &NoiseParameters{Mechanism: NoiseLaplace, Epsilon: 1, Sensitivity: 1, Slots: uint64(slots)}
+	gaussian := &NoiseParameters{Mechanism: NoiseGaussian, Epsilon: 0.5, Delta: 1e-5, Sensitivity: 1, Slots: uint64(slots)}
+	p := math.Exp(-1 / laplace.Scale())
+	sigma := gaussian.Scale()
+	expected := map[*NoiseParameters]float64{
+		laplace:  2 * p / ((1 - p) * (1 - p)),
+		gaussian: sigma*sigma + float64(parties)/12,
+	}
+
+	for np, variance := range expected {
+		//the sum of the shares of all the parties has the variance of the calibrated noise.
+		noise := make([]float64, slots)
+		for i := 0; i < parties; i++ {
+			share, err := np.Share(parties)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j, v := range share {
+				noise[j] += float64(v)
+			}
+		}
+		mean, square := 0.0, 0.0
+		for _, v := range noise {
+			mean += v
+			square += v * v
+		}
+		mean /= float64(slots)
+		square = square/float64(slots) - mean*mean
+		if math.Abs(mean) > 4*math.Sqrt(variance/float64(slots)) || math.Abs(square-variance) > 0.1*variance {
+			t.Fatal("Noise of mechanism ", np.Mechanism, " has mean ", mean, " and variance ", square, " instead of ", variance)
+		}
+	}
+
+	invalid := []NoiseParameters{
+		{Mechanism: NoiseLaplace, Epsilon: 0, Sensitivity: 1},
+		{Mechanism: NoiseLaplace, Epsilon: 1, Sensitivity: -1},
+		{Mechanism: NoiseGaussian, Epsilon: 0.5, Sensitivity: 1},
+		{Mechanism: NoiseGaussian, Epsilon: 2, Delta: 1e-5, Sensitivity: 1},
+		{Mechanism: 5, Epsilon: 1, Sensitivity: 1},
+	}
+	for _, np := range invalid {
+		if np.Validate() == nil {
+			t.Fatal("Invalid noise parameters should be rejected : ", np)
+		}
+	}
+
+	//a tiny epsilon gives a noise that wraps modulo T and takes forever to sample.
+	tiny := &NoiseParameters{Mechanism: NoiseLaplace, Epsilon: 1e-9, Sensitivity: 1}
+	if tiny.CheckModulus(65537) == nil {
+		t.Fatal("Noise larger than the plaintext modulus should be rejected")
+	}
+	if err := laplace.CheckModulus(65537); err != nil {
+		t.Fatal("Could not use the noise with the plaintext modulus :", err)
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	bounds := []float64{10, 20, 30}
+	values := []float64{5, 10, 25, 42}
+	indices := make([]uint64, len(values))
+	for i, v := range values {
+		indices[i] = Bucket(v, bounds)
+	}
+	tv, err := EncodeBuckets(indices, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint64{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+	for i, v := range expected {
+		if tv.Uints[i] != v {
+			t.Fatal("Wrong bucketed encoding in slot ", i)
+		}
+	}
+	if _, err = EncodeBuckets(indices, 3); err == nil {
+		t.Fatal("Number of buckets that is not a power of two should be rejected")
+	}
+	if _, err = EncodeBuckets([]uint64{4}, 4); err == nil {
+		t.Fatal("Bucket index out of the buckets should be rejected")
+	}
+
+	//values 1, 2, 3, 6 : mean 3 and variance 3.5
+	mean, err := Mean(NewInts([]int64{12}), NewUints([]uint64{4}))
+	if err != nil || mean != 3 {
+		t.Fatal("Wrong mean ", mean, err)
+	}
+	variance, err := Variance(NewFixed([]float64{50}, 1), NewInts([]int64{12}), NewUints([]uint64{4}))
+	if err != nil || variance != 3.5 {
+		t.Fatal("Wrong variance ", variance, err)
+	}
+	if _, err = Mean(NewInts([]int64{12}), NewUints([]uint64{0})); err == nil {
+		t.Fatal("Mean of no values should be rejected")
+	}
+}
+
+func TestReadCSVColumn(t *testing.T) {
+	data := "id,age,weight,smoker\n1,42,71.5,true\n2,37,64.25,false\n"
+	ages, err := ReadCSVColumn(strings.NewReader(data), "age", DataDescriptor{Type: TypeUint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ages.Descriptor.Length != 2 || ages.Uints[0] != 42 || ages.Uints[1] != 37 {
+		t.Fatal("Wrong values of the column : ", ages.Uints)
+	}
+	weights, err := ReadCSVColumn(strings.NewReader(data), "weight", DataDescriptor{Type: TypeFixed, Scale: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weights.Descriptor.Scale != 100 || weights.Floats[1] != 64.25 {
+		t.Fatal("Wrong values of the column : ", weights.Floats)
+	}
+	smokers, err := ReadCSVColumn(strings.NewReader(data), "smoker", DataDescriptor{Type: TypeBool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !smokers.Bools[0] || smokers.Bools[1] {
+		t.Fatal("Wrong values of the column : ", smokers.Bools)
+	}
+
+	if _, err = ReadCSVColumn(strings.NewReader(data), "height", DataDescriptor{Type: TypeUint}); err == nil {
+		t.Fatal("Missing column should be rejected")
+	}
+	if _, err = ReadCSVColumn(strings.NewReader(data), "weight", DataDescriptor{Type: TypeInt}); err == nil {
+		t.Fatal("Values that do not have the type should be rejected")
+	}
+}